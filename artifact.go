@@ -0,0 +1,300 @@
+package reggie
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Media types and annotations of artifacts.
+const (
+	MediaTypeEmptyJSON    = "application/vnd.oci.empty.v1+json"
+	MediaTypeArtifactFile = "application/vnd.oci.image.layer.v1.tar"
+	AnnotationTitle       = "org.opencontainers.image.title"
+)
+
+var (
+	// emptyJSON is the content of the empty config.
+	emptyJSON = []byte("{}")
+
+	// EmptyConfig is the descriptor of the empty JSON object, which the
+	// image spec recommends as the config of artifacts without one.
+	EmptyConfig = Descriptor{MediaType: MediaTypeEmptyJSON, Digest: DigestFromBytes(emptyJSON), Size: int64(len(emptyJSON))}
+)
+
+type (
+	// ArtifactFile is a file to push as a layer of an artifact.
+	ArtifactFile struct {
+		// Path is the file to push.
+		Path string
+
+		// MediaType is the media type of the layer, defaulting to
+		// MediaTypeArtifactFile.
+		MediaType string
+
+		// Title is the name the file is pulled as, stored in the
+		// org.opencontainers.image.title annotation. It defaults to the
+		// base name of Path and may contain slashes to pull the file into
+		// a subdirectory.
+		Title string
+
+		// Annotations are added to the layer's descriptor.
+		Annotations map[string]string
+	}
+
+	// Artifact is an image manifest describing an artifact, whose layers
+	// are files.
+	Artifact struct {
+		SchemaVersion int               `json:"schemaVersion"`
+		MediaType     string            `json:"mediaType"`
+		ArtifactType  string            `json:"artifactType,omitempty"`
+		Config        Descriptor        `json:"config"`
+		Layers        []Descriptor      `json:"layers"`
+		Annotations   map[string]string `json:"annotations,omitempty"`
+
+		// Descriptor describes the manifest itself.
+		Descriptor Descriptor `json:"-"`
+	}
+
+	artifactConfig struct {
+		Config        Descriptor
+		ConfigContent []byte
+		Annotations   map[string]string
+		BlobOptions   []blobOption
+	}
+
+	artifactOption func(c *artifactConfig)
+)
+
+// WithArtifactConfig pushes content with the given media type as the config
+// of an artifact, rather than the empty config.
+func WithArtifactConfig(mediaType string, content []byte) artifactOption {
+	return func(c *artifactConfig) {
+		c.Config = Descriptor{MediaType: mediaType, Digest: DigestFromBytes(content), Size: int64(len(content))}
+		c.ConfigContent = content
+	}
+}
+
+// WithArtifactAnnotations sets the annotations of an artifact's manifest.
+func WithArtifactAnnotations(annotations map[string]string) artifactOption {
+	return func(c *artifactConfig) {
+		c.Annotations = annotations
+	}
+}
+
+// WithArtifactBlobOptions applies blob options, such as progress callbacks,
+// to each blob of an artifact pushed or pulled.
+func WithArtifactBlobOptions(opts ...blobOption) artifactOption {
+	return func(c *artifactConfig) {
+		c.BlobOptions = append(c.BlobOptions, opts...)
+	}
+}
+
+// PushArtifact pushes files as the layers of an artifact and tags its
+// manifest with reference. The artifact's config is the empty config unless
+// WithArtifactConfig is given, in which case artifactType may be empty to
+// use the config's media type as the type of the artifact. Artifacts without
+// files have the empty descriptor as their only layer.
+func (client *Client) PushArtifact(ctx context.Context, name string, reference string, artifactType string, files []ArtifactFile, opts ...artifactOption) (artifact *Artifact, err error) {
+	conf := &artifactConfig{Config: EmptyConfig, ConfigContent: emptyJSON}
+	for _, o := range opts {
+		o(conf)
+	}
+	if artifactType == "" && conf.Config.MediaType == MediaTypeEmptyJSON {
+		return nil, errors.New("artifacts with the empty config require an artifact type")
+	}
+	ctx, span := client.startOperation(ctx, "PushArtifact", name, "", 0)
+	defer func() { endSpan(span, err) }()
+
+	artifact = &Artifact{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageManifest,
+		ArtifactType:  artifactType,
+		Config:        conf.Config,
+		Layers:        []Descriptor{},
+		Annotations:   conf.Annotations,
+	}
+	titles := map[string]bool{}
+	for _, f := range files {
+		layer, err := fileDescriptor(f)
+		if err != nil {
+			return nil, err
+		}
+		title := layer.Annotations[AnnotationTitle]
+		if _, err := titlePath("", title); err != nil {
+			return nil, err
+		}
+		if titles[title] {
+			return nil, fmt.Errorf("more than one artifact file titled %q", title)
+		}
+		titles[title] = true
+		path := f.Path
+		open := func() (io.ReadCloser, error) {
+			return os.Open(path)
+		}
+		if err := client.PushBlob(ctx, name, layer, open, conf.BlobOptions...); err != nil {
+			return nil, fmt.Errorf("pushing %s: %w", f.Path, err)
+		}
+		artifact.Layers = append(artifact.Layers, layer)
+	}
+	open := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(conf.ConfigContent)), nil
+	}
+	if err := client.PushBlob(ctx, name, conf.Config, open, conf.BlobOptions...); err != nil {
+		return nil, fmt.Errorf("pushing config: %w", err)
+	}
+	if len(artifact.Layers) == 0 {
+		// manifests need at least one layer, for which the image spec
+		// recommends the empty descriptor
+		if conf.Config.Digest != EmptyConfig.Digest {
+			open := func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(emptyJSON)), nil
+			}
+			if err := client.PushBlob(ctx, name, EmptyConfig, open, conf.BlobOptions...); err != nil {
+				return nil, fmt.Errorf("pushing empty layer: %w", err)
+			}
+		}
+		artifact.Layers = append(artifact.Layers, EmptyConfig)
+	}
+
+	content, err := json.Marshal(artifact)
+	if err != nil {
+		return nil, err
+	}
+	artifact.Descriptor, err = client.PushManifest(ctx, name, reference, MediaTypeImageManifest, content)
+	if err != nil {
+		return nil, err
+	}
+	artifact.Descriptor.ArtifactType = artifact.Type()
+	return artifact, nil
+}
+
+// FetchArtifact fetches the manifest of an artifact by tag or digest.
+func (client *Client) FetchArtifact(ctx context.Context, name string, reference string) (artifact *Artifact, err error) {
+	ctx, span := client.startOperation(ctx, "FetchArtifact", name, "", 0)
+	defer func() { endSpan(span, err) }()
+	desc, content, err := client.GetManifest(ctx, name, reference)
+	if err != nil {
+		return nil, err
+	}
+	if desc.MediaType != MediaTypeImageManifest {
+		return nil, fmt.Errorf("%s is a %s rather than an image manifest", reference, desc.MediaType)
+	}
+	artifact = &Artifact{}
+	if err := json.Unmarshal(content, artifact); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %w", reference, err)
+	}
+	desc.ArtifactType = artifact.Type()
+	artifact.Descriptor = desc
+	return artifact, nil
+}
+
+// PullArtifact pulls the files of an artifact into dir, naming each after
+// its title annotation. Layers without a title are skipped. Titles which are
+// absolute or would escape dir are rejected before anything is written.
+func (client *Client) PullArtifact(ctx context.Context, name string, reference string, dir string, opts ...artifactOption) (artifact *Artifact, err error) {
+	conf := &artifactConfig{}
+	for _, o := range opts {
+		o(conf)
+	}
+	ctx, span := client.startOperation(ctx, "PullArtifact", name, "", 0)
+	defer func() { endSpan(span, err) }()
+	if artifact, err = client.FetchArtifact(ctx, name, reference); err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(artifact.Layers))
+	seen := map[string]bool{}
+	for i, layer := range artifact.Layers {
+		title, ok := layer.Annotations[AnnotationTitle]
+		if !ok {
+			continue
+		}
+		path, err := titlePath(dir, title)
+		if err != nil {
+			return nil, err
+		}
+		if seen[path] {
+			return nil, fmt.Errorf("more than one artifact file titled %q", title)
+		}
+		seen[path] = true
+		paths[i] = path
+	}
+	for i, layer := range artifact.Layers {
+		if paths[i] == "" {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(paths[i]), 0o755); err != nil {
+			return nil, err
+		}
+		if err := client.PullBlobToFile(ctx, name, layer, paths[i], conf.BlobOptions...); err != nil {
+			return nil, fmt.Errorf("pulling %s: %w", layer.Annotations[AnnotationTitle], err)
+		}
+	}
+	return artifact, nil
+}
+
+// Type returns the type of an artifact, which is the media type of its
+// config if it has no artifact type.
+func (a *Artifact) Type() string {
+	if a.ArtifactType != "" {
+		return a.ArtifactType
+	}
+	return a.Config.MediaType
+}
+
+// fileDescriptor hashes a file, returning its descriptor as a layer of an
+// artifact.
+func fileDescriptor(f ArtifactFile) (Descriptor, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if info.IsDir() {
+		return Descriptor{}, fmt.Errorf("%s is a directory", f.Path)
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	desc := Descriptor{
+		MediaType:   f.MediaType,
+		Digest:      "sha256:" + hex.EncodeToString(h.Sum(nil)),
+		Size:        size,
+		Annotations: map[string]string{},
+	}
+	if desc.MediaType == "" {
+		desc.MediaType = MediaTypeArtifactFile
+	}
+	for k, v := range f.Annotations {
+		desc.Annotations[k] = v
+	}
+	desc.Annotations[AnnotationTitle] = f.Title
+	if f.Title == "" {
+		desc.Annotations[AnnotationTitle] = filepath.Base(f.Path)
+	}
+	return desc, nil
+}
+
+// titlePath returns the path within dir a file with the given title is
+// pulled to, rejecting titles which are empty, absolute or escape dir.
+func titlePath(dir string, title string) (string, error) {
+	local := filepath.FromSlash(title)
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("artifact file title %q is not a path within the directory", title)
+	}
+	return filepath.Join(dir, local), nil
+}
@@ -0,0 +1,118 @@
+package reggie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bloodorangeio/reggie/reggietest"
+)
+
+func TestPushAndPullArtifact(t *testing.T) {
+	ctx := context.Background()
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	client, _ := NewClient(registry.URL)
+
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "model.bin"), []byte("weights"), 0o644)
+	os.WriteFile(filepath.Join(src, "README.md"), []byte("# model"), 0o644)
+	artifact, err := client.PushArtifact(ctx, "ml/model", "v1", "application/vnd.example.model", []ArtifactFile{
+		{Path: filepath.Join(src, "model.bin"), MediaType: "application/vnd.example.weights"},
+		{Path: filepath.Join(src, "README.md"), MediaType: "text/markdown", Title: "docs/README.md"},
+	}, WithArtifactAnnotations(map[string]string{"org.opencontainers.image.version": "1"}))
+	if err != nil {
+		t.Fatalf("Errors pushing artifact: %s", err)
+	}
+
+	m, ok := registry.Manifest("ml/model", "v1")
+	if !ok || DigestFromBytes(m.Content) != artifact.Descriptor.Digest {
+		t.Fatalf("Expected manifest to be tagged v1")
+	}
+	var stored Artifact
+	json.Unmarshal(m.Content, &stored)
+	if stored.ArtifactType != "application/vnd.example.model" || stored.Config.Digest != EmptyConfig.Digest ||
+		len(stored.Layers) != 2 || stored.Layers[0].MediaType != "application/vnd.example.weights" ||
+		stored.Layers[0].Annotations[AnnotationTitle] != "model.bin" ||
+		stored.Layers[1].Annotations[AnnotationTitle] != "docs/README.md" ||
+		stored.Annotations["org.opencontainers.image.version"] != "1" {
+		t.Fatalf("Unexpected manifest: %s", m.Content)
+	}
+	if config, ok := registry.Blob("ml/model", EmptyConfig.Digest); !ok || string(config) != "{}" {
+		t.Fatalf("Expected empty config to be pushed")
+	}
+
+	dst := t.TempDir()
+	pulled, err := client.PullArtifact(ctx, "ml/model", "v1", dst)
+	if err != nil {
+		t.Fatalf("Errors pulling artifact: %s", err)
+	}
+	if pulled.Descriptor.Digest != artifact.Descriptor.Digest || pulled.Type() != "application/vnd.example.model" {
+		t.Fatalf("Unexpected artifact pulled: %+v", pulled)
+	}
+	for path, content := range map[string]string{"model.bin": "weights", "docs/README.md": "# model"} {
+		b, err := os.ReadFile(filepath.Join(dst, path))
+		if err != nil || string(b) != content {
+			t.Fatalf("Expected %s to be pulled with %q but got %q: %v", path, content, b, err)
+		}
+	}
+
+	if _, err := client.PushArtifact(ctx, "ml/model", "v2", "", nil); err == nil {
+		t.Fatalf("Expected artifact with the empty config and no type to be rejected")
+	}
+	if _, err := client.PushArtifact(ctx, "ml/model", "v2", "application/vnd.example.model",
+		[]ArtifactFile{{Path: src}}); err == nil {
+		t.Fatalf("Expected directory to be rejected")
+	}
+}
+
+func TestPushArtifactWithoutFiles(t *testing.T) {
+	ctx := context.Background()
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	client, _ := NewClient(registry.URL)
+
+	for i, opts := range [][]artifactOption{nil, {WithArtifactConfig("application/vnd.example.config+json", []byte(`{"a":1}`))}} {
+		name := fmt.Sprintf("ml/empty%d", i)
+		artifact, err := client.PushArtifact(ctx, name, "v1", "application/vnd.example.empty", nil, opts...)
+		if err != nil {
+			t.Fatalf("Errors pushing artifact: %s", err)
+		}
+		if len(artifact.Layers) != 1 || artifact.Layers[0].Digest != EmptyConfig.Digest || artifact.Layers[0].MediaType != MediaTypeEmptyJSON {
+			t.Fatalf("Expected the empty descriptor as the only layer but got %+v", artifact.Layers)
+		}
+		if layer, ok := registry.Blob(name, EmptyConfig.Digest); !ok || string(layer) != "{}" {
+			t.Fatalf("Expected empty layer to be pushed")
+		}
+		if _, err := client.PullArtifact(ctx, name, "v1", t.TempDir()); err != nil {
+			t.Fatalf("Errors pulling artifact: %s", err)
+		}
+	}
+}
+
+func TestPullArtifactRejectsTraversal(t *testing.T) {
+	ctx := context.Background()
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	client, _ := NewClient(registry.URL)
+	digest := registry.PutBlob("ml/model", []byte("evil"))
+
+	for _, title := range []string{"../evil", "/etc/evil", "a/../../evil", ""} {
+		manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","artifactType":"application/vnd.example","config":{"mediaType":"%s","digest":"%s","size":2},`+
+			`"layers":[{"mediaType":"%s","digest":"%s","size":4,"annotations":{"%s":"%s"}}]}`,
+			MediaTypeImageManifest, MediaTypeEmptyJSON, EmptyConfig.Digest, MediaTypeArtifactFile, digest, AnnotationTitle, title)
+		registry.PutManifest("ml/model", "evil", MediaTypeImageManifest, []byte(manifest))
+
+		parent := t.TempDir()
+		dst := filepath.Join(parent, "out")
+		if _, err := client.PullArtifact(ctx, "ml/model", "evil", dst); err == nil {
+			t.Fatalf("Expected title %q to be rejected", title)
+		}
+		if _, err := os.Stat(filepath.Join(parent, "evil")); err == nil {
+			t.Fatalf("Expected nothing to be written outside the directory for title %q", title)
+		}
+	}
+}
@@ -1,13 +1,20 @@
 package reggie
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -24,15 +31,42 @@ type (
 	authInfo struct {
 		Token       string `json:"token"`
 		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
 	}
+
+	// tokenCache holds the tokens fetched by a client, keyed by realm,
+	// service and scope.
+	tokenCache struct {
+		mu     sync.Mutex
+		tokens map[string]cachedToken
+	}
+
+	cachedToken struct {
+		token   string
+		expires time.Time
+	}
+)
+
+const (
+	// DefaultTokenExpiry is how long a token is cached for when the
+	// authorization service does not say when it expires.
+	DefaultTokenExpiry = 60 * time.Second
 )
 
-func (client *Client) retryRequestWithAuth(originalRequest *Request, originalResponse *Response) (*Response, error) {
+func (client *Client) retryRequestWithAuth(originalRequest *Request, originalResponse *Response) (resp *Response, err error) {
 	authHeaderRaw := originalResponse.Header().Get("Www-Authenticate")
 	if authHeaderRaw == "" {
 		return originalResponse, nil
 	}
 
+	ctx, span := client.tracer.Start(originalRequest.Request.Context(), "reggie.auth")
+	defer func() {
+		if resp != nil {
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode()))
+		}
+		endSpan(span, err)
+	}()
+
 	for k, _ := range originalRequest.QueryParam {
 		originalRequest.QueryParam.Del(k)
 	}
@@ -44,46 +78,162 @@ func (client *Client) retryRequestWithAuth(originalRequest *Request, originalRes
 		}
 	}
 
+	username, password := client.credentials(originalRequest)
 	authenticationType := authHeaderMatcher.ReplaceAllString(authHeaderRaw, "$1")
+	scheme := strings.ToLower(authenticationType)
+	span.SetAttributes(attribute.String("reggie.auth.scheme", scheme))
 	if strings.EqualFold(authenticationType, "bearer") {
+		client.metrics.AuthRetried(scheme)
 		h := parseAuthHeader(authHeaderRaw)
-		req := client.Client.NewRequest().
-			SetQueryParam("service", h.Service).
-			SetHeader("Accept", "application/json").
-			SetHeader("User-Agent", client.Config.UserAgent).
-			SetBasicAuth(client.Config.Username, client.Config.Password)
+		scope := h.Scope
 		if s := client.Config.AuthScope; s != "" {
-			req.SetQueryParam("scope", s)
-		} else if h.Scope != "" {
-			req.SetQueryParam("scope", h.Scope)
+			scope = s
 		}
 
-		authResp, err := req.Execute(GET, h.Realm)
-		if err != nil {
-			return nil, err
+		// a cached token may have been revoked, in which case a new one is
+		// requested before giving up
+		key := strings.Join([]string{h.Realm, h.Service, scope, username}, "|")
+		token, ok := client.tokens.get(key)
+		client.metrics.TokenCacheLookup(ok)
+		if ok {
+			originalRequest.SetAuthToken(token)
+			originalRequest.attempts++
+			resp, err := client.execute(originalRequest)
+			if err != nil || !resp.IsUnauthorized() {
+				return resp, err
+			}
+			if body := resp.RawBody(); body != nil {
+				body.Close()
+			}
+			client.tokens.delete(key)
+			if originalRequest.retryCallback != nil {
+				if err := originalRequest.retryCallback(originalRequest); err != nil {
+					return nil, fmt.Errorf("retry callback returned error: %s", err)
+				}
+			}
 		}
 
-		var info authInfo
-		bodyBytes := authResp.Body()
-		err = json.Unmarshal(bodyBytes, &info)
+		token, expiresIn, err := client.fetchToken(ctx, h, scope, username, password)
 		if err != nil {
 			return nil, err
 		}
-
-		token := info.Token
-		if token == "" {
-			token = info.AccessToken
-		}
+		client.tokens.set(key, token, expiresIn)
 		originalRequest.SetAuthToken(token)
-		return originalRequest.Execute(originalRequest.Method, originalRequest.URL)
+		originalRequest.attempts++
+		return client.execute(originalRequest)
 	} else if strings.EqualFold(authenticationType, "basic") {
-		originalRequest.SetBasicAuth(client.Config.Username, client.Config.Password)
-		return originalRequest.Execute(originalRequest.Method, originalRequest.URL)
+		client.metrics.AuthRetried(scheme)
+		originalRequest.SetBasicAuth(username, password)
+		originalRequest.attempts++
+		return client.execute(originalRequest)
 	}
 
 	return nil, errors.New("something went wrong with authorization")
 }
 
+// credentials returns the username and password answering the auth
+// challenges of a request: those of the mirror it is sent to, if any, or
+// else the client's.
+func (client *Client) credentials(req *Request) (string, string) {
+	if req.mirror != nil {
+		return req.mirror.Username, req.mirror.Password
+	}
+	return client.Config.Username, client.Config.Password
+}
+
+// fetchToken requests a token for scope from the authorization service
+// described by h, returning the token and how long it is valid for.
+// Credentials are only sent if a username or password is given.
+func (client *Client) fetchToken(ctx context.Context, h *authHeader, scope string, username string, password string) (string, time.Duration, error) {
+	ctx, span := client.tracer.Start(ctx, "reggie.token", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("url.full", RedactURL(h.Realm)),
+			attrAuthScope.String(scope)))
+
+	req := client.Client.NewRequest().
+		SetContext(ctx).
+		SetQueryParam("service", h.Service).
+		SetHeader("Accept", "application/json").
+		SetHeader("User-Agent", client.Config.UserAgent)
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+	if scope != "" {
+		req.SetQueryParam("scope", scope)
+	}
+	client.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	resp, err := req.Execute(GET, h.Realm)
+	duration := time.Since(start)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 400 {
+			span.SetStatus(codes.Error, resp.Status())
+		}
+	}
+	client.logTokenRequest(ctx, h.Realm, scope, status, err, duration)
+	client.metrics.RequestCompleted(GET, EndpointToken, statusLabel(status, err), duration)
+	endSpan(span, err)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var info authInfo
+	err = json.Unmarshal(resp.Body(), &info)
+	if err != nil {
+		return "", 0, err
+	}
+
+	token := info.Token
+	if token == "" {
+		token = info.AccessToken
+	}
+	expiresIn := DefaultTokenExpiry
+	if info.ExpiresIn > 0 {
+		expiresIn = time.Duration(info.ExpiresIn) * time.Second
+	}
+	return token, expiresIn, nil
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{tokens: map[string]cachedToken{}}
+}
+
+// get returns the token cached under key, if it has not expired.
+func (c *tokenCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tokens[key]
+	if !ok || time.Now().After(t.expires) {
+		delete(c.tokens, key)
+		return "", false
+	}
+	return t.token, true
+}
+
+// set caches a token under key, expiring shortly before the authorization
+// service says it does.
+func (c *tokenCache) set(key string, token string, expiresIn time.Duration) {
+	if token == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[key] = cachedToken{
+		token:   token,
+		expires: time.Now().Add(expiresIn - expiresIn/10),
+	}
+}
+
+func (c *tokenCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tokens, key)
+}
+
 func parseAuthHeader(authHeaderRaw string) *authHeader {
 	re := regexp.MustCompile(`([a-zA-z]+)="(.+?)"`)
 	matches := re.FindAllStringSubmatch(authHeaderRaw, -1)
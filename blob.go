@@ -0,0 +1,423 @@
+package reggie
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type (
+	// BlobOpener returns a fresh reader over the content of a blob. It may be
+	// called more than once if an upload needs to be retried.
+	BlobOpener func() (io.ReadCloser, error)
+
+	blobConfig struct {
+		ChunkSize        int
+		MountFrom        string
+		Progress         ProgressFunc
+		ProgressInterval time.Duration
+
+		progress *progressReporter
+	}
+
+	blobOption func(c *blobConfig)
+)
+
+func newBlobConfig(desc Descriptor, opts []blobOption) *blobConfig {
+	conf := &blobConfig{}
+	for _, o := range opts {
+		o(conf)
+	}
+	if conf.Progress != nil {
+		conf.progress = newProgressReporter(conf.Progress, conf.ProgressInterval, desc)
+	}
+	return conf
+}
+
+// WithProgress sets a callback receiving progress events for a blob transfer.
+func WithProgress(fn ProgressFunc) blobOption {
+	return func(c *blobConfig) {
+		c.Progress = fn
+	}
+}
+
+// WithProgressChannel sends progress events for a blob transfer to ch. Sends
+// block, so the channel must be drained while the transfer runs.
+func WithProgressChannel(ch chan<- ProgressEvent) blobOption {
+	return func(c *blobConfig) {
+		c.Progress = func(e ProgressEvent) {
+			ch <- e
+		}
+	}
+}
+
+// WithProgressInterval sets the minimum time between two events reporting
+// bytes transferred. Defaults to DefaultProgressInterval.
+func WithProgressInterval(interval time.Duration) blobOption {
+	return func(c *blobConfig) {
+		c.ProgressInterval = interval
+	}
+}
+
+// WithChunkSize uploads a blob in chunks of the given size rather than in a
+// single request.
+func WithChunkSize(size int) blobOption {
+	return func(c *blobConfig) {
+		c.ChunkSize = size
+	}
+}
+
+// WithMountFrom attempts to mount a blob from another repository on the same
+// registry before uploading it.
+func WithMountFrom(name string) blobOption {
+	return func(c *blobConfig) {
+		c.MountFrom = name
+	}
+}
+
+// BlobExists returns whether a blob with the given digest exists in the
+// repository.
+func (client *Client) BlobExists(ctx context.Context, name string, digest string) (exists bool, err error) {
+	ctx, span := client.startOperation(ctx, "BlobExists", name, digest, 0)
+	defer func() { endSpan(span, err) }()
+	req := client.NewRequest(HEAD, "/v2/<name>/blobs/<digest>",
+		WithName(name), WithDigest(digest)).SetContext(ctx)
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	switch resp.StatusCode() {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, newResponseError(resp)
+}
+
+// PushBlob uploads a blob to the repository unless it already exists. The
+// upload is scheduled by the client's TransferManager, so concurrent pushes
+// of the same blob to the same repository only upload it once.
+func (client *Client) PushBlob(ctx context.Context, name string, desc Descriptor, open BlobOpener, opts ...blobOption) (err error) {
+	if err := validateDigest(desc.Digest); err != nil {
+		return err
+	}
+	ctx, span := client.startOperation(ctx, "PushBlob", name, desc.Digest, desc.Size)
+	defer func() { endSpan(span, err) }()
+	conf := newBlobConfig(desc, opts)
+	key := fmt.Sprintf("push:%s/%s@%s", client.host(), client.repository(name), desc.Digest)
+	ran := false
+	err = client.transfers.Do(ctx, client.host(), key, func(ctx context.Context) error {
+		ran = true
+		conf.progress.emit(ProgressStarted)
+		exists, err := client.BlobExists(ctx, name, desc.Digest)
+		if err != nil {
+			return err
+		}
+		span.SetAttributes(attrSkipped.Bool(exists))
+		if exists {
+			conf.progress.emit(ProgressSkippedExists)
+		} else if err := client.uploadBlob(ctx, name, desc, open, conf); err != nil {
+			return err
+		}
+		conf.progress.emit(ProgressCompleted)
+		return nil
+	})
+	if err == nil && !ran {
+		conf.progress.emit(ProgressCompleted)
+	}
+	return err
+}
+
+// uploadBlob opens an upload session, attempting a cross-repository mount
+// if configured, and uploads the content if the blob was not mounted.
+func (client *Client) uploadBlob(ctx context.Context, name string, desc Descriptor, open BlobOpener, conf *blobConfig) error {
+	// strategies a probed registry does not support are not attempted
+	mountFrom := conf.MountFrom
+	if !client.allows(func(caps *Capabilities) bool { return caps.Mounts }) {
+		mountFrom = ""
+	}
+	chunked := conf.ChunkSize > 0 && client.allows(func(caps *Capabilities) bool { return caps.ChunkedUploads })
+
+	req := client.NewRequest(POST, "/v2/<name>/blobs/uploads/", WithName(name)).SetContext(ctx)
+	if mountFrom != "" {
+		req.SetQueryParam("mount", desc.Digest).SetQueryParam("from", mountFrom)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode() {
+	case http.StatusCreated:
+		if mountFrom != "" {
+			conf.progress.emit(ProgressMounted)
+			return nil
+		}
+	case http.StatusAccepted:
+		if chunked {
+			return client.uploadChunked(ctx, resp, desc, open, conf)
+		}
+		return client.uploadMonolithic(ctx, resp, desc, open, conf)
+	}
+	return newResponseError(resp)
+}
+
+// uploadMonolithic completes an upload session with a single PUT carrying
+// the full content.
+func (client *Client) uploadMonolithic(ctx context.Context, session *Response, desc Descriptor, open BlobOpener, conf *blobConfig) error {
+	var body io.ReadCloser
+	defer func() {
+		if body != nil {
+			body.Close()
+		}
+	}()
+	attempt := 0
+	setBody := func(r *Request) error {
+		if body != nil {
+			body.Close()
+		}
+		attempt++
+		if attempt > 1 {
+			conf.progress.reset()
+			conf.progress.emit(ProgressRetried)
+		}
+		var err error
+		body, err = open()
+		if err != nil {
+			return err
+		}
+		if desc.Size == 0 {
+			r.SetBody([]byte{})
+		} else {
+			r.SetBody(conf.progress.reader(body))
+		}
+		return nil
+	}
+
+	req := client.newLocationRequest(PUT, session, WithRetryCallback(setBody)).
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/octet-stream").
+		SetHeader("Content-Length", strconv.FormatInt(desc.Size, 10)).
+		SetQueryParam("digest", desc.Digest)
+	if err := setBody(req); err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != http.StatusCreated {
+		return newResponseError(resp)
+	}
+	conf.progress.flush()
+	return nil
+}
+
+// uploadChunked sends the content in chunks of the configured size with
+// PATCH requests, then closes the session with a PUT.
+func (client *Client) uploadChunked(ctx context.Context, session *Response, desc Descriptor, open BlobOpener, conf *blobConfig) error {
+	body, err := open()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	resp := session
+	buf := make([]byte, conf.ChunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(body, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		chunk := buf[:n]
+		req := client.newLocationRequest(PATCH, resp).
+			SetContext(ctx).
+			SetHeader("Content-Type", "application/octet-stream").
+			SetHeader("Content-Length", strconv.Itoa(n)).
+			SetHeader("Content-Range", fmt.Sprintf("%d-%d", offset, offset+int64(n)-1)).
+			SetBody(chunk)
+		resp, err = client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode() != http.StatusAccepted {
+			return newResponseError(resp)
+		}
+		offset += int64(n)
+		conf.progress.add(n)
+		conf.progress.emit(ProgressChunkCommitted)
+		if n < len(buf) {
+			break
+		}
+	}
+	if offset != desc.Size {
+		return fmt.Errorf("size mismatch for %s: expected %d bytes, read %d", desc.Digest, desc.Size, offset)
+	}
+
+	req := client.newLocationRequest(PUT, resp).
+		SetContext(ctx).
+		SetHeader("Content-Length", "0").
+		SetQueryParam("digest", desc.Digest)
+	resp, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != http.StatusCreated {
+		return newResponseError(resp)
+	}
+	conf.progress.flush()
+	return nil
+}
+
+// PullBlob downloads a blob from the repository into w, verifying its digest
+// and size. The download is subject to the limits of the client's
+// TransferManager.
+func (client *Client) PullBlob(ctx context.Context, name string, desc Descriptor, w io.Writer, opts ...blobOption) (err error) {
+	if err := validateDigest(desc.Digest); err != nil {
+		return err
+	}
+	ctx, span := client.startOperation(ctx, "PullBlob", name, desc.Digest, desc.Size)
+	defer func() { endSpan(span, err) }()
+	conf := newBlobConfig(desc, opts)
+	return client.transfers.Do(ctx, client.host(), "", func(ctx context.Context) error {
+		if err := client.downloadBlob(ctx, name, desc, w, conf); err != nil {
+			return err
+		}
+		conf.progress.emit(ProgressCompleted)
+		return nil
+	})
+}
+
+// PullBlobToFile downloads a blob from the repository into the file at path,
+// skipping the download if the file already holds the expected content.
+// Concurrent pulls to the same path share a single download.
+func (client *Client) PullBlobToFile(ctx context.Context, name string, desc Descriptor, path string, opts ...blobOption) (err error) {
+	if err := validateDigest(desc.Digest); err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	ctx, span := client.startOperation(ctx, "PullBlobToFile", name, desc.Digest, desc.Size)
+	defer func() { endSpan(span, err) }()
+	conf := newBlobConfig(desc, opts)
+	ran := false
+	err = client.transfers.Do(ctx, client.host(), "pull:"+abs, func(ctx context.Context) error {
+		ran = true
+		if fileMatches(abs, desc) {
+			span.SetAttributes(attrSkipped.Bool(true))
+			conf.progress.emit(ProgressSkippedExists)
+			conf.progress.emit(ProgressCompleted)
+			return nil
+		}
+		tmp, err := os.CreateTemp(filepath.Dir(abs), ".reggie-"+filepath.Base(abs)+"-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		if err := client.downloadBlob(ctx, name, desc, tmp, conf); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), abs); err != nil {
+			return err
+		}
+		conf.progress.emit(ProgressCompleted)
+		return nil
+	})
+	if err == nil && !ran {
+		conf.progress.emit(ProgressCompleted)
+	}
+	return err
+}
+
+func (client *Client) downloadBlob(ctx context.Context, name string, desc Descriptor, w io.Writer, conf *blobConfig) error {
+	conf.progress.emit(ProgressStarted)
+	req := client.NewRequest(GET, "/v2/<name>/blobs/<digest>",
+		WithName(name), WithDigest(desc.Digest)).SetContext(ctx)
+	req.SetDoNotParseResponse(true)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	body := resp.RawBody()
+	defer body.Close()
+	if resp.StatusCode() != http.StatusOK {
+		return newResponseError(resp)
+	}
+
+	verifier, err := newDigestVerifier(desc.Digest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.MultiWriter(conf.progress.writer(w), verifier), body); err != nil {
+		return err
+	}
+	conf.progress.flush()
+	if err := verifier.verify(desc.Size); err != nil {
+		return err
+	}
+	conf.progress.emit(ProgressVerified)
+	return nil
+}
+
+// newLocationRequest builds a request against the Location header of a
+// response, which may point to a different host than the registry.
+func (client *Client) newLocationRequest(method string, resp *Response, opts ...requestOption) *Request {
+	loc := resp.GetAbsoluteLocation()
+	if u, err := url.Parse(loc); err == nil && u.IsAbs() {
+		req := client.NewRequest(method, "", opts...)
+		req.URL = loc
+		return req
+	}
+	return client.NewRequest(method, resp.GetRelativeLocation(), opts...)
+}
+
+// host returns the host portion of the client's registry address.
+func (client *Client) host() string {
+	u, err := url.Parse(client.Config.Address)
+	if err != nil {
+		return client.Config.Address
+	}
+	return u.Host
+}
+
+// repository returns the repository a request for name would target.
+func (client *Client) repository(name string) string {
+	if name != "" {
+		return name
+	}
+	return client.Config.DefaultName
+}
+
+// fileMatches returns whether the file at path exists with the content
+// described by desc.
+func fileMatches(path string, desc Descriptor) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	verifier, err := newDigestVerifier(desc.Digest)
+	if err != nil {
+		return false
+	}
+	if _, err := io.Copy(verifier, f); err != nil {
+		return false
+	}
+	return verifier.verify(desc.Size) == nil
+}
@@ -0,0 +1,316 @@
+package reggie
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bloodorangeio/reggie/reggietest"
+)
+
+// newBlobTestServer returns a minimal registry serving blob uploads and
+// downloads from memory, counting the upload sessions it opens.
+func newBlobTestServer(t *testing.T, sessions *int32) *httptest.Server {
+	var mu sync.Mutex
+	blobs := map[string][]byte{}
+	uploads := map[string][]byte{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repo := strings.TrimPrefix(r.URL.Path[:strings.Index(r.URL.Path, "/blobs/")], "/v2/")
+		switch {
+		case r.Method == POST && strings.HasSuffix(r.URL.Path, "/blobs/uploads/"):
+			if mount := r.URL.Query().Get("mount"); mount != "" {
+				mu.Lock()
+				blob, ok := blobs[r.URL.Query().Get("from")+"@"+mount]
+				if ok {
+					blobs[repo+"@"+mount] = blob
+				}
+				mu.Unlock()
+				if ok {
+					w.WriteHeader(http.StatusCreated)
+					return
+				}
+			}
+			n := atomic.AddInt32(sessions, 1)
+			w.Header().Set("Location", fmt.Sprintf("%s%d", r.URL.Path, n))
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == PATCH && strings.Contains(r.URL.Path, "/blobs/uploads/"):
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			start := len(uploads[r.URL.Path])
+			if r.Header.Get("Content-Range") != fmt.Sprintf("%d-%d", start, start+len(body)-1) {
+				mu.Unlock()
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			uploads[r.URL.Path] = append(uploads[r.URL.Path], body...)
+			mu.Unlock()
+			w.Header().Set("Location", r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == PUT && strings.Contains(r.URL.Path, "/blobs/uploads/"):
+			time.Sleep(10 * time.Millisecond)
+			body, _ := io.ReadAll(r.Body)
+			if r.ContentLength != int64(len(body)) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			body = append(uploads[r.URL.Path], body...)
+			digest := r.URL.Query().Get("digest")
+			if DigestFromBytes(body) != digest {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors":[{"code":"DIGEST_INVALID","message":"digest invalid"}]}`))
+				return
+			}
+			blobs[repo+"@"+digest] = body
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == HEAD || r.Method == GET:
+			digest := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+			mu.Lock()
+			blob, ok := blobs[repo+"@"+digest]
+			mu.Unlock()
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(blob)))
+			if r.Method == GET {
+				w.Write(blob)
+			}
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func bytesOpener(b []byte) BlobOpener {
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+}
+
+func TestPushAndPullBlob(t *testing.T) {
+	var sessions int32
+	server := newBlobTestServer(t, &sessions)
+	defer server.Close()
+
+	client, err := NewClient(server.URL, WithDefaultName("testname"), WithMaxConcurrentTransfers(2))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	content := []byte("a shared base layer")
+	desc := Descriptor{Digest: DigestFromBytes(content), Size: int64(len(content))}
+
+	// concurrent pushes of the same blob should upload it once
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.PushBlob(context.Background(), "", desc, bytesOpener(content)); err != nil {
+				t.Errorf("Errors pushing blob: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&sessions); n != 1 {
+		t.Fatalf("Expected 1 upload session but got %d", n)
+	}
+
+	// pushing again should be skipped since the blob exists
+	if err := client.PushBlob(context.Background(), "", desc, bytesOpener(content)); err != nil {
+		t.Fatalf("Errors pushing blob: %s", err)
+	}
+	if n := atomic.LoadInt32(&sessions); n != 1 {
+		t.Fatalf("Expected existing blob to be skipped but got %d sessions", n)
+	}
+
+	var buf bytes.Buffer
+	if err := client.PullBlob(context.Background(), "", desc, &buf); err != nil {
+		t.Fatalf("Errors pulling blob: %s", err)
+	}
+	if buf.String() != string(content) {
+		t.Fatalf("Expected blob content %q but got %q", content, buf.String())
+	}
+
+	path := filepath.Join(t.TempDir(), "blob")
+	if err := client.PullBlobToFile(context.Background(), "", desc, path); err != nil {
+		t.Fatalf("Errors pulling blob to file: %s", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != string(content) {
+		t.Fatalf("Expected file content %q but got %q", content, b)
+	}
+
+	// a descriptor that does not match the content should fail verification
+	bad := Descriptor{Digest: desc.Digest, Size: desc.Size + 1}
+	if err := client.PullBlob(context.Background(), "", bad, io.Discard); err == nil {
+		t.Fatalf("Expected size mismatch error")
+	}
+
+	// a body that does not match the digest should be rejected by the registry
+	wrong := Descriptor{Digest: DigestFromBytes([]byte("other")), Size: int64(len(content))}
+	err = client.PushBlob(context.Background(), "", wrong, bytesOpener(content))
+	respErr, ok := err.(*ResponseError)
+	if !ok {
+		t.Fatalf("Expected ResponseError but got %v", err)
+	}
+	if !respErr.HasCode("DIGEST_INVALID") {
+		t.Fatalf("Expected DIGEST_INVALID error but got %s", respErr)
+	}
+
+	if err := client.PushBlob(context.Background(), "", Descriptor{Digest: "nope"}, bytesOpener(nil)); err == nil {
+		t.Fatalf("Expected invalid digest error")
+	}
+}
+
+func TestBlobProgress(t *testing.T) {
+	var sessions int32
+	server := newBlobTestServer(t, &sessions)
+	defer server.Close()
+
+	client, err := NewClient(server.URL, WithDefaultName("testname"))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	content := []byte("0123456789abcdefghij")
+	desc := Descriptor{Digest: DigestFromBytes(content), Size: int64(len(content))}
+
+	var events []ProgressEvent
+	record := WithProgress(func(e ProgressEvent) {
+		events = append(events, e)
+	})
+	types := func() string {
+		var ts []string
+		for _, e := range events {
+			if e.Type != ProgressTransferred {
+				ts = append(ts, string(e.Type))
+			}
+		}
+		events = nil
+		return strings.Join(ts, ",")
+	}
+
+	// chunked upload commits each chunk
+	err = client.PushBlob(context.Background(), "", desc, bytesOpener(content), record, WithChunkSize(8))
+	if err != nil {
+		t.Fatalf("Errors pushing blob: %s", err)
+	}
+	if last := events[len(events)-2]; last.Type != ProgressTransferred || last.Transferred != desc.Size {
+		t.Fatalf("Expected final transferred event with %d bytes but got %+v", desc.Size, last)
+	}
+	if ts := types(); ts != "started,chunk-committed,chunk-committed,chunk-committed,completed" {
+		t.Fatalf("Unexpected chunked upload events: %s", ts)
+	}
+
+	err = client.PushBlob(context.Background(), "", desc, bytesOpener(content), record)
+	if err != nil {
+		t.Fatalf("Errors pushing blob: %s", err)
+	}
+	if ts := types(); ts != "started,skipped-exists,completed" {
+		t.Fatalf("Unexpected existing blob events: %s", ts)
+	}
+
+	err = client.PushBlob(context.Background(), "othername", desc, bytesOpener(content), record,
+		WithMountFrom("testname"))
+	if err != nil {
+		t.Fatalf("Errors pushing blob: %s", err)
+	}
+	if ts := types(); ts != "started,mounted,completed" {
+		t.Fatalf("Unexpected mount events: %s", ts)
+	}
+
+	ch := make(chan ProgressEvent, 100)
+	err = client.PullBlob(context.Background(), "", desc, io.Discard, WithProgressChannel(ch))
+	if err != nil {
+		t.Fatalf("Errors pulling blob: %s", err)
+	}
+	close(ch)
+	for e := range ch {
+		if e.Digest != desc.Digest || e.Total != desc.Size {
+			t.Fatalf("Event does not describe the blob: %+v", e)
+		}
+		events = append(events, e)
+	}
+	if ts := types(); ts != "started,verified,completed" {
+		t.Fatalf("Unexpected download events: %s", ts)
+	}
+}
+
+func TestProgressReporterThrottles(t *testing.T) {
+	var n int
+	p := newProgressReporter(func(ProgressEvent) { n++ }, time.Hour, Descriptor{Size: 100})
+	for i := 0; i < 100; i++ {
+		p.add(1)
+	}
+	if n != 1 {
+		t.Fatalf("Expected 1 throttled event but got %d", n)
+	}
+	p.flush()
+	if n != 2 {
+		t.Fatalf("Expected flush to emit an event")
+	}
+}
+
+func TestConcurrentPushWithTokenAuth(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithTokenAuth("user", "pass"))
+	defer registry.Close()
+
+	client, err := NewClient(registry.URL, WithUsernamePassword("user", "pass"))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	content := []byte("pushed once")
+	desc := Descriptor{Digest: DigestFromBytes(content), Size: int64(len(content))}
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- client.PushBlob(context.Background(), "a", desc, bytesOpener(content), WithChunkSize(4))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Errors pushing blob: %s", err)
+		}
+	}
+	if n := registry.Uploads(); n != 1 {
+		t.Fatalf("Expected 1 upload session but got %d", n)
+	}
+	if stored, _ := registry.Blob("a", desc.Digest); !bytes.Equal(stored, content) {
+		t.Fatalf("Expected registry to store %q but got %q", content, stored)
+	}
+}
+
+func TestDescriptorVerify(t *testing.T) {
+	content := []byte("verified")
+	sum := sha512.Sum512(content)
+	for _, digest := range []string{DigestFromBytes(content), "sha512:" + hex.EncodeToString(sum[:])} {
+		desc := Descriptor{Digest: digest, Size: int64(len(content))}
+		if err := desc.Verify(content); err != nil {
+			t.Fatalf("Errors verifying %s: %s", digest, err)
+		}
+		if err := desc.Verify([]byte("tampered")); err == nil {
+			t.Fatalf("Expected tampered content to fail verification with %s", digest)
+		}
+	}
+}
@@ -2,15 +2,19 @@ package reggie
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	"net"
+	"log/slog"
 	"net/http"
-	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -22,6 +26,28 @@ type (
 	Client struct {
 		*resty.Client
 		Config *clientConfig
+
+		transfers    *TransferManager
+		mirrors      []*mirrorEndpoint
+		mirrorHealth *endpointHealth
+		logger       *slog.Logger
+		tracer       trace.Tracer
+		propagator   propagation.TextMapPropagator
+		metrics      Metrics
+		tokens       *tokenCache
+
+		capsMu       sync.Mutex
+		capabilities *Capabilities
+
+		extMu      sync.Mutex
+		extensions map[string]ExtensionEndpoint
+
+		paramMu      sync.Mutex
+		placeholders map[string]ParamValidator
+
+		beforeRequest   []BeforeRequestFunc
+		afterResponse   []AfterResponseFunc
+		preRequestHooks []resty.PreRequestHook
 	}
 
 	clientConfig struct {
@@ -33,6 +59,46 @@ type (
 		DefaultName           string
 		UserAgent             string
 		InsecureSkipTLSVerify bool
+
+		MaxConcurrentTransfers        int
+		MaxConcurrentTransfersPerHost int
+		TransferManager               *TransferManager
+
+		RateLimiter      *Limiter
+		BandwidthLimiter *Limiter
+
+		RootCAs                *x509.CertPool
+		RootCAFiles            []string
+		ClientCertificates     []tls.Certificate
+		ClientCertificateFiles []keyPairFiles
+		MinTLSVersion          uint16
+		CertsDirs              []string
+
+		DialTimeout           time.Duration
+		TLSHandshakeTimeout   time.Duration
+		IdleConnTimeout       time.Duration
+		ResponseHeaderTimeout time.Duration
+		Proxy                 *string
+		HTTP2                 *bool
+		UnixSocket            string
+		Transport             http.RoundTripper
+		TransportWrappers     []TransportWrapper
+
+		Mirrors        []Mirror
+		MirrorCooldown time.Duration
+
+		Logger        *slog.Logger
+		LogLevel      *slog.Level
+		ErrorLogLevel *slog.Level
+		LogHeaders    bool
+
+		TracerProvider trace.TracerProvider
+		Propagator     propagation.TextMapPropagator
+
+		Metrics Metrics
+
+		ExtensionEndpoints []ExtensionEndpoint
+		Placeholders       map[string]ParamValidator
 	}
 
 	clientOption func(c *clientConfig)
@@ -78,9 +144,40 @@ func NewClient(address string, opts ...clientOption) (*Client, error) {
 	client := Client{}
 	client.Client = resty.New()
 	client.Config = conf
-	client.Debug = conf.Debug
+	client.logger = conf.logger()
+	client.SetLogger(restyLogger{client.logger})
+	client.OnRequestLog(redactRequestLog)
+	client.OnResponseLog(redactResponseLog)
+	client.tracer = conf.tracer()
+	client.propagator = conf.propagator()
+	client.metrics = conf.metrics()
+	client.tokens = newTokenCache()
 	client.SetRedirectPolicy(resty.FlexibleRedirectPolicy(20))
-	client.SetTransport(createTransport(conf.InsecureSkipTLSVerify))
+	transport, err := createTransport(conf)
+	if err != nil {
+		return nil, err
+	}
+	client.SetTransport(transport)
+
+	client.mirrors, err = parseMirrors(conf.Mirrors)
+	if err != nil {
+		return nil, err
+	}
+	client.mirrorHealth = newEndpointHealth(conf.MirrorCooldown)
+
+	for name, validate := range conf.Placeholders {
+		client.RegisterPlaceholder(name, validate)
+	}
+	for _, ep := range append(builtinExtensionEndpoints, conf.ExtensionEndpoints...) {
+		if err := client.RegisterExtensionEndpoint(ep); err != nil {
+			return nil, err
+		}
+	}
+
+	client.transfers = conf.TransferManager
+	if client.transfers == nil {
+		client.transfers = NewTransferManager(conf.MaxConcurrentTransfers, conf.MaxConcurrentTransfersPerHost)
+	}
 
 	// TODO: disable this
 	// See https://github.com/opencontainers/distribution-spec/issues/396
@@ -88,14 +185,22 @@ func NewClient(address string, opts ...clientOption) (*Client, error) {
 	// uses the "SetHeader" method, we intercept it and set the value on the
 	// context. If that context value is missing, delete it as it
 	// means Resty has automatically set the value for us (bad)
-	client.SetPreRequestHook(func(_ *resty.Client, req *http.Request) error {
+	client.Client.SetPreRequestHook(func(rc *resty.Client, req *http.Request) error {
 		acceptHeaderVal := req.Context().Value(contextKeyAcceptHeader)
 		if acceptHeaderVal != nil {
 			req.Header.Set("Accept", fmt.Sprintf("%s", acceptHeaderVal))
 		} else if req.Header.Get("Accept") != "" {
 			req.Header.Del("Accept")
 		}
-		return nil
+
+		// Streamed bodies are sent chunked unless the length is known, and
+		// net/http ignores a Content-Length set as a plain header
+		if req.Body != nil && req.ContentLength <= 0 {
+			if n, err := strconv.ParseInt(req.Header.Get("Content-Length"), 10, 64); err == nil && n > 0 {
+				req.ContentLength = n
+			}
+		}
+		return client.runPreRequestHooks(rc, req)
 	})
 
 	return &client, nil
@@ -123,7 +228,10 @@ func WithDefaultName(namespace string) clientOption {
 	}
 }
 
-// WithDebug enables or disables debug mode.
+// WithDebug enables or disables debug mode, which logs requests to stderr at
+// debug level unless a logger is configured.
+//
+// Deprecated: use WithLogger instead.
 func WithDebug(debug bool) clientOption {
 	return func(c *clientConfig) {
 		c.Debug = debug
@@ -144,6 +252,64 @@ func WithInsecureSkipTLSVerify(skip bool) clientOption {
 	}
 }
 
+// WithMaxConcurrentTransfers limits how many blob transfers the client runs at once.
+func WithMaxConcurrentTransfers(max int) clientOption {
+	return func(c *clientConfig) {
+		c.MaxConcurrentTransfers = max
+	}
+}
+
+// WithMaxConcurrentTransfersPerHost limits how many blob transfers the client runs
+// at once against a single registry host.
+func WithMaxConcurrentTransfersPerHost(max int) clientOption {
+	return func(c *clientConfig) {
+		c.MaxConcurrentTransfersPerHost = max
+	}
+}
+
+// WithTransferManager schedules the client's blob transfers using a shared
+// TransferManager, overriding any other transfer limits.
+func WithTransferManager(tm *TransferManager) clientOption {
+	return func(c *clientConfig) {
+		c.TransferManager = tm
+	}
+}
+
+// WithRateLimit limits the client to requestsPerSecond requests, allowing
+// bursts of up to burst requests. A rate of zero or less means unlimited.
+func WithRateLimit(requestsPerSecond float64, burst int) clientOption {
+	return WithRateLimiter(NewLimiter(requestsPerSecond, burst))
+}
+
+// WithRateLimiter limits the rate of requests using a Limiter which may be
+// shared with other clients.
+func WithRateLimiter(l *Limiter) clientOption {
+	return func(c *clientConfig) {
+		c.RateLimiter = l
+	}
+}
+
+// WithBandwidthLimit caps the combined rate of request and response bodies at
+// bytesPerSecond. A limit of zero or less means unlimited.
+func WithBandwidthLimit(bytesPerSecond int) clientOption {
+	burst := bytesPerSecond / 10
+	if burst < 32*1024 {
+		burst = 32 * 1024
+	}
+	if burst > bytesPerSecond {
+		burst = bytesPerSecond
+	}
+	return WithBandwidthLimiter(NewLimiter(float64(bytesPerSecond), burst))
+}
+
+// WithBandwidthLimiter caps the rate of request and response bodies, in bytes
+// per second, using a Limiter which may be shared with other clients.
+func WithBandwidthLimiter(l *Limiter) clientOption {
+	return func(c *clientConfig) {
+		c.BandwidthLimiter = l
+	}
+}
+
 // SetDefaultName sets the default registry namespace to use for building a Request.
 func (client *Client) SetDefaultName(namespace string) {
 	client.Config.DefaultName = namespace
@@ -163,20 +329,19 @@ func (client *Client) NewRequest(method string, path string, opts ...requestOpti
 		namespace = r.Name
 	}
 
-	replacements := map[string]string{
-		"<name>":       namespace,
-		"<reference>":  r.Reference,
-		"<digest>":     r.Digest,
-		"<session_id>": r.SessionID,
+	params := map[string]string{
+		"name":       namespace,
+		"reference":  r.Reference,
+		"digest":     r.Digest,
+		"session_id": r.SessionID,
 	}
-
-	// substitute known path params
-	for k, v := range replacements {
-		if v != "" {
-			path = strings.Replace(path, k, v, -1)
-		}
+	for k, v := range r.Params {
+		params[k] = v
 	}
 
+	// substitute path and query params
+	path, err := client.expandPlaceholders(path, params)
+
 	path = strings.TrimPrefix(path, "/")
 
 	url := fmt.Sprintf("%s/%s", client.Config.Address, path)
@@ -186,39 +351,46 @@ func (client *Client) NewRequest(method string, path string, opts ...requestOpti
 	return &Request{
 		Request:       restyRequest,
 		retryCallback: r.RetryCallback,
+		err:           err,
 	}
 }
 
-// Do executes a Request and returns a Response.
+// Transfers returns the TransferManager scheduling the client's blob transfers.
+func (client *Client) Transfers() *TransferManager {
+	return client.transfers
+}
+
+// Do executes a Request and returns a Response. Pull requests are attempted
+// against any configured mirrors first.
 func (client *Client) Do(req *Request) (*Response, error) {
-	resp, err := req.Execute(req.Method, req.URL)
+	span := client.startRequestSpan(req)
+	start := time.Now()
+	var resp *Response
+	var err error
+	if len(client.mirrors) > 0 && isPull(req) {
+		resp, err = client.doWithMirrors(req)
+	} else {
+		resp, err = client.do(req)
+	}
+	duration := time.Since(start)
+	client.logRequest(req, resp, err, duration)
+	client.recordRequest(req, resp, err, duration)
+	client.endRequestSpan(span, req, resp, err)
+	return resp, err
+}
+
+// do executes a Request against its URL, retrying with auth if required.
+func (client *Client) do(req *Request) (*Response, error) {
+	req.attempts++
+	resp, err := client.execute(req)
 	if err != nil {
 		return resp, err
 	}
 	if resp.IsUnauthorized() {
+		if body := resp.RawBody(); body != nil {
+			body.Close()
+		}
 		resp, err = client.retryRequestWithAuth(req, resp)
 	}
 	return resp, err
 }
-
-// adapted from Resty: https://github.com/go-resty/resty/blob/de0735f66dae7abf8fb1073b4ace3032c1491424/client.go#L928
-func createTransport(insecureSkipTLSVerify bool) *http.Transport {
-	dialer := &net.Dialer{
-		Timeout:   30 * time.Second,
-		KeepAlive: 30 * time.Second,
-		DualStack: true,
-	}
-	return &http.Transport{
-		Proxy:                 http.ProxyFromEnvironment,
-		DialContext:           dialer.DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		MaxIdleConnsPerHost:   runtime.GOMAXPROCS(0) + 1,
-		DisableCompression:    true,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: insecureSkipTLSVerify, //nolint: gosec
-		},
-	}
-}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bloodorangeio/reggie"
+	"github.com/bloodorangeio/reggie/reggietest"
+)
+
+// seedImage stores a two-platform image in the registry, returning the
+// digest of its index.
+func seedImage(t *testing.T, registry *reggietest.Registry, name string, tag string) string {
+	t.Helper()
+	var entries []string
+	for _, arch := range []string{"amd64", "arm64"} {
+		config := []byte(fmt.Sprintf(`{"os":"linux","architecture":"%s","created":"2024-01-01T00:00:00Z"}`, arch))
+		layer := []byte("layer for " + arch)
+		configDigest := registry.PutBlob(name, config)
+		layerDigest := registry.PutBlob(name, layer)
+		manifest := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s",`+
+			`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"%s","size":%d},`+
+			`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"%s","size":%d}]}`,
+			reggie.MediaTypeImageManifest, configDigest, len(config), layerDigest, len(layer)))
+		digest, err := registry.PutManifest(name, reggie.DigestFromBytes(manifest), reggie.MediaTypeImageManifest, manifest)
+		if err != nil {
+			t.Fatalf("Errors storing manifest: %s", err)
+		}
+		entries = append(entries, fmt.Sprintf(`{"mediaType":"%s","digest":"%s","size":%d,"platform":{"os":"linux","architecture":"%s"}}`,
+			reggie.MediaTypeImageManifest, digest, len(manifest), arch))
+	}
+	index := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","manifests":[%s]}`, reggie.MediaTypeImageIndex, strings.Join(entries, ",")))
+	digest, err := registry.PutManifest(name, tag, reggie.MediaTypeImageIndex, index)
+	if err != nil {
+		t.Fatalf("Errors storing index: %s", err)
+	}
+	return digest
+}
+
+func TestTagsAndInspect(t *testing.T) {
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	indexDigest := seedImage(t, registry, "org/app", "v1")
+	for _, tag := range []string{"v2", "v3"} {
+		seedImage(t, registry, "org/app", tag)
+	}
+	ref := registry.Host() + "/org/app"
+
+	code, stdout, stderr := runCommand("", "tags", ref, "--plain-http", "--page-size", "1")
+	if code != exitOK || stdout != "v1\nv2\nv3\n" {
+		t.Fatalf("Expected all pages of tags but got %d %q: %s", code, stdout, stderr)
+	}
+
+	code, stdout, stderr = runCommand("", "inspect", ref+":v1", "--plain-http")
+	if code != exitOK || !strings.Contains(stdout, "Digest:     "+indexDigest) || !strings.Contains(stdout, "linux/arm64") {
+		t.Fatalf("Expected index with platforms but got %d %s: %s", code, stdout, stderr)
+	}
+
+	code, stdout, stderr = runCommand("", "inspect", ref+":v1", "--plain-http", "--platform", "linux/arm64", "--output", "json")
+	if code != exitOK {
+		t.Fatalf("Expected manifest to be inspected but got %d: %s", code, stderr)
+	}
+	var out struct {
+		Descriptor reggie.Descriptor
+		Config     struct{ Architecture string }
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil || out.Config.Architecture != "arm64" ||
+		out.Descriptor.MediaType != reggie.MediaTypeImageManifest {
+		t.Fatalf("Expected arm64 manifest and config but got %s", stdout)
+	}
+
+	code, _, stderr = runCommand("", "inspect", ref+":v1", "--plain-http", "--platform", "windows/amd64")
+	if code != exitError || !strings.Contains(stderr, "no manifest for platform windows/amd64") {
+		t.Fatalf("Expected missing platform to fail but got %d: %s", code, stderr)
+	}
+}
+
+func TestPullPushCopyDelete(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithTokenAuth("", ""))
+	defer registry.Close()
+	other := reggietest.NewRegistry()
+	defer other.Close()
+	indexDigest := seedImage(t, registry, "org/app", "v1")
+	ref := registry.Host() + "/org/app"
+
+	// pull all platforms to a layout, and push it elsewhere
+	dir := filepath.Join(t.TempDir(), "layout")
+	code, stdout, stderr := runCommand("", "pull", ref+":v1", dir, "--plain-http")
+	if code != exitOK || stdout != ref+":v1: "+indexDigest+"\n" {
+		t.Fatalf("Expected image to be pulled but got %d %q: %s", code, stdout, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "oci-layout")); err != nil {
+		t.Fatalf("Expected oci-layout file: %s", err)
+	}
+	code, _, stderr = runCommand("", "push", dir, other.Host()+"/mirror/app", "--plain-http")
+	if code != exitOK {
+		t.Fatalf("Expected image to be pushed but got %d: %s", code, stderr)
+	}
+	if m, ok := other.Manifest("mirror/app", "v1"); !ok || m.MediaType != reggie.MediaTypeImageIndex {
+		t.Fatalf("Expected index to be pushed with the tag from the layout")
+	}
+
+	// copy a single platform within a registry, mounting its blobs
+	uploads := registry.Uploads()
+	code, stdout, stderr = runCommand("", "copy", ref+":v1", registry.Host()+"/org/arm:latest",
+		"--plain-http", "--platform", "linux/arm64", "--output", "json")
+	if code != exitOK {
+		t.Fatalf("Expected image to be copied but got %d: %s", code, stderr)
+	}
+	var out transferOutput
+	json.Unmarshal([]byte(stdout), &out)
+	if m, ok := registry.Manifest("org/arm", "latest"); !ok || m.MediaType != reggie.MediaTypeImageManifest || out.Descriptor.Digest == indexDigest {
+		t.Fatalf("Expected arm64 manifest to be copied but got %s", stdout)
+	}
+	if registry.Uploads() != uploads+2 {
+		t.Fatalf("Expected config and layer to be mounted")
+	}
+
+	// copy between registries
+	code, _, stderr = runCommand("", "copy", ref+":v1", other.Host()+"/copied/app", "--plain-http")
+	if code != exitOK {
+		t.Fatalf("Expected image to be copied but got %d: %s", code, stderr)
+	}
+	if _, ok := other.Manifest("copied/app", "v1"); !ok {
+		t.Fatalf("Expected tag to default to the source tag")
+	}
+
+	// delete maps missing manifests to their exit code
+	code, stdout, stderr = runCommand("", "delete", other.Host()+"/copied/app:v1", "--plain-http")
+	if code != exitOK || stdout != "Deleted "+other.Host()+"/copied/app:v1\n" {
+		t.Fatalf("Expected tag to be deleted but got %d %q: %s", code, stdout, stderr)
+	}
+	if code, _, _ = runCommand("", "inspect", other.Host()+"/copied/app:v1", "--plain-http"); code != exitNotFound {
+		t.Fatalf("Expected exit code %d for deleted tag but got %d", exitNotFound, code)
+	}
+	if code, _, _ = runCommand("", "delete", other.Host()+"/copied/app:v1", "--plain-http"); code != exitNotFound {
+		t.Fatalf("Expected exit code %d for deleting a missing tag but got %d", exitNotFound, code)
+	}
+	if code, _, _ = runCommand("", "delete", other.Host()+"/copied/app", "--plain-http"); code != exitUsage {
+		t.Fatalf("Expected exit code %d for reference without tag but got %d", exitUsage, code)
+	}
+}
+
+func TestPullRejectsInvalidDigests(t *testing.T) {
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	for i, digest := range []string{"../../escape:0123abcd", "sha256:../../escape", "sha256:0123ABCD"} {
+		manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"%s","size":2},"layers":[]}`,
+			reggie.MediaTypeImageManifest, digest)
+		tag := fmt.Sprintf("evil%d", i)
+		registry.PutManifest("org/evil", tag, reggie.MediaTypeImageManifest, []byte(manifest))
+
+		parent := t.TempDir()
+		code, _, _ := runCommand("", "pull", registry.Host()+"/org/evil:"+tag, filepath.Join(parent, "out"), "--plain-http")
+		if code == exitOK {
+			t.Fatalf("Expected digest %q to be rejected", digest)
+		}
+		if _, err := os.Stat(filepath.Join(parent, "escape")); err == nil {
+			t.Fatalf("Expected nothing to be created outside the layout for digest %q", digest)
+		}
+	}
+}
+
+func TestPushSHA512Layout(t *testing.T) {
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+
+	dir := t.TempDir()
+	config := []byte("{}")
+	configDigest := reggie.DigestFromBytes(config)
+	manifest := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"%s","size":2},"layers":[]}`,
+		reggie.MediaTypeImageManifest, configDigest))
+	sum := sha512.Sum512(manifest)
+	manifestDigest := "sha512:" + hex.EncodeToString(sum[:])
+	index := fmt.Sprintf(`{"schemaVersion":2,"manifests":[{"mediaType":"%s","digest":"%s","size":%d,"annotations":{"org.opencontainers.image.ref.name":"v1"}}]}`,
+		reggie.MediaTypeImageManifest, manifestDigest, len(manifest))
+	for path, content := range map[string][]byte{
+		"oci-layout": []byte(`{"imageLayoutVersion":"1.0.0"}`),
+		"index.json": []byte(index),
+		"blobs/sha256/" + strings.TrimPrefix(configDigest, "sha256:"):   config,
+		"blobs/sha512/" + strings.TrimPrefix(manifestDigest, "sha512:"): manifest,
+	} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0755)
+		os.WriteFile(filepath.Join(dir, path), content, 0644)
+	}
+
+	code, _, stderr := runCommand("", "push", dir, registry.Host()+"/org/app", "--plain-http")
+	if code != exitOK {
+		t.Fatalf("Expected sha512 manifest to be pushed but got %d: %s", code, stderr)
+	}
+	if _, ok := registry.Manifest("org/app", "v1"); !ok {
+		t.Fatalf("Expected manifest to be tagged v1")
+	}
+}
+
+func TestDeleteManifestFallback(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithTagDeletesDisabled())
+	defer registry.Close()
+	digest, _ := registry.PutManifest("org/app", "v1", reggie.MediaTypeImageManifest, []byte(`{"schemaVersion":2}`))
+	ref := registry.Host() + "/org/app:v1"
+
+	if code, _, _ := runCommand("", "delete", ref, "--plain-http"); code == exitOK {
+		t.Fatalf("Expected tag not to be deleted with its manifest by default")
+	}
+	if _, ok := registry.Manifest("org/app", "v1"); !ok {
+		t.Fatalf("Expected tag to be kept")
+	}
+	code, stdout, stderr := runCommand("", "delete", ref, "--plain-http", "--delete-manifest")
+	if code != exitOK || stdout != "Deleted "+ref+"\nDeleted manifest "+digest+"\n" {
+		t.Fatalf("Expected tag to be deleted with its manifest but got %d %q: %s", code, stdout, stderr)
+	}
+}
+
+func TestBlob(t *testing.T) {
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	ref := registry.Host() + "/org/app"
+
+	path := filepath.Join(t.TempDir(), "blob")
+	content := []byte("uploaded from the command line")
+	os.WriteFile(path, content, 0644)
+	code, stdout, stderr := runCommand("", "blob", "put", ref, path, "--plain-http")
+	digest := reggie.DigestFromBytes(content)
+	if code != exitOK || stdout != digest+"\n" {
+		t.Fatalf("Expected blob to be pushed but got %d %q: %s", code, stdout, stderr)
+	}
+
+	code, stdout, stderr = runCommand("", "blob", "get", ref+"@"+digest, "--plain-http")
+	if code != exitOK || stdout != string(content) {
+		t.Fatalf("Expected blob content but got %d %q: %s", code, stdout, stderr)
+	}
+	missing := reggie.DigestFromBytes([]byte("missing"))
+	if code, _, _ = runCommand("", "blob", "get", ref+"@"+missing, "--plain-http"); code != exitNotFound {
+		t.Fatalf("Expected exit code %d for missing blob but got %d", exitNotFound, code)
+	}
+	if code, _, _ = runCommand("", "blob", "list"); code != exitUsage {
+		t.Fatalf("Expected exit code %d for unknown blob command but got %d", exitUsage, code)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithDeletesDisabled())
+	defer registry.Close()
+	dir := t.TempDir()
+	junit := filepath.Join(dir, "junit.xml")
+
+	code, stdout, stderr := runCommand("", "conformance", registry.Host()+"/conformance/test", "--plain-http",
+		"--workflows", "pull,content-management", "--junit", junit)
+	if code != exitOK {
+		t.Fatalf("Expected conformance checks to pass but got %d: %s%s", code, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "PASS  pull ") || !strings.Contains(stdout, "SKIP  content-management  delete blob") ||
+		strings.Contains(stdout, "  push  ") {
+		t.Fatalf("Unexpected checks %s", stdout)
+	}
+	if data, err := os.ReadFile(junit); err != nil || !strings.Contains(string(data), "<testsuites") {
+		t.Fatalf("Expected JUnit report to be written: %v", err)
+	}
+
+	registry.InjectFault(reggietest.Fault{Method: reggie.GET, Path: "/blobs/", Status: 500})
+	code, stdout, _ = runCommand("", "conformance", registry.Host()+"/conformance/test", "--plain-http",
+		"--workflows", "pull", "--transcripts")
+	if code != exitError || !strings.Contains(stdout, "FAIL  pull                GET blob") || !strings.Contains(stdout, "< 500") {
+		t.Fatalf("Expected failing check with transcript but got %d: %s", code, stdout)
+	}
+	if code, _, _ = runCommand("", "conformance", registry.Host()+"/conformance/test", "--workflows", "unknown"); code != exitUsage {
+		t.Fatalf("Expected exit code %d for unknown workflow but got %d", exitUsage, code)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	// the tags refer to the same index, so pruning only untags them
+	for _, tag := range []string{"v1", "v2", "v3"} {
+		seedImage(t, registry, "org/app", tag)
+	}
+	ref := registry.Host() + "/org/app"
+
+	code, stdout, stderr := runCommand("", "prune", ref, "--plain-http", "--keep-last", "1", "--keep", "^v1$", "--dry-run")
+	if code != exitOK || !strings.Contains(stdout, "keep       v1 (matches ^v1$)") || !strings.Contains(stdout, "delete     tag v3") ||
+		!strings.Contains(stdout, "2 deletions planned") {
+		t.Fatalf("Expected plan but got %d %s: %s", code, stdout, stderr)
+	}
+	if _, ok := registry.Manifest("org/app", "v2"); !ok {
+		t.Fatalf("Expected dry run not to delete anything")
+	}
+
+	code, stdout, stderr = runCommand("", "prune", ref, "--plain-http", "--keep-last", "1", "--keep", "^v1$")
+	if code != exitOK || !strings.Contains(stdout, "2 deleted, 0 already gone, 0 failed, 1 tags kept") {
+		t.Fatalf("Expected tags to be pruned but got %d %s: %s", code, stdout, stderr)
+	}
+	if _, ok := registry.Manifest("org/app", "v1"); !ok {
+		t.Fatalf("Expected kept tag to survive")
+	}
+	if code, _, _ = runCommand("", "prune", ref, "--max-age", "soon"); code != exitUsage {
+		t.Fatalf("Expected exit code %d for invalid age but got %d", exitUsage, code)
+	}
+}
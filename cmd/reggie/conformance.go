@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bloodorangeio/reggie/reggieconformance"
+)
+
+// conformance runs the distribution-spec conformance checks against a
+// repository, failing if any check fails.
+func (cmd *command) conformance(args []string) error {
+	var workflows, crossmount, junitFile, reportFile string
+	var transcripts bool
+	f, positional, err := cmd.parseCommand("conformance", args, 1, 1, func(fs *flag.FlagSet) {
+		fs.StringVar(&workflows, "workflows", "", "comma-separated `workflows` to run (default all)")
+		fs.StringVar(&crossmount, "crossmount", reggieconformance.DefaultCrossmountNamespace, "`repository` to mount blobs from")
+		fs.StringVar(&junitFile, "junit", "", "write a JUnit XML report to `file`")
+		fs.StringVar(&reportFile, "report", "", "write a JSON report to `file`")
+		fs.BoolVar(&transcripts, "transcripts", false, "print the transcripts of failed checks")
+	})
+	if err != nil {
+		return err
+	}
+	client, ref, err := f.clientFor(positional[0])
+	if err != nil {
+		return err
+	}
+	opts := []reggieconformance.Option{
+		reggieconformance.WithNamespace(ref.Repository),
+		reggieconformance.WithCrossmountNamespace(crossmount),
+	}
+	if workflows != "" {
+		var selected []reggieconformance.Workflow
+		for _, name := range strings.Split(workflows, ",") {
+			w, err := reggieconformance.ParseWorkflow(strings.TrimSpace(name))
+			if err != nil {
+				return fmt.Errorf("%w: %s", errUsage, err)
+			}
+			selected = append(selected, w)
+		}
+		opts = append(opts, reggieconformance.WithWorkflows(selected...))
+	}
+
+	report := reggieconformance.NewRunner(client, opts...).Run(cmd.ctx)
+	if junitFile != "" {
+		if err := writeReport(junitFile, report.WriteJUnit); err != nil {
+			return err
+		}
+	}
+	if reportFile != "" {
+		if err := writeReport(reportFile, report.WriteJSON); err != nil {
+			return err
+		}
+	}
+
+	if f.json() {
+		if err := report.WriteJSON(cmd.stdout); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range report.Checks {
+			line := fmt.Sprintf("%-4s  %-18s  %s (%s)", strings.ToUpper(string(c.Status)), c.Workflow, c.Name, c.Duration.Round(time.Millisecond))
+			if c.Message != "" {
+				line += ": " + c.Message
+			}
+			fmt.Fprintln(cmd.stdout, line)
+			if transcripts && c.Status == reggieconformance.Failed {
+				fmt.Fprint(cmd.stdout, c.TranscriptText())
+			}
+		}
+		passed, failed, skipped := report.Counts()
+		fmt.Fprintf(cmd.stdout, "\n%d passed, %d failed, %d skipped\n", passed, failed, skipped)
+	}
+	if !report.Passed() {
+		return &codeError{code: exitError}
+	}
+	return nil
+}
+
+// writeReport writes a report to a file with write.
+func writeReport(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
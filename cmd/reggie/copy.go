@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bloodorangeio/reggie"
+)
+
+// copy copies an image, or all images of an index, between references.
+func (cmd *command) copy(args []string) error {
+	var platformFlag string
+	f, positional, err := cmd.parseCommand("copy", args, 2, 2, func(fs *flag.FlagSet) {
+		fs.StringVar(&platformFlag, "platform", "", "copy only the manifest for `os/arch[/variant]` from an index")
+	})
+	if err != nil {
+		return err
+	}
+	requested, err := optionalPlatform(platformFlag)
+	if err != nil {
+		return err
+	}
+	src, srcRef, err := f.clientFor(positional[0])
+	if err != nil {
+		return err
+	}
+	dst, dstRef, err := f.clientFor(positional[1])
+	if err != nil {
+		return err
+	}
+	srcRef = withDefaultTag(srcRef)
+	if dstRef.Reference() == "" {
+		dstRef.Tag, dstRef.Digest = srcRef.Tag, srcRef.Digest
+	}
+
+	m, err := resolve(cmd.ctx, src, srcRef, requested)
+	if err != nil {
+		return err
+	}
+	c := &copier{src: src, dst: dst, srcName: srcRef.Repository, dstName: dstRef.Repository}
+	if err := c.copyContent(cmd.ctx, m); err != nil {
+		return err
+	}
+	reference := dstRef.Tag
+	if reference == "" {
+		reference = m.Descriptor.Digest
+	}
+	if _, err := dst.PushManifest(cmd.ctx, dstRef.Repository, reference, m.Descriptor.MediaType, m.Content); err != nil {
+		return err
+	}
+	return cmd.printTransfer(f, dstRef, m.Descriptor, "")
+}
+
+// copier copies content between repositories.
+type copier struct {
+	src, dst         *reggie.Client
+	srcName, dstName string
+}
+
+// copyContent copies the content referenced by a manifest. Manifests in an
+// index are pushed by digest. Blobs are mounted rather than copied when both
+// repositories are on the same registry.
+func (c *copier) copyContent(ctx context.Context, m *fetchedManifest) error {
+	for _, entry := range m.Manifests {
+		child, err := fetchManifest(ctx, c.src, c.srcName, entry.Digest)
+		if err != nil {
+			return err
+		}
+		if err := c.copyContent(ctx, child); err != nil {
+			return err
+		}
+		if _, err := c.dst.PushManifest(ctx, c.dstName, entry.Digest, child.Descriptor.MediaType, child.Content); err != nil {
+			return err
+		}
+	}
+	for _, desc := range blobsOf(m) {
+		var err error
+		if c.src.Config.Address == c.dst.Config.Address && c.srcName != c.dstName {
+			err = c.dst.PushBlob(ctx, c.dstName, desc, pullOpener(ctx, c.src, c.srcName, desc), reggie.WithMountFrom(c.srcName))
+		} else {
+			err = c.dst.PushBlob(ctx, c.dstName, desc, pullOpener(ctx, c.src, c.srcName, desc))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pullOpener returns a BlobOpener streaming a blob from a repository.
+func pullOpener(ctx context.Context, client *reggie.Client, name string, desc reggie.Descriptor) reggie.BlobOpener {
+	return func() (io.ReadCloser, error) {
+		r, w := io.Pipe()
+		go func() {
+			w.CloseWithError(client.PullBlob(ctx, name, desc, w))
+		}()
+		return r, nil
+	}
+}
+
+// blob downloads or uploads a blob.
+func (cmd *command) blob(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "get":
+			return cmd.blobGet(args[1:])
+		case "put":
+			return cmd.blobPut(args[1:])
+		}
+	}
+	return fmt.Errorf("%w: expected \"blob get REFERENCE@DIGEST [FILE]\" or \"blob put REFERENCE FILE\"", errUsage)
+}
+
+// blobGet downloads a blob to a file, or stdout.
+func (cmd *command) blobGet(args []string) error {
+	f, positional, err := cmd.parseCommand("blob", args, 1, 2, nil)
+	if err != nil {
+		return err
+	}
+	client, ref, err := f.clientFor(positional[0])
+	if err != nil {
+		return err
+	}
+	if ref.Digest == "" {
+		return fmt.Errorf("%w: reference %q has no digest", errUsage, positional[0])
+	}
+	desc := reggie.Descriptor{Digest: ref.Digest, Size: -1}
+	if len(positional) == 1 || positional[1] == "-" {
+		return client.PullBlob(cmd.ctx, ref.Repository, desc, cmd.stdout)
+	}
+	return client.PullBlobToFile(cmd.ctx, ref.Repository, desc, positional[1])
+}
+
+// blobPut uploads a file as a blob, printing its descriptor.
+func (cmd *command) blobPut(args []string) error {
+	f, positional, err := cmd.parseCommand("blob", args, 2, 2, nil)
+	if err != nil {
+		return err
+	}
+	client, ref, err := f.clientFor(positional[0])
+	if err != nil {
+		return err
+	}
+	path := positional[1]
+	desc, err := describeFile(path)
+	if err != nil {
+		return err
+	}
+	err = client.PushBlob(cmd.ctx, ref.Repository, desc, func() (io.ReadCloser, error) {
+		return os.Open(path)
+	})
+	if err != nil {
+		return err
+	}
+	if f.json() {
+		return cmd.printJSON(desc)
+	}
+	fmt.Fprintln(cmd.stdout, desc.Digest)
+	return nil
+}
+
+// describeFile returns the sha256 digest and size of a file.
+func describeFile(path string) (reggie.Descriptor, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return reggie.Descriptor{}, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, file)
+	if err != nil {
+		return reggie.Descriptor{}, err
+	}
+	return reggie.Descriptor{Digest: "sha256:" + hex.EncodeToString(h.Sum(nil)), Size: n}, nil
+}
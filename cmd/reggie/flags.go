@@ -0,0 +1,193 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bloodorangeio/reggie"
+)
+
+const (
+	dockerHub         = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+// clientFlags are the flags configuring the reggie.Client of a command.
+type clientFlags struct {
+	registry  string
+	username  string
+	password  string
+	userAgent string
+	insecure  bool
+	plainHTTP bool
+	debug     bool
+	caFiles   stringList
+	certFile  string
+	keyFile   string
+	certsDir  string
+}
+
+// newFlagSet returns a flag set writing its usage to w.
+func newFlagSet(name string, w io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(w)
+	return fs
+}
+
+// register adds the client flags to a flag set. Credentials default to the
+// REGGIE_USERNAME and REGGIE_PASSWORD environment variables, and the registry
+// to REGGIE_REGISTRY.
+func (f *clientFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.registry, "registry", os.Getenv("REGGIE_REGISTRY"), "registry `address`, e.g. https://ghcr.io")
+	fs.StringVar(&f.username, "username", os.Getenv("REGGIE_USERNAME"), "username for Basic or token auth")
+	fs.StringVar(&f.password, "password", os.Getenv("REGGIE_PASSWORD"), "password for Basic or token auth")
+	fs.StringVar(&f.userAgent, "user-agent", "", "User-Agent header (default reggie's)")
+	fs.BoolVar(&f.insecure, "insecure", false, "skip TLS certificate verification")
+	fs.BoolVar(&f.plainHTTP, "plain-http", false, "use http for registry addresses without a scheme")
+	fs.BoolVar(&f.debug, "debug", false, "log requests and responses")
+	fs.Var(&f.caFiles, "cacert", "PEM `file` of CA certificates to trust (repeatable)")
+	fs.StringVar(&f.certFile, "cert", "", "PEM `file` of the client certificate")
+	fs.StringVar(&f.keyFile, "key", "", "PEM `file` of the client certificate's key")
+	fs.StringVar(&f.certsDir, "certs-dir", "", "Docker-style certs.d `directory` for the registry")
+}
+
+// newClient builds a client for the registry at address, or the --registry
+// flag if address is empty. Addresses without a scheme default to https, or
+// http with --plain-http.
+func (f *clientFlags) newClient(address string) (*reggie.Client, error) {
+	if address == "" {
+		address = f.registry
+	}
+	if address == "" {
+		return nil, fmt.Errorf("%w: --registry is required", errUsage)
+	}
+	if !strings.Contains(address, "://") {
+		scheme := "https://"
+		if f.plainHTTP {
+			scheme = "http://"
+		}
+		address = scheme + address
+	}
+
+	var handler slog.Handler = slog.NewTextHandler(io.Discard, nil)
+	if f.debug {
+		handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	}
+	options := optionList(reggie.WithLogger(slog.New(handler)))
+	if f.username != "" || f.password != "" {
+		options = append(options, reggie.WithUsernamePassword(f.username, f.password))
+	}
+	if f.userAgent != "" {
+		options = append(options, reggie.WithUserAgent(f.userAgent))
+	}
+	if f.insecure {
+		options = append(options, reggie.WithInsecureSkipTLSVerify(true))
+	}
+	if len(f.caFiles) > 0 {
+		options = append(options, reggie.WithRootCAFiles(f.caFiles...))
+	}
+	if f.certFile != "" || f.keyFile != "" {
+		options = append(options, reggie.WithClientCertificateFiles(f.certFile, f.keyFile))
+	}
+	if f.certsDir != "" {
+		options = append(options, reggie.WithCertsDir(f.certsDir))
+	}
+	return reggie.NewClient(address, options...)
+}
+
+// clientFor parses a reference and builds a client for its registry, or the
+// --registry flag if the reference has none. References to Docker Hub are
+// resolved to its registry host and library namespace.
+func (f *clientFlags) clientFor(s string) (*reggie.Client, reggie.Reference, error) {
+	ref, err := reggie.ParseReference(s)
+	if err != nil {
+		return nil, ref, fmt.Errorf("%w: %s", errUsage, err)
+	}
+	address := ref.Registry
+	if address == dockerHub {
+		address = dockerHubRegistry
+		if !strings.Contains(ref.Repository, "/") {
+			ref.Repository = "library/" + ref.Repository
+		}
+	}
+	client, err := f.newClient(address)
+	return client, ref, err
+}
+
+// outputFlags select the output format of a command.
+type outputFlags struct {
+	output string
+}
+
+func (f *outputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.output, "output", "text", "output `format`, text or json")
+}
+
+// validate checks the output format.
+func (f *outputFlags) validate() error {
+	if f.output != "text" && f.output != "json" {
+		return fmt.Errorf("%w: unknown output format %q", errUsage, f.output)
+	}
+	return nil
+}
+
+// json returns whether JSON output was requested.
+func (f *outputFlags) json() bool {
+	return f.output == "json"
+}
+
+// optionList returns its arguments as a slice, whose element type is
+// inferred since reggie's option types are unexported.
+func optionList[T any](opts ...T) []T {
+	return opts
+}
+
+// splitURL splits a full URL into the registry address and path.
+func splitURL(raw string) (string, string, error) {
+	if !strings.HasPrefix(raw, "http://") && !strings.HasPrefix(raw, "https://") {
+		return "", raw, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", err
+	}
+	address := (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+	path := strings.TrimPrefix(raw, address)
+	return address, path, nil
+}
+
+// commandFlags are the flags common to subcommands.
+type commandFlags struct {
+	clientFlags
+	outputFlags
+}
+
+// parseCommand parses the flags of a subcommand, registering its own flags
+// with register if set, and checks it received between minArgs and maxArgs
+// positional arguments.
+func (cmd *command) parseCommand(name string, args []string, minArgs int, maxArgs int, register func(fs *flag.FlagSet)) (*commandFlags, []string, error) {
+	f := &commandFlags{}
+	fs := newCommandFlags(cmd.stderr, name)
+	f.clientFlags.register(fs)
+	f.outputFlags.register(fs)
+	if register != nil {
+		register(fs)
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(positional) < minArgs || len(positional) > maxArgs {
+		fs.Usage()
+		return nil, nil, &codeError{code: exitUsage}
+	}
+	if err := f.validate(); err != nil {
+		return nil, nil, err
+	}
+	return f, positional, nil
+}
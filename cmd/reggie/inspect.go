@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/bloodorangeio/reggie"
+)
+
+type (
+	// imageConfig holds the fields of an image config shown by inspect.
+	imageConfig struct {
+		Created      string `json:"created,omitempty"`
+		OS           string `json:"os,omitempty"`
+		Architecture string `json:"architecture,omitempty"`
+		Variant      string `json:"variant,omitempty"`
+	}
+
+	inspectOutput struct {
+		Reference  string            `json:"reference"`
+		Descriptor reggie.Descriptor `json:"descriptor"`
+		Manifest   json.RawMessage   `json:"manifest"`
+		Config     json.RawMessage   `json:"config,omitempty"`
+	}
+)
+
+// tags lists the tags of a repository.
+func (cmd *command) tags(args []string) error {
+	var pageSize int
+	f, positional, err := cmd.parseCommand("tags", args, 1, 1, func(fs *flag.FlagSet) {
+		fs.IntVar(&pageSize, "page-size", 0, "number of tags to request per page")
+	})
+	if err != nil {
+		return err
+	}
+	client, ref, err := f.clientFor(positional[0])
+	if err != nil {
+		return err
+	}
+	tags, err := client.ListTags(cmd.ctx, ref.Repository, reggie.WithPageSize(pageSize))
+	if err != nil {
+		return err
+	}
+	if f.json() {
+		return cmd.printJSON(struct {
+			Name string   `json:"name"`
+			Tags []string `json:"tags"`
+		}{ref.Name(), append([]string{}, tags...)})
+	}
+	for _, tag := range tags {
+		fmt.Fprintln(cmd.stdout, tag)
+	}
+	return nil
+}
+
+// inspect shows a manifest, and the config of an image manifest.
+func (cmd *command) inspect(args []string) error {
+	var platformFlag string
+	f, positional, err := cmd.parseCommand("inspect", args, 1, 1, func(fs *flag.FlagSet) {
+		fs.StringVar(&platformFlag, "platform", "", "select the manifest for `os/arch[/variant]` from an index")
+	})
+	if err != nil {
+		return err
+	}
+	requested, err := optionalPlatform(platformFlag)
+	if err != nil {
+		return err
+	}
+	client, ref, err := f.clientFor(positional[0])
+	if err != nil {
+		return err
+	}
+	ref = withDefaultTag(ref)
+	m, err := resolve(cmd.ctx, client, ref, requested)
+	if err != nil {
+		return err
+	}
+
+	var config []byte
+	if m.Config != nil {
+		var buf bytes.Buffer
+		if err := client.PullBlob(cmd.ctx, ref.Repository, *m.Config, &buf); err != nil {
+			return err
+		}
+		config = buf.Bytes()
+	}
+
+	if f.json() {
+		out := inspectOutput{Reference: ref.String(), Descriptor: m.Descriptor, Manifest: m.Content}
+		if json.Valid(config) {
+			out.Config = config
+		}
+		return cmd.printJSON(out)
+	}
+
+	fmt.Fprintf(cmd.stdout, "Reference:  %s\n", ref)
+	fmt.Fprintf(cmd.stdout, "Digest:     %s\n", m.Descriptor.Digest)
+	fmt.Fprintf(cmd.stdout, "Media type: %s\n", m.Descriptor.MediaType)
+	fmt.Fprintf(cmd.stdout, "Size:       %d\n", m.Descriptor.Size)
+	if isIndex(m.Descriptor.MediaType) {
+		fmt.Fprintln(cmd.stdout, "Manifests:")
+		for _, entry := range m.Manifests {
+			p := "unknown"
+			if entry.Platform != nil {
+				p = entry.Platform.String()
+			}
+			fmt.Fprintf(cmd.stdout, "  %s  %s  %d\n", entry.Digest, p, entry.Size)
+		}
+		return nil
+	}
+	var c imageConfig
+	if json.Unmarshal(config, &c) == nil && c.OS != "" {
+		p := platform{OS: c.OS, Architecture: c.Architecture, Variant: c.Variant}
+		fmt.Fprintf(cmd.stdout, "Platform:   %s\n", p.String())
+	}
+	if c.Created != "" {
+		fmt.Fprintf(cmd.stdout, "Created:    %s\n", c.Created)
+	}
+	if m.Config != nil {
+		fmt.Fprintf(cmd.stdout, "Config:     %s  %s  %d\n", m.Config.Digest, m.Config.MediaType, m.Config.Size)
+	}
+	fmt.Fprintln(cmd.stdout, "Layers:")
+	for _, layer := range m.Layers {
+		fmt.Fprintf(cmd.stdout, "  %s  %s  %d\n", layer.Digest, layer.MediaType, layer.Size)
+	}
+	return nil
+}
+
+// delete deletes a tag, or a manifest by digest. Tags are only deleted with
+// their manifest if --delete-manifest is given.
+func (cmd *command) delete(args []string) error {
+	var deleteManifest bool
+	f, positional, err := cmd.parseCommand("delete", args, 1, 1, func(fs *flag.FlagSet) {
+		fs.BoolVar(&deleteManifest, "delete-manifest", false, "delete the manifest of a tag, and all its tags, if the registry cannot delete the tag alone")
+	})
+	if err != nil {
+		return err
+	}
+	client, ref, err := f.clientFor(positional[0])
+	if err != nil {
+		return err
+	}
+	if ref.Reference() == "" {
+		return fmt.Errorf("%w: reference %q has no tag or digest", errUsage, positional[0])
+	}
+	var result *reggie.DeleteResult
+	switch {
+	case ref.Digest != "":
+		result, err = client.DeleteManifest(cmd.ctx, ref.Repository, ref.Digest)
+	case deleteManifest:
+		result, err = client.DeleteTag(cmd.ctx, ref.Repository, ref.Tag, reggie.WithManifestFallback())
+	default:
+		result, err = client.DeleteTag(cmd.ctx, ref.Repository, ref.Tag)
+	}
+	if err != nil {
+		return err
+	}
+	if result.NotFound {
+		fmt.Fprintf(cmd.stderr, "reggie: %s not found\n", ref)
+		return &codeError{code: exitNotFound}
+	}
+	if f.json() {
+		return cmd.printJSON(struct {
+			Deleted  string `json:"deleted"`
+			Manifest string `json:"manifest,omitempty"`
+		}{ref.String(), result.Manifest})
+	}
+	fmt.Fprintf(cmd.stdout, "Deleted %s\n", ref)
+	if result.Manifest != "" && ref.Digest == "" {
+		// the registry could only delete the tag with its manifest
+		fmt.Fprintf(cmd.stdout, "Deleted manifest %s\n", result.Manifest)
+	}
+	return nil
+}
+
+// optionalPlatform parses the --platform flag if it was given.
+func optionalPlatform(s string) (*platform, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return parsePlatform(s)
+}
+
+// withDefaultTag returns a reference with the tag "latest" if it has
+// neither a tag nor a digest.
+func withDefaultTag(ref reggie.Reference) reggie.Reference {
+	if ref.Reference() == "" {
+		ref.Tag = "latest"
+	}
+	return ref
+}
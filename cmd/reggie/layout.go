@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bloodorangeio/reggie"
+)
+
+const (
+	// annotationRefName names a manifest in an OCI layout index.
+	annotationRefName = "org.opencontainers.image.ref.name"
+
+	layoutVersion = `{"imageLayoutVersion":"1.0.0"}`
+)
+
+var (
+	// digestAlgorithm and digestEncoded match the parts of a digest, which
+	// name the directory and file of a blob in a layout.
+	digestAlgorithm = regexp.MustCompile(`^[a-z0-9]+(?:[+._-][a-z0-9]+)*$`)
+	digestEncoded   = regexp.MustCompile(`^[a-f0-9]+$`)
+)
+
+type (
+	// layout is an OCI image layout directory.
+	layout struct {
+		dir   string
+		index layoutIndex
+	}
+
+	layoutIndex struct {
+		SchemaVersion int                 `json:"schemaVersion"`
+		MediaType     string              `json:"mediaType,omitempty"`
+		Manifests     []reggie.Descriptor `json:"manifests"`
+	}
+
+	transferOutput struct {
+		Reference  string            `json:"reference"`
+		Descriptor reggie.Descriptor `json:"descriptor"`
+		Directory  string            `json:"directory,omitempty"`
+	}
+)
+
+// openLayout opens the OCI layout at dir, creating it if create is set.
+func openLayout(dir string, create bool) (*layout, error) {
+	l := &layout{dir: dir, index: layoutIndex{SchemaVersion: 2, MediaType: reggie.MediaTypeImageIndex}}
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &l.index); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", filepath.Join(dir, "index.json"), err)
+		}
+		return l, nil
+	case !errors.Is(err, os.ErrNotExist) || !create:
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(layoutVersion), 0644); err != nil {
+		return nil, err
+	}
+	return l, l.save()
+}
+
+// blobPath returns the path of a blob in the layout, creating its directory.
+// The digest is validated first, so it cannot name a path outside the
+// layout.
+func (l *layout) blobPath(digest string) (string, error) {
+	algorithm, encoded, ok := strings.Cut(digest, ":")
+	if !ok || !digestAlgorithm.MatchString(algorithm) || !digestEncoded.MatchString(encoded) {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	dir := filepath.Join(l.dir, "blobs", algorithm)
+	return filepath.Join(dir, encoded), os.MkdirAll(dir, 0755)
+}
+
+// readBlob reads a blob from the layout, verifying its digest.
+func (l *layout) readBlob(desc reggie.Descriptor) ([]byte, error) {
+	path, err := l.blobPath(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := desc.Verify(content); err != nil {
+		return nil, fmt.Errorf("blob %s in %s: %w", desc.Digest, l.dir, err)
+	}
+	return content, nil
+}
+
+// writeBlob writes a blob to the layout.
+func (l *layout) writeBlob(digest string, content []byte) error {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// addManifest adds a manifest to the layout index, replacing any manifest
+// with the same name, or the same digest if it has no name.
+func (l *layout) addManifest(desc reggie.Descriptor, name string) {
+	if name != "" {
+		desc.Annotations = map[string]string{annotationRefName: name}
+	}
+	manifests := l.index.Manifests[:0]
+	for _, m := range l.index.Manifests {
+		existing := m.Annotations[annotationRefName]
+		if (name != "" && existing == name) || (name == "" && existing == "" && m.Digest == desc.Digest) {
+			continue
+		}
+		manifests = append(manifests, m)
+	}
+	l.index.Manifests = append(manifests, desc)
+}
+
+// findManifest returns the manifest in the layout index with a name, or the
+// only manifest if name is empty.
+func (l *layout) findManifest(name string) (reggie.Descriptor, error) {
+	if name == "" {
+		if len(l.index.Manifests) != 1 {
+			return reggie.Descriptor{}, fmt.Errorf("%w: %s holds %d manifests, select one with --ref-name", errUsage, l.dir, len(l.index.Manifests))
+		}
+		return l.index.Manifests[0], nil
+	}
+	for _, m := range l.index.Manifests {
+		if m.Annotations[annotationRefName] == name {
+			return m, nil
+		}
+	}
+	return reggie.Descriptor{}, fmt.Errorf("no manifest named %q in %s", name, l.dir)
+}
+
+// save writes the layout index.
+func (l *layout) save() error {
+	data, err := json.MarshalIndent(l.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(l.dir, "index.json"), data, 0644)
+}
+
+// pull pulls an image, or all images of an index, to an OCI layout.
+func (cmd *command) pull(args []string) error {
+	var platformFlag string
+	f, positional, err := cmd.parseCommand("pull", args, 2, 2, func(fs *flag.FlagSet) {
+		fs.StringVar(&platformFlag, "platform", "", "pull only the manifest for `os/arch[/variant]` from an index")
+	})
+	if err != nil {
+		return err
+	}
+	requested, err := optionalPlatform(platformFlag)
+	if err != nil {
+		return err
+	}
+	client, ref, err := f.clientFor(positional[0])
+	if err != nil {
+		return err
+	}
+	ref = withDefaultTag(ref)
+	l, err := openLayout(positional[1], true)
+	if err != nil {
+		return err
+	}
+	m, err := resolve(cmd.ctx, client, ref, requested)
+	if err != nil {
+		return err
+	}
+	if err := pullContent(cmd.ctx, client, ref.Repository, m, l); err != nil {
+		return err
+	}
+	l.addManifest(m.Descriptor, ref.Tag)
+	if err := l.save(); err != nil {
+		return err
+	}
+	return cmd.printTransfer(f, ref, m.Descriptor, l.dir)
+}
+
+// pullContent pulls a manifest and the content it references to a layout.
+func pullContent(ctx context.Context, client *reggie.Client, name string, m *fetchedManifest, l *layout) error {
+	for _, entry := range m.Manifests {
+		child, err := fetchManifest(ctx, client, name, entry.Digest)
+		if err != nil {
+			return err
+		}
+		if err := pullContent(ctx, client, name, child, l); err != nil {
+			return err
+		}
+	}
+	for _, desc := range blobsOf(m) {
+		path, err := l.blobPath(desc.Digest)
+		if err != nil {
+			return err
+		}
+		if err := client.PullBlobToFile(ctx, name, desc, path); err != nil {
+			return err
+		}
+	}
+	return l.writeBlob(m.Descriptor.Digest, m.Content)
+}
+
+// push pushes an image, or all images of an index, from an OCI layout.
+func (cmd *command) push(args []string) error {
+	var refName string
+	f, positional, err := cmd.parseCommand("push", args, 2, 2, func(fs *flag.FlagSet) {
+		fs.StringVar(&refName, "ref-name", "", "push the manifest with this `name` in the layout index")
+	})
+	if err != nil {
+		return err
+	}
+	l, err := openLayout(positional[0], false)
+	if err != nil {
+		return err
+	}
+	client, ref, err := f.clientFor(positional[1])
+	if err != nil {
+		return err
+	}
+	desc, err := l.findManifest(refName)
+	if err != nil {
+		return err
+	}
+	if ref.Reference() == "" {
+		ref.Tag = desc.Annotations[annotationRefName]
+	}
+	if ref.Digest != "" && ref.Digest != desc.Digest {
+		return fmt.Errorf("%w: manifest in %s has digest %s", errUsage, l.dir, desc.Digest)
+	}
+
+	m, err := l.readManifest(desc)
+	if err != nil {
+		return err
+	}
+	if err := pushContent(cmd.ctx, client, ref.Repository, m, l); err != nil {
+		return err
+	}
+	reference := ref.Tag
+	if reference == "" {
+		reference = desc.Digest
+	}
+	if _, err := client.PushManifest(cmd.ctx, ref.Repository, reference, m.Descriptor.MediaType, m.Content); err != nil {
+		return err
+	}
+	return cmd.printTransfer(f, ref, m.Descriptor, l.dir)
+}
+
+// readManifest reads and parses a manifest from the layout.
+func (l *layout) readManifest(desc reggie.Descriptor) (*fetchedManifest, error) {
+	content, err := l.readBlob(desc)
+	if err != nil {
+		return nil, err
+	}
+	m := &fetchedManifest{Descriptor: desc, Content: content}
+	if err := json.Unmarshal(content, &m.manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %w", desc.Digest, err)
+	}
+	if m.Descriptor.MediaType == "" {
+		m.Descriptor.MediaType = m.MediaType
+	}
+	return m, nil
+}
+
+// pushContent pushes the content referenced by a manifest from a layout.
+// Manifests in an index are pushed by digest.
+func pushContent(ctx context.Context, client *reggie.Client, name string, m *fetchedManifest, l *layout) error {
+	for _, entry := range m.Manifests {
+		child, err := l.readManifest(entry.Descriptor)
+		if err != nil {
+			return err
+		}
+		if err := pushContent(ctx, client, name, child, l); err != nil {
+			return err
+		}
+		if _, err := client.PushManifest(ctx, name, entry.Digest, child.Descriptor.MediaType, child.Content); err != nil {
+			return err
+		}
+	}
+	for _, desc := range blobsOf(m) {
+		path, err := l.blobPath(desc.Digest)
+		if err != nil {
+			return err
+		}
+		err = client.PushBlob(ctx, name, desc, func() (io.ReadCloser, error) {
+			return os.Open(path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blobsOf returns the config and layers of an image manifest.
+func blobsOf(m *fetchedManifest) []reggie.Descriptor {
+	var blobs []reggie.Descriptor
+	if m.Config != nil {
+		blobs = append(blobs, *m.Config)
+	}
+	return append(blobs, m.Layers...)
+}
+
+// printTransfer prints the result of a pull, push or copy.
+func (cmd *command) printTransfer(f *commandFlags, ref reggie.Reference, desc reggie.Descriptor, dir string) error {
+	if f.json() {
+		return cmd.printJSON(transferOutput{Reference: ref.String(), Descriptor: desc, Directory: dir})
+	}
+	fmt.Fprintf(cmd.stdout, "%s: %s\n", ref, desc.Digest)
+	return nil
+}
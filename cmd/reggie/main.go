@@ -0,0 +1,276 @@
+// Command reggie works with OCI registries from the command line. Its
+// subcommands pull, push, copy, inspect and delete content, and it makes
+// ad-hoc requests using the same path substitutions as reggie.Client:
+//
+//	reggie GET /v2/<name>/tags/list --registry ghcr.io --name org/app
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/bloodorangeio/reggie"
+)
+
+// Exit codes. Registry errors are mapped from their OCI error codes, or
+// their status code if the response has none.
+const (
+	exitOK              = 0
+	exitError           = 1
+	exitUsage           = 2
+	exitNotFound        = 3
+	exitUnauthorized    = 4
+	exitTooManyRequests = 5
+	exitUnsupported     = 6
+	exitInvalid         = 7
+)
+
+const usage = `Usage:
+  reggie COMMAND [arguments] [flags]
+  reggie METHOD PATH [flags]
+
+Commands:
+%s
+METHOD is an HTTP method, and PATH may contain the placeholders <name>,
+<reference>, <digest> and <session_id>, or be a full URL.
+
+Examples:
+  reggie tags ghcr.io/org/app
+  reggie inspect ghcr.io/org/app:v1 --platform linux/arm64 --output json
+  reggie copy docker.io/library/alpine:3 registry.example.com/alpine:3
+  reggie GET /v2/<name>/tags/list --registry ghcr.io --name org/app
+
+Exit codes:
+  1  error                 5  too many requests
+  2  invalid usage         6  unsupported by the registry
+  3  not found             7  invalid content or reference
+  4  unauthorized or denied
+
+Run "reggie COMMAND --help" or "reggie METHOD --help" for flags.
+`
+
+var (
+	errUsage = errors.New("invalid usage")
+
+	methods = map[string]bool{
+		reggie.GET:     true,
+		reggie.PUT:     true,
+		reggie.PATCH:   true,
+		reggie.DELETE:  true,
+		reggie.POST:    true,
+		reggie.HEAD:    true,
+		reggie.OPTIONS: true,
+	}
+
+	// errorCodeExits maps OCI error codes to exit codes.
+	errorCodeExits = map[string]int{
+		"BLOB_UNKNOWN":          exitNotFound,
+		"BLOB_UPLOAD_UNKNOWN":   exitNotFound,
+		"MANIFEST_UNKNOWN":      exitNotFound,
+		"NAME_UNKNOWN":          exitNotFound,
+		"UNAUTHORIZED":          exitUnauthorized,
+		"DENIED":                exitUnauthorized,
+		"TOOMANYREQUESTS":       exitTooManyRequests,
+		"UNSUPPORTED":           exitUnsupported,
+		"BLOB_UPLOAD_INVALID":   exitInvalid,
+		"DIGEST_INVALID":        exitInvalid,
+		"MANIFEST_BLOB_UNKNOWN": exitInvalid,
+		"MANIFEST_INVALID":      exitInvalid,
+		"NAME_INVALID":          exitInvalid,
+		"SIZE_INVALID":          exitInvalid,
+		"TAG_INVALID":           exitInvalid,
+	}
+
+	// statusExits maps status codes to exit codes.
+	statusExits = map[int]int{
+		http.StatusNotFound:         exitNotFound,
+		http.StatusUnauthorized:     exitUnauthorized,
+		http.StatusForbidden:        exitUnauthorized,
+		http.StatusTooManyRequests:  exitTooManyRequests,
+		http.StatusMethodNotAllowed: exitUnsupported,
+		http.StatusBadRequest:       exitInvalid,
+	}
+)
+
+type (
+	// command is the environment a command runs in.
+	command struct {
+		ctx    context.Context
+		stdin  io.Reader
+		stdout io.Writer
+		stderr io.Writer
+	}
+
+	// subcommand is a task-oriented command.
+	subcommand struct {
+		name    string
+		args    string
+		summary string
+		run     func(cmd *command, args []string) error
+	}
+
+	// stringList is a flag which may be repeated.
+	stringList []string
+)
+
+// subcommands is initialized in init, since the help subcommand refers to it.
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{"tags", "REFERENCE", "list the tags of a repository", (*command).tags},
+		{"inspect", "REFERENCE", "show a manifest and its config", (*command).inspect},
+		{"pull", "REFERENCE DIRECTORY", "pull an image to an OCI layout directory", (*command).pull},
+		{"push", "DIRECTORY REFERENCE", "push an image from an OCI layout directory", (*command).push},
+		{"copy", "SOURCE DESTINATION", "copy an image between references", (*command).copy},
+		{"delete", "REFERENCE", "delete a tag, or a manifest by digest", (*command).delete},
+		{"blob", "get|put ...", "download or upload a blob", (*command).blob},
+		{"conformance", "REPOSITORY", "run distribution-spec conformance checks", (*command).conformance},
+		{"prune", "REPOSITORY", "delete tags a retention policy does not keep", (*command).prune},
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line args, returning the exit code.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	cmd := &command{ctx: ctx, stdin: stdin, stdout: stdout, stderr: stderr}
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		printUsage(stderr)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+	// subcommands take precedence over lowercase methods, e.g. delete
+	for _, sub := range subcommands {
+		if sub.name == args[0] {
+			return cmd.exit(sub.run(cmd, args[1:]))
+		}
+	}
+	if methods[strings.ToUpper(args[0])] {
+		return cmd.exit(cmd.request(args))
+	}
+	fmt.Fprintf(stderr, "reggie: unknown method or command %q\n", args[0])
+	return exitUsage
+}
+
+func printUsage(w io.Writer) {
+	var commands strings.Builder
+	for _, sub := range subcommands {
+		fmt.Fprintf(&commands, "  %-12s %s\n", sub.name, sub.summary)
+	}
+	fmt.Fprintf(w, usage, commands.String())
+}
+
+// newCommandFlags returns the flag set of a subcommand.
+func newCommandFlags(w io.Writer, name string) *flag.FlagSet {
+	fs := newFlagSet("reggie "+name, w)
+	for _, sub := range subcommands {
+		sub := sub
+		if sub.name == name {
+			fs.Usage = func() {
+				fmt.Fprintf(w, "Usage:\n  reggie %s %s [flags]\n\nFlags:\n", sub.name, sub.args)
+				fs.PrintDefaults()
+			}
+		}
+	}
+	return fs
+}
+
+// exit reports an error and returns the corresponding exit code.
+func (cmd *command) exit(err error) int {
+	var codeErr *codeError
+	var respErr *reggie.ResponseError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(cmd.stderr, "reggie: %s\n", err)
+		return exitUsage
+	case errors.As(err, &codeErr):
+		return codeErr.code
+	}
+	fmt.Fprintf(cmd.stderr, "reggie: %s\n", reggie.RedactError(err))
+	if errors.As(err, &respErr) {
+		return exitCode(respErr.StatusCode, respErr.Errors)
+	}
+	return exitError
+}
+
+// exitCode maps the OCI errors or status code of a response to an exit code.
+func exitCode(status int, errs []reggie.ErrorInfo) int {
+	for _, e := range errs {
+		if code, ok := errorCodeExits[e.Code]; ok {
+			return code
+		}
+	}
+	if code, ok := statusExits[status]; ok {
+		return code
+	}
+	return exitError
+}
+
+// printJSON prints v as indented JSON.
+func (cmd *command) printJSON(v interface{}) error {
+	enc := json.NewEncoder(cmd.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// codeError exits with a code after its output has already been written.
+type codeError struct {
+	code int
+}
+
+// Error satisfies the error interface.
+func (e *codeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// parseInterspersed parses flags which may appear before, between or after
+// positional arguments, returning the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			// the flag set has already reported the error
+			return nil, &codeError{code: exitUsage}
+		}
+		rest := fs.Args()
+		if parsed := len(args) - len(rest); parsed > 0 && args[parsed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bloodorangeio/reggie/reggietest"
+)
+
+// runCommand runs the command line args, returning the exit code and output.
+func runCommand(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRequest(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithTokenAuth("user", "pass"))
+	defer registry.Close()
+	t.Setenv("REGGIE_USERNAME", "user")
+	t.Setenv("REGGIE_PASSWORD", "pass")
+
+	manifest := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`
+	code, _, stderr := runCommand(manifest, "PUT", "/v2/<name>/manifests/<reference>",
+		"--registry", registry.URL, "--name", "org/app", "--reference", "v1",
+		"-H", "Content-Type: application/vnd.oci.image.manifest.v1+json", "-d", "@-")
+	if code != exitOK {
+		t.Fatalf("Expected manifest to be pushed but got exit code %d: %s", code, stderr)
+	}
+
+	// flags may follow the path, which may be a full URL
+	code, stdout, stderr := runCommand("", "get", registry.URL+"/v2/<name>/tags/list", "--name", "org/app", "--query", "n=10")
+	if code != exitOK {
+		t.Fatalf("Expected tags to be listed but got exit code %d: %s", code, stderr)
+	}
+	if !strings.HasPrefix(stdout, "HTTP/1.1 200 OK\n") || !strings.Contains(stdout, "Content-Type: application/json\n") {
+		t.Fatalf("Expected status and headers but got %s", stdout)
+	}
+	if !strings.HasSuffix(stdout, "\n\n{\n  \"name\": \"org/app\",\n  \"tags\": [\n    \"v1\"\n  ]\n}\n") {
+		t.Fatalf("Expected indented JSON body but got %s", stdout)
+	}
+
+	// custom placeholders are substituted into the path and query
+	code, stdout, stderr = runCommand("", "GET", "/v2/<repo>/tags/list?n=<count>",
+		"--registry", registry.URL, "--param", "repo=org/app", "--param", "count=1", "--quiet")
+	if code != exitOK || !strings.Contains(stdout, `"v1"`) {
+		t.Fatalf("Expected tags to be listed but got exit code %d: %s", code, stderr)
+	}
+
+	// OCI errors are reported with the exit code they map to
+	code, stdout, stderr = runCommand("", "GET", "/v2/<name>/manifests/<reference>",
+		"--registry", registry.URL, "--name", "org/app", "--reference", "missing", "--quiet")
+	if code != exitNotFound {
+		t.Fatalf("Expected exit code %d but got %d", exitNotFound, code)
+	}
+	if !strings.HasPrefix(stdout, "{") || !strings.Contains(stderr, "reggie: MANIFEST_UNKNOWN: ") {
+		t.Fatalf("Expected only the body and a parsed error but got %s and %s", stdout, stderr)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		code int
+	}{
+		{nil, exitUsage},
+		{[]string{"--help"}, exitOK},
+		{[]string{"FETCH", "/v2/"}, exitUsage},
+		{[]string{"GET"}, exitUsage},
+		{[]string{"GET", "/v2/"}, exitUsage},
+		{[]string{"GET", "/v2/", "--registry", "localhost:5000", "-H", "invalid"}, exitUsage},
+		{[]string{"GET", "/v2/", "--unknown"}, exitUsage},
+		{[]string{"GET", "/v2/<project>", "--registry", "localhost:5000", "--param", "project"}, exitUsage},
+	} {
+		t.Setenv("REGGIE_REGISTRY", "")
+		if code, _, stderr := runCommand("", test.args...); code != test.code {
+			t.Fatalf("Expected exit code %d for %v but got %d: %s", test.code, test.args, code, stderr)
+		}
+	}
+}
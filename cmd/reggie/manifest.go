@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bloodorangeio/reggie"
+)
+
+type (
+	// manifest holds the fields of image manifests and indexes needed to
+	// walk the content they reference.
+	manifest struct {
+		MediaType string              `json:"mediaType,omitempty"`
+		Config    *reggie.Descriptor  `json:"config,omitempty"`
+		Layers    []reggie.Descriptor `json:"layers,omitempty"`
+		Manifests []indexEntry        `json:"manifests,omitempty"`
+	}
+
+	// indexEntry is a descriptor in an index, with its platform.
+	indexEntry struct {
+		reggie.Descriptor
+		Platform *platform `json:"platform,omitempty"`
+	}
+
+	platform struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant,omitempty"`
+	}
+
+	// fetchedManifest is a manifest with its raw content and descriptor.
+	fetchedManifest struct {
+		manifest
+		Descriptor reggie.Descriptor
+		Content    []byte
+	}
+)
+
+// isIndex returns whether a media type is that of an index.
+func isIndex(mediaType string) bool {
+	return mediaType == reggie.MediaTypeImageIndex || mediaType == reggie.MediaTypeDockerManifestList
+}
+
+// parsePlatform parses a platform of the form os/arch[/variant].
+func parsePlatform(s string) (*platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("%w: platform %q is not of the form os/arch[/variant]", errUsage, s)
+	}
+	p := &platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+func (p *platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// matches returns whether p satisfies the requested platform, ignoring the
+// variant if none was requested.
+func (p *platform) matches(requested *platform) bool {
+	return p != nil && p.OS == requested.OS && p.Architecture == requested.Architecture &&
+		(requested.Variant == "" || p.Variant == requested.Variant)
+}
+
+// fetchManifest fetches and parses a manifest by tag or digest.
+func fetchManifest(ctx context.Context, client *reggie.Client, name string, reference string) (*fetchedManifest, error) {
+	desc, content, err := client.GetManifest(ctx, name, reference)
+	if err != nil {
+		return nil, err
+	}
+	m := &fetchedManifest{Descriptor: desc, Content: content}
+	if err := json.Unmarshal(content, &m.manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s:%s: %w", name, reference, err)
+	}
+	return m, nil
+}
+
+// selectPlatform returns the descriptor in an index matching a platform.
+func selectPlatform(m *fetchedManifest, requested *platform) (reggie.Descriptor, error) {
+	for _, entry := range m.Manifests {
+		if entry.Platform.matches(requested) {
+			return entry.Descriptor, nil
+		}
+	}
+	return reggie.Descriptor{}, fmt.Errorf("no manifest for platform %s in index %s", requested, m.Descriptor.Digest)
+}
+
+// resolve fetches the manifest of a reference, selecting the manifest for a
+// platform from an index if one is requested.
+func resolve(ctx context.Context, client *reggie.Client, ref reggie.Reference, requested *platform) (*fetchedManifest, error) {
+	m, err := fetchManifest(ctx, client, ref.Repository, ref.Reference())
+	if err != nil || requested == nil || !isIndex(m.Descriptor.MediaType) {
+		return m, err
+	}
+	desc, err := selectPlatform(m, requested)
+	if err != nil {
+		return nil, err
+	}
+	return fetchManifest(ctx, client, ref.Repository, desc.Digest)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloodorangeio/reggie/reggieretention"
+)
+
+// prune deletes the tags of a repository which a retention policy does not
+// keep, or only prints the plan with --dry-run.
+func (cmd *command) prune(args []string) error {
+	var policy reggieretention.Policy
+	var keep, versions stringList
+	var maxAge string
+	var concurrency int
+	var dryRun bool
+	f, positional, err := cmd.parseCommand("prune", args, 1, 1, func(fs *flag.FlagSet) {
+		fs.IntVar(&policy.KeepLast, "keep-last", 0, "keep the `n` most recently created tags")
+		fs.Var(&keep, "keep", "keep tags matching the `regexp` (repeatable)")
+		fs.Var(&versions, "keep-version", "keep version tags within the `range`, e.g. \"^1.2\" (repeatable)")
+		fs.StringVar(&maxAge, "max-age", "", "delete tags created longer ago than `age`, e.g. 720h or 30d")
+		fs.BoolVar(&policy.DeleteOrphanedReferrers, "delete-orphaned-referrers", false, "delete referrers whose subject is deleted or gone")
+		fs.IntVar(&concurrency, "concurrency", reggieretention.DefaultConcurrency, "`number` of deletions to run at once")
+		fs.BoolVar(&dryRun, "dry-run", false, "print the plan without deleting anything")
+	})
+	if err != nil {
+		return err
+	}
+	for _, s := range keep {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return fmt.Errorf("%w: invalid --keep expression: %s", errUsage, err)
+		}
+		policy.KeepTags = append(policy.KeepTags, re)
+	}
+	policy.KeepVersions = versions
+	if maxAge != "" {
+		if policy.MaxAge, err = parseAge(maxAge); err != nil {
+			return fmt.Errorf("%w: invalid --max-age %q", errUsage, maxAge)
+		}
+	}
+	client, ref, err := f.clientFor(positional[0])
+	if err != nil {
+		return err
+	}
+	engine, err := reggieretention.NewEngine(client, policy, reggieretention.WithConcurrency(concurrency))
+	if err != nil {
+		return fmt.Errorf("%w: %s", errUsage, err)
+	}
+
+	plan, err := engine.Plan(cmd.ctx, ref.Repository)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		if f.json() {
+			return plan.WriteJSON(cmd.stdout)
+		}
+		return plan.WriteText(cmd.stdout)
+	}
+	report := engine.Execute(cmd.ctx, plan)
+	if f.json() {
+		err = report.WriteJSON(cmd.stdout)
+	} else {
+		err = report.WriteText(cmd.stdout)
+	}
+	if err != nil {
+		return err
+	}
+	if !report.Passed() {
+		return &codeError{code: exitError}
+	}
+	return nil
+}
+
+// parseAge parses a duration, which may also be given in days.
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
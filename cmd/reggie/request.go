@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bloodorangeio/reggie"
+)
+
+// requestFlags are the flags of an ad-hoc request.
+type requestFlags struct {
+	clientFlags
+	name      string
+	reference string
+	digest    string
+	sessionID string
+	params    stringList
+	headers   stringList
+	query     stringList
+	data      string
+	quiet     bool
+}
+
+// newRequestFlags returns the flag set of an ad-hoc request.
+func newRequestFlags(w io.Writer) (*flag.FlagSet, *requestFlags) {
+	f := &requestFlags{}
+	fs := newFlagSet("reggie", w)
+	fs.Usage = func() {
+		fmt.Fprint(w, "Usage:\n  reggie METHOD PATH [flags]\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	f.clientFlags.register(fs)
+	fs.StringVar(&f.name, "name", "", "repository `name` substituted for <name>")
+	fs.StringVar(&f.reference, "reference", "", "tag or digest substituted for <reference>")
+	fs.StringVar(&f.digest, "digest", "", "digest substituted for <digest>")
+	fs.StringVar(&f.sessionID, "session-id", "", "upload session `id` substituted for <session_id>")
+	fs.Var(&f.params, "param", "`placeholder` as key=value, substituted for <key> (repeatable)")
+	fs.Var(&f.headers, "H", "request `header` as \"Name: value\" (repeatable)")
+	fs.Var(&f.query, "query", "query `parameter` as name=value (repeatable)")
+	fs.StringVar(&f.data, "d", "", "request body, @file to read it from a file or @- from stdin")
+	fs.BoolVar(&f.quiet, "quiet", false, "print only the response body")
+	return fs, f
+}
+
+// request makes an ad-hoc request, printing the response. Responses with
+// an error status exit with an error after printing any OCI errors.
+func (cmd *command) request(args []string) error {
+	fs, f := newRequestFlags(cmd.stderr)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("%w: expected METHOD and PATH", errUsage)
+	}
+	method := strings.ToUpper(positional[0])
+	address, path, err := splitURL(positional[1])
+	if err != nil {
+		return err
+	}
+	client, err := f.newClient(address)
+	if err != nil {
+		return err
+	}
+
+	opts := optionList(
+		reggie.WithName(f.name),
+		reggie.WithReference(f.reference),
+		reggie.WithDigest(f.digest),
+		reggie.WithSessionID(f.sessionID))
+	for _, p := range f.params {
+		key, value, ok := strings.Cut(p, "=")
+		if !ok {
+			return fmt.Errorf("%w: placeholder %q is not of the form key=value", errUsage, p)
+		}
+		opts = append(opts, reggie.WithParam(key, value))
+	}
+	req := client.NewRequest(method, path, opts...)
+	for _, h := range f.headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return fmt.Errorf("%w: header %q is not of the form \"Name: value\"", errUsage, h)
+		}
+		req.SetHeader(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	for _, q := range f.query {
+		name, value, ok := strings.Cut(q, "=")
+		if !ok {
+			return fmt.Errorf("%w: query parameter %q is not of the form name=value", errUsage, q)
+		}
+		req.SetQueryParam(name, value)
+	}
+	if f.data != "" {
+		body, err := cmd.readData(f.data)
+		if err != nil {
+			return err
+		}
+		req.SetBody(body)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	if !f.quiet {
+		printHead(cmd.stdout, resp)
+	}
+	printBody(cmd.stdout, resp.Body())
+	if resp.IsError() {
+		errs, _ := resp.Errors()
+		for _, e := range errs {
+			fmt.Fprintf(cmd.stderr, "reggie: %s: %s\n", e.Code, e.Message)
+		}
+		return &codeError{code: exitCode(resp.StatusCode(), errs)}
+	}
+	return nil
+}
+
+// readData reads a request body given as a literal, @file or @- for stdin.
+func (cmd *command) readData(data string) ([]byte, error) {
+	switch {
+	case data == "@-":
+		return io.ReadAll(cmd.stdin)
+	case strings.HasPrefix(data, "@"):
+		return os.ReadFile(data[1:])
+	}
+	return []byte(data), nil
+}
+
+// printHead prints the status line and sorted headers of a response.
+func printHead(w io.Writer, resp *reggie.Response) {
+	fmt.Fprintf(w, "%s %s\n", resp.RawResponse.Proto, resp.Status())
+	names := make([]string, 0, len(resp.Header()))
+	for name := range resp.Header() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range resp.Header()[name] {
+			fmt.Fprintf(w, "%s: %s\n", name, value)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// printBody prints a response body, indenting it if it is JSON.
+func printBody(w io.Writer, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	if json.Valid(body) && json.Indent(&buf, body, "", "  ") == nil {
+		buf.WriteByte('\n')
+		buf.WriteTo(w)
+		return
+	}
+	w.Write(body)
+}
@@ -0,0 +1,193 @@
+package reggie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrDeleteUnsupported is returned when a registry rejects a delete
+	// with 405 Method Not Allowed or an UNSUPPORTED error, as registries do
+	// when deletion is disabled.
+	ErrDeleteUnsupported = errors.New("registry does not support deletes")
+)
+
+type (
+	deleteConfig struct {
+		ManifestFallback bool
+	}
+
+	deleteOption func(c *deleteConfig)
+
+	// DeleteResult reports what a delete removed. Deleting content which
+	// does not exist is not an error, but removes nothing.
+	DeleteResult struct {
+		// Tag is the tag removed, if any.
+		Tag string
+
+		// Manifest is the digest of the manifest removed, if any.
+		// Removing a manifest also removes every tag referring to it.
+		Manifest string
+
+		// Blob is the digest of the blob removed, if any.
+		Blob string
+
+		// NotFound reports whether nothing was removed because the
+		// content did not exist.
+		NotFound bool
+	}
+)
+
+// WithManifestFallback makes DeleteTag delete the manifest a tag refers to
+// when the registry cannot delete the tag alone. This also removes every
+// other tag referring to the manifest.
+func WithManifestFallback() deleteOption {
+	return func(c *deleteConfig) {
+		c.ManifestFallback = true
+	}
+}
+
+// DeleteTag removes a tag from a repository, as the spec prefers. Registries
+// which only delete manifests by digest reject that, in which case DeleteTag
+// fails with ErrDeleteUnsupported, unless WithManifestFallback is given to
+// delete the manifest the tag refers to instead.
+func (client *Client) DeleteTag(ctx context.Context, name string, tag string, opts ...deleteOption) (result *DeleteResult, err error) {
+	ctx, span := client.startOperation(ctx, "DeleteTag", name, "", 0)
+	defer func() { endSpan(span, err) }()
+	conf := &deleteConfig{}
+	for _, o := range opts {
+		o(conf)
+	}
+	if err := client.checkDeletes(func(caps *Capabilities) bool { return caps.ManifestDeletes }); err != nil {
+		return nil, err
+	}
+	desc, err := client.ResolveManifest(ctx, name, tag)
+	if isNotFound(err) {
+		return &DeleteResult{NotFound: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := client.deleteContent(ctx, "/v2/<name>/manifests/<reference>", WithName(name), WithReference(tag))
+	if err == nil {
+		if !deleted {
+			return &DeleteResult{NotFound: true}, nil
+		}
+		return &DeleteResult{Tag: tag}, nil
+	}
+	var respErr *ResponseError
+	if !errors.Is(err, ErrDeleteUnsupported) && !(errors.As(err, &respErr) && respErr.StatusCode == http.StatusBadRequest) {
+		return nil, err
+	}
+	if !conf.ManifestFallback {
+		if !errors.Is(err, ErrDeleteUnsupported) {
+			err = fmt.Errorf("%w: %w", ErrDeleteUnsupported, err)
+		}
+		return nil, err
+	}
+
+	deleted, err = client.deleteContent(ctx, "/v2/<name>/manifests/<reference>", WithName(name), WithReference(desc.Digest))
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return &DeleteResult{NotFound: true}, nil
+	}
+	return &DeleteResult{Tag: tag, Manifest: desc.Digest}, nil
+}
+
+// DeleteManifest removes a manifest, and with it every tag referring to
+// it, from a repository. A tag given as the reference is resolved to the
+// digest of its manifest first, since registries only delete manifests by
+// digest.
+func (client *Client) DeleteManifest(ctx context.Context, name string, reference string) (result *DeleteResult, err error) {
+	ctx, span := client.startOperation(ctx, "DeleteManifest", name, "", 0)
+	defer func() { endSpan(span, err) }()
+	if err := client.checkDeletes(func(caps *Capabilities) bool { return caps.ManifestDeletes }); err != nil {
+		return nil, err
+	}
+	result = &DeleteResult{}
+	digest := reference
+	if !isDigest(reference) {
+		desc, err := client.ResolveManifest(ctx, name, reference)
+		if isNotFound(err) {
+			return &DeleteResult{NotFound: true}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		digest = desc.Digest
+		result.Tag = reference
+	} else if err := validateDigest(reference); err != nil {
+		return nil, err
+	}
+
+	deleted, err := client.deleteContent(ctx, "/v2/<name>/manifests/<reference>", WithName(name), WithReference(digest))
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return &DeleteResult{NotFound: true}, nil
+	}
+	result.Manifest = digest
+	return result, nil
+}
+
+// DeleteBlob removes a blob from a repository.
+func (client *Client) DeleteBlob(ctx context.Context, name string, digest string) (result *DeleteResult, err error) {
+	if err := validateDigest(digest); err != nil {
+		return nil, err
+	}
+	ctx, span := client.startOperation(ctx, "DeleteBlob", name, digest, 0)
+	defer func() { endSpan(span, err) }()
+	if err := client.checkDeletes(func(caps *Capabilities) bool { return caps.Deletes }); err != nil {
+		return nil, err
+	}
+	deleted, err := client.deleteContent(ctx, "/v2/<name>/blobs/<digest>", WithName(name), WithDigest(digest))
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return &DeleteResult{NotFound: true}, nil
+	}
+	return &DeleteResult{Blob: digest}, nil
+}
+
+// deleteContent sends a DELETE request, returning whether it removed
+// anything. Responses rejecting deletes are reported as
+// ErrDeleteUnsupported.
+func (client *Client) deleteContent(ctx context.Context, path string, opts ...requestOption) (bool, error) {
+	resp, err := client.Do(client.NewRequest(DELETE, path, opts...).SetContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	switch resp.StatusCode() {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	respErr := newResponseError(resp)
+	if resp.StatusCode() == http.StatusMethodNotAllowed || respErr.HasCode("UNSUPPORTED") {
+		return false, fmt.Errorf("%w: %w", ErrDeleteUnsupported, respErr)
+	}
+	return false, respErr
+}
+
+// checkDeletes returns ErrDeleteUnsupported if probing found the registry
+// does not support the kind of delete tested by supported.
+func (client *Client) checkDeletes(supported func(caps *Capabilities) bool) error {
+	if !client.allows(supported) {
+		return ErrDeleteUnsupported
+	}
+	return nil
+}
+
+// isNotFound returns whether err is a response error with status 404.
+func isNotFound(err error) bool {
+	var respErr *ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
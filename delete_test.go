@@ -0,0 +1,146 @@
+package reggie
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/bloodorangeio/reggie/reggietest"
+)
+
+const testManifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`
+
+func TestDeleteTag(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		name     string
+		opts     []reggietest.Option
+		manifest bool
+	}{
+		{"by tag", nil, false},
+		{"by digest", []reggietest.Option{reggietest.WithTagDeletesDisabled()}, true},
+	} {
+		registry := reggietest.NewRegistry(test.opts...)
+		defer registry.Close()
+		digest, err := registry.PutManifest("org/app", "v1", MediaTypeImageManifest, []byte(testManifest))
+		if err != nil {
+			t.Fatalf("Errors storing manifest: %s", err)
+		}
+		client, _ := NewClient(registry.URL)
+
+		if _, err := client.DeleteTag(ctx, "org/app", "v1"); test.manifest != errors.Is(err, ErrDeleteUnsupported) {
+			t.Fatalf("Unexpected error deleting only the tag %s: %v", test.name, err)
+		}
+		if _, ok := registry.Manifest("org/app", "v1"); ok != test.manifest {
+			t.Fatalf("Expected tag to be deleted only when it can be deleted alone")
+		}
+		registry.PutManifest("org/app", "v1", MediaTypeImageManifest, []byte(testManifest))
+
+		result, err := client.DeleteTag(ctx, "org/app", "v1", WithManifestFallback())
+		if err != nil {
+			t.Fatalf("Errors deleting tag %s: %s", test.name, err)
+		}
+		if result.Tag != "v1" || (result.Manifest == digest) != test.manifest {
+			t.Fatalf("Unexpected result deleting tag %s: %+v", test.name, result)
+		}
+		if _, ok := registry.Manifest("org/app", "v1"); ok {
+			t.Fatalf("Expected tag to be deleted %s", test.name)
+		}
+		if _, ok := registry.Manifest("org/app", digest); ok != !test.manifest {
+			t.Fatalf("Expected manifest to be kept only when deleting by tag")
+		}
+
+		result, err = client.DeleteTag(ctx, "org/app", "v1")
+		if err != nil || !result.NotFound {
+			t.Fatalf("Expected missing tag to be reported but got %+v: %v", result, err)
+		}
+	}
+}
+
+func TestDeleteManifestAndBlob(t *testing.T) {
+	ctx := context.Background()
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	digest, err := registry.PutManifest("org/app", "v1", MediaTypeImageManifest, []byte(testManifest))
+	if err != nil {
+		t.Fatalf("Errors storing manifest: %s", err)
+	}
+	blob := registry.PutBlob("org/app", []byte("layer"))
+	client, _ := NewClient(registry.URL)
+
+	desc, err := client.ResolveManifest(ctx, "org/app", "v1")
+	if err != nil || desc.Digest != digest || desc.MediaType != MediaTypeImageManifest || desc.Size != int64(len(testManifest)) {
+		t.Fatalf("Unexpected descriptor %+v: %v", desc, err)
+	}
+
+	result, err := client.DeleteManifest(ctx, "org/app", "v1")
+	if err != nil || result.Tag != "v1" || result.Manifest != digest {
+		t.Fatalf("Expected manifest to be deleted but got %+v: %v", result, err)
+	}
+	if result, err = client.DeleteManifest(ctx, "org/app", digest); err != nil || !result.NotFound {
+		t.Fatalf("Expected missing manifest to be reported but got %+v: %v", result, err)
+	}
+
+	result, err = client.DeleteBlob(ctx, "org/app", blob)
+	if err != nil || result.Blob != blob {
+		t.Fatalf("Expected blob to be deleted but got %+v: %v", result, err)
+	}
+	if result, err = client.DeleteBlob(ctx, "org/app", blob); err != nil || !result.NotFound {
+		t.Fatalf("Expected missing blob to be reported but got %+v: %v", result, err)
+	}
+	if _, err := client.DeleteBlob(ctx, "org/app", "sha256:invalid"); err == nil {
+		t.Fatalf("Expected invalid digest to be rejected")
+	}
+}
+
+func TestDeleteUnsupported(t *testing.T) {
+	ctx := context.Background()
+	registry := reggietest.NewRegistry(reggietest.WithDeletesDisabled())
+	defer registry.Close()
+	registry.PutManifest("org/app", "v1", MediaTypeImageManifest, []byte(testManifest))
+	blob := registry.PutBlob("org/app", []byte("layer"))
+	client, _ := NewClient(registry.URL)
+
+	if _, err := client.DeleteTag(ctx, "org/app", "v1"); !errors.Is(err, ErrDeleteUnsupported) {
+		t.Fatalf("Expected ErrDeleteUnsupported but got %v", err)
+	}
+	var respErr *ResponseError
+	if _, err := client.DeleteBlob(ctx, "org/app", blob); !errors.Is(err, ErrDeleteUnsupported) || !errors.As(err, &respErr) {
+		t.Fatalf("Expected ErrDeleteUnsupported wrapping the response error but got %v", err)
+	}
+
+	// probed registries are not asked
+	if _, err := client.Probe(ctx, WithScratchRepository("probe/scratch")); err != nil {
+		t.Fatalf("Errors probing registry: %s", err)
+	}
+	requests := len(registry.Requests())
+	if _, err := client.DeleteBlob(ctx, "org/app", blob); !errors.Is(err, ErrDeleteUnsupported) || len(registry.Requests()) != requests {
+		t.Fatalf("Expected delete to fail without requests but got %v", err)
+	}
+}
+
+func TestDeleteBlobsDisabled(t *testing.T) {
+	ctx := context.Background()
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	registry.InjectFault(reggietest.Fault{Method: DELETE, Path: "/blobs/", Status: http.StatusMethodNotAllowed, Code: "UNSUPPORTED"})
+	registry.PutManifest("org/app", "v1", MediaTypeImageManifest, []byte(testManifest))
+	blob := registry.PutBlob("org/app", []byte("layer"))
+	client, _ := NewClient(registry.URL)
+
+	caps, err := client.Probe(ctx, WithScratchRepository("probe/scratch"))
+	if err != nil {
+		t.Fatalf("Errors probing registry: %s", err)
+	}
+	if caps.Deletes || !caps.ManifestDeletes {
+		t.Fatalf("Expected only manifest deletes to be supported but got %+v", caps)
+	}
+	if result, err := client.DeleteTag(ctx, "org/app", "v1"); err != nil || result.Tag != "v1" {
+		t.Fatalf("Expected tag to be deleted but got %+v: %v", result, err)
+	}
+	requests := len(registry.Requests())
+	if _, err := client.DeleteBlob(ctx, "org/app", blob); !errors.Is(err, ErrDeleteUnsupported) || len(registry.Requests()) != requests {
+		t.Fatalf("Expected blob delete to fail without requests but got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package reggie
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"regexp"
+	"strings"
+)
+
+var (
+	digestMatcher = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+)
+
+type (
+	// Descriptor describes a piece of content stored in a registry.
+	Descriptor struct {
+		MediaType    string            `json:"mediaType,omitempty"`
+		ArtifactType string            `json:"artifactType,omitempty"`
+		Digest       string            `json:"digest"`
+		Size         int64             `json:"size"`
+		Annotations  map[string]string `json:"annotations,omitempty"`
+	}
+
+	// digestVerifier hashes content as it is written and compares the
+	// result against an expected digest.
+	digestVerifier struct {
+		hash.Hash
+		expected string
+		written  int64
+	}
+)
+
+// DigestFromBytes returns the sha256 digest of the provided content.
+func DigestFromBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Verify returns an error if content does not match the digest of the
+// descriptor, using the digest's algorithm, or its size unless negative.
+func (d Descriptor) Verify(content []byte) error {
+	v, err := newDigestVerifier(d.Digest)
+	if err != nil {
+		return err
+	}
+	v.Write(content)
+	return v.verify(d.Size)
+}
+
+// validateDigest checks that a digest is well-formed and uses a supported algorithm.
+func validateDigest(digest string) error {
+	if !digestMatcher.MatchString(digest) {
+		return fmt.Errorf("invalid digest %q", digest)
+	}
+	if _, err := newDigestVerifier(digest); err != nil {
+		return err
+	}
+	return nil
+}
+
+func newDigestVerifier(digest string) (*digestVerifier, error) {
+	algorithm, encoded, _ := strings.Cut(digest, ":")
+	var h hash.Hash
+	var size int
+	switch algorithm {
+	case "sha256":
+		h, size = sha256.New(), sha256.Size
+	case "sha512":
+		h, size = sha512.New(), sha512.Size
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+	if len(encoded) != hex.EncodedLen(size) {
+		return nil, fmt.Errorf("invalid digest %q", digest)
+	}
+	return &digestVerifier{Hash: h, expected: digest}, nil
+}
+
+func (v *digestVerifier) Write(p []byte) (int, error) {
+	n, err := v.Hash.Write(p)
+	v.written += int64(n)
+	return n, err
+}
+
+// verify returns an error if the content written does not match the
+// expected digest, or the expected size when size is not negative.
+func (v *digestVerifier) verify(size int64) error {
+	if size >= 0 && v.written != size {
+		return fmt.Errorf("size mismatch for %s: expected %d bytes, got %d", v.expected, size, v.written)
+	}
+	actual := v.digest()
+	if actual != v.expected {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", v.expected, actual)
+	}
+	return nil
+}
+
+// digest returns the digest of the content written, using the algorithm of
+// the expected digest.
+func (v *digestVerifier) digest() string {
+	algorithm, _, _ := strings.Cut(v.expected, ":")
+	return algorithm + ":" + hex.EncodeToString(v.Sum(nil))
+}
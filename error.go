@@ -1,5 +1,15 @@
 package reggie
 
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxErrorBodySize limits how much of an unparsed response body is read
+// when looking for OCI errors.
+const maxErrorBodySize = 1 << 16
+
 type (
 	ErrorResponse struct {
 		Errors []ErrorInfo `json:"errors"`
@@ -11,4 +21,54 @@ type (
 		Message string      `json:"message"`
 		Detail  interface{} `json:"detail"`
 	}
+
+	// ResponseError is returned by high-level operations when a registry
+	// responds with an unexpected status code.
+	ResponseError struct {
+		Method     string
+		URL        string
+		StatusCode int
+		Errors     []ErrorInfo
+	}
 )
+
+// newResponseError builds a ResponseError from a response, parsing any
+// OCI errors contained in the body.
+func newResponseError(resp *Response) *ResponseError {
+	e := &ResponseError{StatusCode: resp.StatusCode()}
+	if req := resp.Request; req != nil {
+		e.Method = req.Method
+		e.URL = req.URL
+	}
+	body := resp.Body()
+	if len(body) == 0 && resp.RawResponse != nil && resp.RawResponse.Body != nil {
+		body, _ = io.ReadAll(io.LimitReader(resp.RawResponse.Body, maxErrorBodySize))
+	}
+	if errs, err := parseErrors(body); err == nil {
+		e.Errors = errs
+	}
+	return e
+}
+
+// Error satisfies the error interface.
+func (e *ResponseError) Error() string {
+	msg := fmt.Sprintf("%s %s: unexpected status code %d", e.Method, e.URL, e.StatusCode)
+	if len(e.Errors) == 0 {
+		return msg
+	}
+	details := make([]string, 0, len(e.Errors))
+	for _, info := range e.Errors {
+		details = append(details, fmt.Sprintf("%s: %s", info.Code, info.Message))
+	}
+	return msg + " (" + strings.Join(details, "; ") + ")"
+}
+
+// HasCode returns whether the registry reported an error with the given code.
+func (e *ResponseError) HasCode(code string) bool {
+	for _, info := range e.Errors {
+		if info.Code == code {
+			return true
+		}
+	}
+	return false
+}
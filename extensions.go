@@ -0,0 +1,155 @@
+package reggie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Endpoints of the OCI extensions proposal, registered on every client.
+const (
+	// ExtensionDiscover lists the extensions of the registry.
+	ExtensionDiscover = "_oci/ext/discover"
+
+	// ExtensionRepositoryDiscover lists the extensions of a repository.
+	ExtensionRepositoryDiscover = "<name>/_oci/ext/discover"
+)
+
+type (
+	// Extension describes an extension supported by a registry or
+	// repository, as listed by the discover endpoint.
+	Extension struct {
+		Name        string   `json:"name"`
+		URL         string   `json:"url,omitempty"`
+		Description string   `json:"description,omitempty"`
+		Endpoints   []string `json:"endpoints,omitempty"`
+	}
+
+	// ExtensionEndpoint is an endpoint of an extension, called by name with
+	// NewExtensionRequest. Path may contain the same placeholders as the
+	// path given to NewRequest, such as <name> and <digest>.
+	ExtensionEndpoint struct {
+		Name   string
+		Method string
+		Path   string
+	}
+
+	extensionList struct {
+		Extensions []Extension `json:"extensions"`
+	}
+)
+
+// builtinExtensionEndpoints are the endpoints of the extensions proposal.
+var builtinExtensionEndpoints = []ExtensionEndpoint{
+	{Name: ExtensionDiscover, Method: GET, Path: "/v2/_oci/ext/discover"},
+	{Name: ExtensionRepositoryDiscover, Method: GET, Path: "/v2/<name>/_oci/ext/discover"},
+}
+
+// WithExtensionEndpoints registers endpoints of vendor extensions, to be
+// called with NewExtensionRequest.
+func WithExtensionEndpoints(endpoints ...ExtensionEndpoint) clientOption {
+	return func(c *clientConfig) {
+		c.ExtensionEndpoints = append(c.ExtensionEndpoints, endpoints...)
+	}
+}
+
+// validate the extension endpoint.
+func (ep ExtensionEndpoint) validate() error {
+	if ep.Name == "" {
+		return fmt.Errorf("extension endpoint name is required")
+	}
+	if !strings.HasPrefix(ep.Path, "/v2/") {
+		return fmt.Errorf("path of extension endpoint %s must start with /v2/", ep.Name)
+	}
+	return nil
+}
+
+// RegisterExtensionEndpoint registers an endpoint of a vendor extension,
+// replacing any endpoint registered with the same name. Method defaults to
+// GET.
+func (client *Client) RegisterExtensionEndpoint(ep ExtensionEndpoint) error {
+	if err := ep.validate(); err != nil {
+		return err
+	}
+	if ep.Method == "" {
+		ep.Method = GET
+	}
+	client.extMu.Lock()
+	defer client.extMu.Unlock()
+	if client.extensions == nil {
+		client.extensions = map[string]ExtensionEndpoint{}
+	}
+	client.extensions[ep.Name] = ep
+	return nil
+}
+
+// ExtensionEndpoint returns the endpoint registered with the given name.
+func (client *Client) ExtensionEndpoint(name string) (ExtensionEndpoint, bool) {
+	client.extMu.Lock()
+	defer client.extMu.Unlock()
+	ep, ok := client.extensions[name]
+	return ep, ok
+}
+
+// NewExtensionRequest builds a new Request for the extension endpoint
+// registered with the given name, substituting placeholders in its path as
+// NewRequest does.
+func (client *Client) NewExtensionRequest(endpoint string, opts ...requestOption) (*Request, error) {
+	ep, ok := client.ExtensionEndpoint(endpoint)
+	if !ok {
+		return nil, fmt.Errorf("unknown extension endpoint %s", endpoint)
+	}
+	return client.NewRequest(ep.Method, ep.Path, opts...), nil
+}
+
+// DiscoverExtensions lists the extensions supported by the registry. A
+// registry which does not implement discovery has no extensions.
+func (client *Client) DiscoverExtensions(ctx context.Context) (exts []Extension, err error) {
+	ctx, span := client.startOperation(ctx, "DiscoverExtensions", "", "", 0)
+	defer func() { endSpan(span, err) }()
+	return client.discoverExtensions(ctx, ExtensionDiscover)
+}
+
+// DiscoverRepositoryExtensions lists the extensions supported by a
+// repository. A registry which does not implement discovery has no
+// extensions.
+func (client *Client) DiscoverRepositoryExtensions(ctx context.Context, name string) (exts []Extension, err error) {
+	ctx, span := client.startOperation(ctx, "DiscoverRepositoryExtensions", name, "", 0)
+	defer func() { endSpan(span, err) }()
+	return client.discoverExtensions(ctx, ExtensionRepositoryDiscover, WithName(name))
+}
+
+func (client *Client) discoverExtensions(ctx context.Context, endpoint string, opts ...requestOption) ([]Extension, error) {
+	req, err := client.NewExtensionRequest(endpoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.SetContext(ctx).SetHeader("Accept", "application/json"))
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode() {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, newResponseError(resp)
+	}
+	var list extensionList
+	if err := json.Unmarshal(resp.Body(), &list); err != nil {
+		return nil, fmt.Errorf("parsing extensions: %w", err)
+	}
+	return list.Extensions, nil
+}
+
+// FindExtension returns the extension with the given name.
+func FindExtension(extensions []Extension, name string) (Extension, bool) {
+	for _, ext := range extensions {
+		if ext.Name == name {
+			return ext, true
+		}
+	}
+	return Extension{}, false
+}
@@ -0,0 +1,81 @@
+package reggie
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bloodorangeio/reggie/reggietest"
+)
+
+func TestDiscoverExtensions(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithExtensions(reggietest.Extension{
+		Name:        "_oci",
+		Description: "OCI extensions",
+		Endpoints:   []string{"_oci/ext/discover"},
+	}))
+	defer registry.Close()
+	client, err := NewClient(registry.URL)
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	exts, err := client.DiscoverExtensions(context.Background())
+	if err != nil {
+		t.Fatalf("Errors discovering extensions: %s", err)
+	}
+	if ext, ok := FindExtension(exts, "_oci"); !ok || len(ext.Endpoints) != 1 || ext.Endpoints[0] != ExtensionDiscover {
+		t.Fatalf("Expected _oci extension but got %+v", exts)
+	}
+	exts, err = client.DiscoverRepositoryExtensions(context.Background(), "org/app")
+	if err != nil || len(exts) != 1 {
+		t.Fatalf("Expected repository extensions but got %+v: %v", exts, err)
+	}
+
+	// registries without discovery have no extensions
+	plain := reggietest.NewRegistry()
+	defer plain.Close()
+	client, _ = NewClient(plain.URL)
+	if exts, err := client.DiscoverExtensions(context.Background()); err != nil || exts != nil {
+		t.Fatalf("Expected no extensions but got %+v: %v", exts, err)
+	}
+}
+
+func TestExtensionEndpoints(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != POST || r.URL.Path != "/v2/org/app/_acme/ext/sign/sha256:abc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, WithExtensionEndpoints(
+		ExtensionEndpoint{Name: "acme.sign", Method: POST, Path: "/v2/<name>/_acme/ext/sign/<digest>"}))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	req, err := client.NewExtensionRequest("acme.sign", WithName("org/app"), WithDigest("sha256:abc"))
+	if err != nil {
+		t.Fatalf("Errors building extension request: %s", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil || resp.StatusCode() != http.StatusCreated {
+		t.Fatalf("Expected extension endpoint to be called but got %v", err)
+	}
+
+	if _, err := client.NewExtensionRequest("acme.search"); err == nil {
+		t.Fatalf("Expected unknown extension endpoint to fail")
+	}
+	if err := client.RegisterExtensionEndpoint(ExtensionEndpoint{Name: "acme.search", Path: "/search"}); err == nil {
+		t.Fatalf("Expected path outside /v2/ to be rejected")
+	}
+	if err := client.RegisterExtensionEndpoint(ExtensionEndpoint{Name: "acme.search", Path: "/v2/_acme/ext/search"}); err != nil {
+		t.Fatalf("Errors registering extension endpoint: %s", err)
+	}
+	if ep, ok := client.ExtensionEndpoint("acme.search"); !ok || ep.Method != GET {
+		t.Fatalf("Expected method to default to GET but got %+v", ep)
+	}
+}
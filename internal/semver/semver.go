@@ -0,0 +1,244 @@
+// Package semver parses semantic versions and the version ranges of npm and
+// Helm, as used in tags.
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Version is a semantic version parsed from a tag.
+	Version struct {
+		major, minor, patch int
+		pre                 []string
+	}
+
+	// Range is a set of alternative constraint sets, any of which a
+	// version must satisfy all constraints of.
+	Range [][]constraint
+
+	constraint struct {
+		op string
+		v  Version
+	}
+)
+
+// Parse parses a version of the form [v]MAJOR.MINOR.PATCH, with an optional
+// pre-release and build metadata.
+func Parse(s string) (Version, bool) {
+	v, parts, ok := parsePartial(s)
+	return v, ok && parts == 3
+}
+
+// parsePartial parses a version which may omit its minor and patch
+// numbers, or give them as x or *, returning how many numbers were given.
+func parsePartial(s string) (Version, int, bool) {
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, pre, hasPre := strings.Cut(s, "-")
+	var v Version
+	if hasPre {
+		if pre == "" {
+			return Version{}, 0, false
+		}
+		v.pre = strings.Split(pre, ".")
+	}
+	numbers := strings.Split(s, ".")
+	if len(numbers) > 3 {
+		return Version{}, 0, false
+	}
+	parts := 0
+	for i, n := range numbers {
+		if n == "x" || n == "X" || n == "*" {
+			break
+		}
+		value, err := strconv.Atoi(n)
+		if err != nil || value < 0 || len(n) > 1 && n[0] == '0' {
+			return Version{}, 0, false
+		}
+		switch i {
+		case 0:
+			v.major = value
+		case 1:
+			v.minor = value
+		case 2:
+			v.patch = value
+		}
+		parts++
+	}
+	if hasPre && parts != 3 {
+		return Version{}, 0, false
+	}
+	return v, parts, true
+}
+
+// PreRelease returns whether v is a pre-release.
+func (v Version) PreRelease() bool {
+	return len(v.pre) > 0
+}
+
+// Compare returns -1, 0 or 1 as v is lower than, equal to or greater than o.
+// Pre-releases are lower than their release.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case len(v.pre) == 0 && len(o.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1
+	case len(o.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.pre) && i < len(o.pre); i++ {
+		a, aErr := strconv.Atoi(v.pre[i])
+		b, bErr := strconv.Atoi(o.pre[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if a != b {
+				return sign(a - b)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(v.pre[i], o.pre[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(v.pre) - len(o.pre))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// ParseRange parses a range such as ">=1.2.0 <2.0.0", "^1.4", "~1.2.3",
+// "1.x" or "1.2.0 || 1.3.x". Constraints within an alternative are separated
+// by spaces or commas.
+func ParseRange(s string) (Range, error) {
+	var r Range
+	for _, alt := range strings.Split(s, "||") {
+		var set []constraint
+		for _, field := range strings.FieldsFunc(alt, func(c rune) bool { return c == ' ' || c == ',' }) {
+			cs, err := parseConstraint(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version range %q: %w", s, err)
+			}
+			set = append(set, cs...)
+		}
+		if len(set) == 0 {
+			return nil, fmt.Errorf("invalid version range %q", s)
+		}
+		r = append(r, set)
+	}
+	return r, nil
+}
+
+// parseConstraint parses a single constraint, expanding the shorthands for
+// ranges into a lower and an upper bound.
+func parseConstraint(s string) ([]constraint, error) {
+	if s == "*" || s == "x" {
+		return []constraint{{op: ">=", v: Version{}}}, nil
+	}
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, prefix) {
+			op, s = prefix, s[len(prefix):]
+			break
+		}
+	}
+	v, parts, ok := parsePartial(s)
+	if !ok || parts == 0 {
+		return nil, fmt.Errorf("invalid version %q", s)
+	}
+
+	// the exclusive upper bound of a partial or shorthand version
+	upper := func(parts int) Version {
+		switch parts {
+		case 1:
+			return Version{major: v.major + 1}
+		case 2:
+			return Version{major: v.major, minor: v.minor + 1}
+		}
+		return Version{major: v.major, minor: v.minor, patch: v.patch + 1}
+	}
+	switch op {
+	case "^":
+		bound := 1
+		if v.major == 0 && parts > 1 {
+			bound = 2
+			if v.minor == 0 && parts > 2 {
+				bound = 3
+			}
+		}
+		return []constraint{{">=", v}, {"<", upper(bound)}}, nil
+	case "~":
+		bound := 2
+		if parts == 1 {
+			bound = 1
+		}
+		return []constraint{{">=", v}, {"<", upper(bound)}}, nil
+	case "", "=":
+		if parts < 3 {
+			return []constraint{{">=", v}, {"<", upper(parts)}}, nil
+		}
+		return []constraint{{"=", v}}, nil
+	case ">":
+		if parts < 3 {
+			return []constraint{{">=", upper(parts)}}, nil
+		}
+	case "<=":
+		if parts < 3 {
+			return []constraint{{"<", upper(parts)}}, nil
+		}
+	}
+	return []constraint{{op, v}}, nil
+}
+
+// Contains returns whether v satisfies the range.
+func (r Range) Contains(v Version) bool {
+	for _, set := range r {
+		ok := true
+		for _, c := range set {
+			if !c.satisfied(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c constraint) satisfied(v Version) bool {
+	cmp := v.Compare(c.v)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package semver
+
+import "testing"
+
+func TestVersionRanges(t *testing.T) {
+	for _, test := range []struct {
+		r        string
+		version  string
+		contains bool
+	}{
+		{"^1.2", "1.9.0", true},
+		{"^1.2", "2.0.0", false},
+		{"^1.2", "1.1.9", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"1.x", "v1.4.2", true},
+		{"1.x", "2.0.0", false},
+		{">=1.2.0 <2.0.0", "1.10.0", true},
+		{">=1.2.0, <2.0.0", "2.0.0", false},
+		{">1.2", "1.2.5", false},
+		{">1.2", "1.3.0", true},
+		{"<=1.2", "1.2.5", true},
+		{"1.0.0 || 3.x", "3.1.0", true},
+		{"1.0.0 || 3.x", "2.0.0", false},
+		{">=1.0.0", "1.0.0-rc.1", false},
+		{"<1.0.0", "1.0.0-rc.1", true},
+		{"*", "0.0.1", true},
+	} {
+		r, err := ParseRange(test.r)
+		if err != nil {
+			t.Fatalf("Errors parsing range %q: %s", test.r, err)
+		}
+		v, ok := Parse(test.version)
+		if !ok {
+			t.Fatalf("Errors parsing version %q", test.version)
+		}
+		if r.Contains(v) != test.contains {
+			t.Fatalf("Expected %q contains %q to be %t", test.r, test.version, test.contains)
+		}
+	}
+	for _, s := range []string{"latest", "1.2", "01.2.3", "1.2.3-"} {
+		if _, ok := Parse(s); ok {
+			t.Fatalf("Expected %q not to be a version", s)
+		}
+	}
+	v1, _ := Parse("1.0.0-alpha.2")
+	v2, _ := Parse("1.0.0-alpha.10")
+	if v1.Compare(v2) != -1 {
+		t.Fatalf("Expected numeric pre-release identifiers to compare numerically")
+	}
+}
@@ -0,0 +1,131 @@
+package reggie
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// Limiter is a token bucket which refills at a fixed rate up to a maximum
+	// burst. It is safe for concurrent use, so a single Limiter may be shared
+	// between multiple clients to enforce a combined limit.
+	Limiter struct {
+		rate  float64
+		burst float64
+
+		mu     sync.Mutex
+		tokens float64
+		last   time.Time
+	}
+
+	// limitedTransport applies request rate and bandwidth limits around
+	// another http.RoundTripper.
+	limitedTransport struct {
+		next      http.RoundTripper
+		requests  *Limiter
+		bandwidth *Limiter
+	}
+
+	// limitedReader throttles reads to the rate of a bandwidth Limiter.
+	limitedReader struct {
+		ctx     context.Context
+		rc      io.ReadCloser
+		limiter *Limiter
+	}
+)
+
+// NewLimiter builds a new Limiter allowing rate events per second, with bursts
+// of at most burst events. The bucket starts full. A rate of zero or less
+// means unlimited, for which NewLimiter returns nil.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if rate <= 0 || math.IsNaN(rate) {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Burst returns the maximum number of events allowed at once.
+func (l *Limiter) Burst() int {
+	return int(l.burst)
+}
+
+// WaitN blocks until n events are allowed or ctx is done. n must not exceed
+// the burst of the Limiter. A nil Limiter allows all events.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens >= float64(n) {
+			l.tokens -= float64(n)
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((float64(n) - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if t.requests != nil {
+		if err := t.requests.WaitN(ctx, 1); err != nil {
+			return nil, err
+		}
+	}
+	if t.bandwidth != nil && req.Body != nil && req.Body != http.NoBody {
+		limited := *req
+		limited.Body = &limitedReader{ctx: ctx, rc: req.Body, limiter: t.bandwidth}
+		req = &limited
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if t.bandwidth != nil && resp.Body != nil {
+		resp.Body = &limitedReader{ctx: ctx, rc: resp.Body, limiter: t.bandwidth}
+	}
+	return resp, nil
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if burst := r.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.rc.Read(p)
+	if n > 0 {
+		if werr := r.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (r *limitedReader) Close() error {
+	return r.rc.Close()
+}
@@ -0,0 +1,113 @@
+package reggie
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiterWaitN(t *testing.T) {
+	l := NewLimiter(100, 10)
+
+	// the bucket starts full
+	start := time.Now()
+	if err := l.WaitN(context.Background(), 10); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Fatalf("Expected full bucket to allow burst immediately but waited %s", elapsed)
+	}
+
+	// refilling 10 tokens at 100/s takes about 100ms
+	start = time.Now()
+	if err := l.WaitN(context.Background(), 10); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("Expected to wait for tokens but waited %s", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.WaitN(ctx, 10); err != context.DeadlineExceeded {
+		t.Fatalf("Expected deadline exceeded but got %v", err)
+	}
+}
+
+func TestClientLimits(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 40*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	// two clients sharing a limiter of 10 requests per second with no burst
+	shared := NewLimiter(10, 1)
+	client1, err := NewClient(server.URL, WithRateLimiter(shared))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	client2, err := NewClient(server.URL, WithRateLimiter(shared))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	start := time.Now()
+	for _, client := range []*Client{client1, client2, client1, client2} {
+		if _, err := client.Do(client.NewRequest(GET, "/v2/")); err != nil {
+			t.Fatalf("Errors executing request: %s", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Fatalf("Expected shared rate limit to apply across clients but took %s", elapsed)
+	}
+
+	// 40KiB at 100KiB/s, after an initial 10KiB burst, takes about 300ms
+	client, err := NewClient(server.URL, WithBandwidthLimiter(NewLimiter(100*1024, 10*1024)))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	start = time.Now()
+	resp, err := client.Do(client.NewRequest(GET, "/v2/"))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if len(resp.Body()) != len(body) {
+		t.Fatalf("Expected %d bytes but got %d", len(body), len(resp.Body()))
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Fatalf("Expected bandwidth limit to slow down response but took %s", elapsed)
+	}
+}
+
+func TestZeroLimitsAreUnlimited(t *testing.T) {
+	for _, rate := range []float64{0, -1} {
+		if l := NewLimiter(rate, 10); l != nil {
+			t.Fatalf("Expected rate %v to mean unlimited but got a limiter", rate)
+		}
+	}
+	var l *Limiter
+	if err := l.WaitN(context.Background(), 1000); err != nil {
+		t.Fatalf("Expected nil limiter to allow all events but got %s", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("x"), 1024))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL, WithRateLimit(0, 1), WithBandwidthLimit(0))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := client.Do(client.NewRequest(GET, "/v2/").SetContext(ctx))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if len(resp.Body()) != 1024 {
+		t.Fatalf("Expected 1024 bytes but got %d", len(resp.Body()))
+	}
+}
@@ -0,0 +1,306 @@
+package reggie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	// redacted replaces secrets in log records.
+	redacted = "REDACTED"
+)
+
+var (
+	// safeQueryParams are query parameters used by the distribution spec,
+	// which are logged as is. The values of any other query parameters,
+	// such as the signatures of pre-signed storage URLs, are redacted.
+	safeQueryParams = map[string]bool{
+		"digest":       true,
+		"mount":        true,
+		"from":         true,
+		"n":            true,
+		"last":         true,
+		"service":      true,
+		"scope":        true,
+		"artifactType": true,
+	}
+
+	// secretHeaders are headers whose values are redacted.
+	secretHeaders = map[string]bool{
+		"Authorization":       true,
+		"Proxy-Authorization": true,
+		"Cookie":              true,
+		"Set-Cookie":          true,
+		"X-Registry-Auth":     true,
+	}
+
+	// secretFields are fields of JSON response bodies, such as those of
+	// token servers, whose values are redacted.
+	secretFields = []string{"token", "access_token", "refresh_token"}
+)
+
+type (
+	// discardHandler is a slog.Handler which drops all records.
+	discardHandler struct{}
+
+	// restyLogger routes the warnings and errors of resty, and its debug
+	// output with secrets redacted, to a slog.Logger.
+	restyLogger struct {
+		logger *slog.Logger
+	}
+)
+
+// WithLogger logs each request made by the client, and the token requests
+// made to authenticate them, to logger. Credentials, tokens and the query
+// strings of pre-signed storage URLs are always redacted.
+func WithLogger(logger *slog.Logger) clientOption {
+	return func(c *clientConfig) {
+		c.Logger = logger
+	}
+}
+
+// WithLogLevel sets the level of records for requests which received a
+// response. Defaults to slog.LevelDebug.
+func WithLogLevel(level slog.Level) clientOption {
+	return func(c *clientConfig) {
+		c.LogLevel = &level
+	}
+}
+
+// WithErrorLogLevel sets the level of records for requests which failed
+// without a response or received a server error. Defaults to slog.LevelWarn.
+func WithErrorLogLevel(level slog.Level) clientOption {
+	return func(c *clientConfig) {
+		c.ErrorLogLevel = &level
+	}
+}
+
+// WithLogHeaders includes request and response headers in log records, with
+// the values of headers carrying credentials redacted.
+func WithLogHeaders(logHeaders bool) clientOption {
+	return func(c *clientConfig) {
+		c.LogHeaders = logHeaders
+	}
+}
+
+// logger returns the configured logger, falling back to one which discards
+// all records, or logs to stderr at debug level when debug mode is enabled.
+func (c *clientConfig) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	if c.Debug {
+		return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	return slog.New(discardHandler{})
+}
+
+func (c *clientConfig) logLevel() slog.Level {
+	if c.LogLevel != nil {
+		return *c.LogLevel
+	}
+	return slog.LevelDebug
+}
+
+func (c *clientConfig) errorLogLevel() slog.Level {
+	if c.ErrorLogLevel != nil {
+		return *c.ErrorLogLevel
+	}
+	return slog.LevelWarn
+}
+
+// logRequest logs the outcome of a request executed by Do.
+func (client *Client) logRequest(req *Request, resp *Response, err error, duration time.Duration) {
+	ctx := req.Request.Context()
+	level := client.Config.logLevel()
+	if err != nil || resp == nil || resp.StatusCode() >= http.StatusInternalServerError {
+		level = client.Config.errorLogLevel()
+	}
+	if !client.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", RedactURL(req.URL)),
+		slog.Duration("duration", duration),
+		slog.Int("retries", req.retries()),
+		slog.String("auth", authScheme(req)),
+	}
+	if resp != nil {
+		attrs = append(attrs,
+			slog.Int("status", resp.StatusCode()),
+			slog.String("endpoint", resp.Endpoint()))
+		if raw := resp.RawResponse; raw != nil && raw.Request != nil && raw.Request.URL.String() != req.URL {
+			attrs = append(attrs, slog.String("redirected", RedactURL(raw.Request.URL.String())))
+		}
+		if client.Config.LogHeaders {
+			attrs = append(attrs,
+				slog.Any("request_headers", RedactHeaders(req.Header)),
+				slog.Any("response_headers", RedactHeaders(resp.Header())))
+		}
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", RedactError(err)))
+	}
+	client.logger.LogAttrs(ctx, level, "registry request", attrs...)
+}
+
+// logTokenRequest logs a request made to an authorization service.
+func (client *Client) logTokenRequest(ctx context.Context, realm string, scope string, status int, err error, duration time.Duration) {
+	level := client.Config.logLevel()
+	if err != nil || status >= http.StatusInternalServerError {
+		level = client.Config.errorLogLevel()
+	}
+	if !client.logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("realm", RedactURL(realm)),
+		slog.String("scope", scope),
+		slog.Duration("duration", duration),
+	}
+	if status != 0 {
+		attrs = append(attrs, slog.Int("status", status))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", RedactError(err)))
+	}
+	client.logger.LogAttrs(ctx, level, "token request", attrs...)
+}
+
+// RedactURL removes credentials from a URL, along with the values of query
+// parameters which are not part of the distribution spec, such as the
+// signatures of pre-signed storage URLs.
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			if !safeQueryParams[k] {
+				q[k] = []string{redacted}
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// RedactHeaders returns a copy of headers with the values of headers carrying
+// credentials redacted.
+func RedactHeaders(headers http.Header) http.Header {
+	c := make(http.Header, len(headers))
+	for k, v := range headers {
+		if secretHeaders[http.CanonicalHeaderKey(k)] {
+			c[k] = []string{redacted}
+		} else {
+			c[k] = append([]string{}, v...)
+		}
+	}
+	return c
+}
+
+// RedactBody redacts the secret fields of a JSON object, such as the tokens
+// issued by a token server, returning false if there were none.
+func RedactBody(body []byte) ([]byte, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, false
+	}
+	changed := false
+	for _, f := range secretFields {
+		if _, ok := fields[f]; ok {
+			fields[f] = json.RawMessage(`"` + redacted + `"`)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, false
+	}
+	sanitized, err := json.Marshal(fields)
+	return sanitized, err == nil
+}
+
+// RedactError returns the message of an error with any URLs redacted.
+func RedactError(err error) string {
+	if urlErr, ok := err.(*url.Error); ok {
+		return fmt.Sprintf("%s %q: %s", urlErr.Op, RedactURL(urlErr.URL), urlErr.Err)
+	}
+	fields := strings.Fields(err.Error())
+	for i, f := range fields {
+		if strings.Contains(f, "://") {
+			fields[i] = RedactURL(strings.Trim(f, `"`))
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// authScheme returns the authentication scheme used by the last attempt of a request.
+func authScheme(req *Request) string {
+	switch {
+	case req.Token != "":
+		return "bearer"
+	case req.UserInfo != nil:
+		return "basic"
+	}
+	if h := req.Header.Get("Authorization"); h != "" {
+		scheme, _, _ := strings.Cut(h, " ")
+		return strings.ToLower(scheme)
+	}
+	return "none"
+}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// redactRequestLog redacts the headers and body of a request before resty
+// logs it in debug mode.
+func redactRequestLog(rl *resty.RequestLog) error {
+	rl.Header = RedactHeaders(rl.Header)
+	if body, ok := RedactBody([]byte(rl.Body)); ok {
+		rl.Body = string(body)
+	}
+	return nil
+}
+
+// redactResponseLog redacts the headers and body of a response, such as the
+// token issued by a token server, before resty logs it in debug mode.
+func redactResponseLog(rl *resty.ResponseLog) error {
+	rl.Header = RedactHeaders(rl.Header)
+	if loc := rl.Header.Get("Location"); loc != "" {
+		rl.Header.Set("Location", RedactURL(loc))
+	}
+	if body, ok := RedactBody([]byte(rl.Body)); ok {
+		rl.Body = string(body)
+	}
+	return nil
+}
+
+func (l restyLogger) Errorf(format string, v ...interface{}) {
+	l.logger.Error(fmt.Sprintf(format, v...), slog.String("source", "resty"))
+}
+
+func (l restyLogger) Warnf(format string, v ...interface{}) {
+	l.logger.Warn(fmt.Sprintf(format, v...), slog.String("source", "resty"))
+}
+
+func (l restyLogger) Debugf(format string, v ...interface{}) {
+	l.logger.Debug(fmt.Sprintf(format, v...), slog.String("source", "resty"))
+}
@@ -0,0 +1,205 @@
+package reggie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Media types of manifests.
+const (
+	MediaTypeImageManifest      = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeImageIndex         = "application/vnd.oci.image.index.v1+json"
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+type (
+	listConfig struct {
+		PageSize int
+	}
+
+	listOption func(c *listConfig)
+)
+
+// manifestAccept is the Accept header of manifest requests.
+var manifestAccept = strings.Join([]string{
+	MediaTypeImageManifest,
+	MediaTypeImageIndex,
+	MediaTypeDockerManifest,
+	MediaTypeDockerManifestList,
+}, ", ")
+
+// ResolveManifest returns the descriptor of the manifest a tag or digest
+// refers to, without downloading it unless the registry omits the
+// Docker-Content-Digest header.
+func (client *Client) ResolveManifest(ctx context.Context, name string, reference string) (desc Descriptor, err error) {
+	ctx, span := client.startOperation(ctx, "ResolveManifest", name, "", 0)
+	defer func() { endSpan(span, err) }()
+	req := client.NewRequest(HEAD, "/v2/<name>/manifests/<reference>",
+		WithName(name), WithReference(reference)).
+		SetContext(ctx).
+		SetHeader("Accept", manifestAccept)
+	resp, err := client.Do(req)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return Descriptor{}, newResponseError(resp)
+	}
+	desc = Descriptor{
+		MediaType: resp.Header().Get("Content-Type"),
+		Digest:    resp.Header().Get("Docker-Content-Digest"),
+		Size:      -1,
+	}
+	if n, err := strconv.ParseInt(resp.Header().Get("Content-Length"), 10, 64); err == nil {
+		desc.Size = n
+	}
+	if desc.Digest != "" {
+		return desc, nil
+	}
+
+	req = client.NewRequest(GET, "/v2/<name>/manifests/<reference>",
+		WithName(name), WithReference(reference)).
+		SetContext(ctx).
+		SetHeader("Accept", manifestAccept)
+	if resp, err = client.Do(req); err != nil {
+		return Descriptor{}, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return Descriptor{}, newResponseError(resp)
+	}
+	desc.Digest = DigestFromBytes(resp.Body())
+	desc.Size = int64(len(resp.Body()))
+	if isDigest(reference) && desc.Digest != reference {
+		return Descriptor{}, fmt.Errorf("digest mismatch: expected %s, got %s", reference, desc.Digest)
+	}
+	return desc, nil
+}
+
+// GetManifest fetches a manifest by tag or digest, returning its descriptor
+// and content. Manifests fetched by digest are verified against it.
+func (client *Client) GetManifest(ctx context.Context, name string, reference string) (desc Descriptor, content []byte, err error) {
+	ctx, span := client.startOperation(ctx, "GetManifest", name, "", 0)
+	defer func() { endSpan(span, err) }()
+	req := client.NewRequest(GET, "/v2/<name>/manifests/<reference>",
+		WithName(name), WithReference(reference)).
+		SetContext(ctx).
+		SetHeader("Accept", manifestAccept)
+	resp, err := client.Do(req)
+	if err != nil {
+		return Descriptor{}, nil, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return Descriptor{}, nil, newResponseError(resp)
+	}
+	content = resp.Body()
+	desc = Descriptor{Digest: DigestFromBytes(content), Size: int64(len(content))}
+	if isDigest(reference) && desc.Digest != reference {
+		return Descriptor{}, nil, fmt.Errorf("digest mismatch: expected %s, got %s", reference, desc.Digest)
+	}
+	var fields struct {
+		MediaType string `json:"mediaType"`
+	}
+	json.Unmarshal(content, &fields)
+	desc.MediaType = fields.MediaType
+	if desc.MediaType == "" {
+		desc.MediaType, _, _ = strings.Cut(resp.Header().Get("Content-Type"), ";")
+	}
+	return desc, content, nil
+}
+
+// PushManifest uploads a manifest with a tag or digest reference, returning
+// its descriptor. A digest reference must match the content.
+func (client *Client) PushManifest(ctx context.Context, name string, reference string, mediaType string, content []byte) (desc Descriptor, err error) {
+	desc = Descriptor{MediaType: mediaType, Digest: DigestFromBytes(content), Size: int64(len(content))}
+	if isDigest(reference) && reference != desc.Digest {
+		return Descriptor{}, fmt.Errorf("digest mismatch: expected %s, got %s", reference, desc.Digest)
+	}
+	ctx, span := client.startOperation(ctx, "PushManifest", name, desc.Digest, desc.Size)
+	defer func() { endSpan(span, err) }()
+	req := client.NewRequest(PUT, "/v2/<name>/manifests/<reference>",
+		WithName(name), WithReference(reference)).
+		SetContext(ctx).
+		SetHeader("Content-Type", mediaType).
+		SetBody(content)
+	resp, err := client.Do(req)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if resp.StatusCode() != http.StatusCreated {
+		return Descriptor{}, newResponseError(resp)
+	}
+	return desc, nil
+}
+
+// WithPageSize sets the number of entries requested per page when listing,
+// leaving the registry to choose if zero.
+func WithPageSize(n int) listOption {
+	return func(c *listConfig) {
+		c.PageSize = n
+	}
+}
+
+// ListTags lists the tags of a repository, following pagination links.
+func (client *Client) ListTags(ctx context.Context, name string, opts ...listOption) (tags []string, err error) {
+	ctx, span := client.startOperation(ctx, "ListTags", name, "", 0)
+	defer func() { endSpan(span, err) }()
+	conf := &listConfig{}
+	for _, o := range opts {
+		o(conf)
+	}
+	path := "/v2/<name>/tags/list"
+	query := url.Values{}
+	if conf.PageSize > 0 {
+		query.Set("n", strconv.Itoa(conf.PageSize))
+	}
+	for {
+		req := client.NewRequest(GET, path, WithName(name)).SetContext(ctx)
+		req.SetQueryParamsFromValues(query)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode() != http.StatusOK {
+			return nil, newResponseError(resp)
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.Unmarshal(resp.Body(), &page); err != nil {
+			return nil, fmt.Errorf("parsing tags of %s: %w", name, err)
+		}
+		tags = append(tags, page.Tags...)
+
+		next := nextLink(resp.Header().Get("Link"))
+		if next == "" {
+			return tags, nil
+		}
+		u, err := url.Parse(next)
+		if err != nil {
+			return nil, fmt.Errorf("parsing Link header %q: %w", next, err)
+		}
+		path, query = u.Path, u.Query()
+	}
+}
+
+// nextLink returns the target of a Link header with rel="next".
+func nextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		target, params, _ := strings.Cut(strings.TrimSpace(link), ";")
+		if strings.Contains(params, `rel="next"`) {
+			return strings.Trim(strings.TrimSpace(target), "<>")
+		}
+	}
+	return ""
+}
+
+// isDigest returns whether a reference is a digest rather than a tag.
+func isDigest(reference string) bool {
+	return strings.Contains(reference, ":")
+}
@@ -0,0 +1,159 @@
+package reggie
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Endpoint classes reported to Metrics, grouping requests by the part of the
+// distribution API they use.
+const (
+	EndpointBase      = "base"
+	EndpointManifests = "manifests"
+	EndpointBlobs     = "blobs"
+	EndpointUploads   = "uploads"
+	EndpointTags      = "tags"
+	EndpointReferrers = "referrers"
+	EndpointCatalog   = "catalog"
+	EndpointToken     = "token"
+	EndpointOther     = "other"
+)
+
+// Directions of bytes transferred reported to Metrics.
+const (
+	DirectionUpload   = "upload"
+	DirectionDownload = "download"
+)
+
+type (
+	// Metrics receives measurements of the requests made by a client.
+	// Implementations must be safe for concurrent use. See the reggieprom
+	// module for a Prometheus implementation.
+	Metrics interface {
+		// RequestCompleted is called once per request executed by Do, and
+		// per token request. The status is the HTTP status code of the
+		// final response, or "error" if none was received.
+		RequestCompleted(method string, endpoint string, status string, duration time.Duration)
+
+		// AuthRetried is called when a request is retried with auth after
+		// a 401 response, with the lowercase scheme ("bearer" or "basic").
+		AuthRetried(scheme string)
+
+		// TokenCacheLookup is called when a bearer token is needed,
+		// reporting whether a cached token was used.
+		TokenCacheLookup(hit bool)
+
+		// BytesTransferred is called as request bodies are sent and
+		// response bodies are read.
+		BytesTransferred(direction string, n int64)
+	}
+
+	// nopMetrics discards all measurements.
+	nopMetrics struct{}
+
+	// meteredTransport reports the bytes of request and response bodies.
+	meteredTransport struct {
+		next    http.RoundTripper
+		metrics Metrics
+	}
+
+	// meteredBody reports the bytes read from a body.
+	meteredBody struct {
+		io.ReadCloser
+		metrics   Metrics
+		direction string
+	}
+)
+
+// WithMetrics reports measurements of the client's requests to m.
+func WithMetrics(m Metrics) clientOption {
+	return func(c *clientConfig) {
+		c.Metrics = m
+	}
+}
+
+func (c *clientConfig) metrics() Metrics {
+	if c.Metrics != nil {
+		return c.Metrics
+	}
+	return nopMetrics{}
+}
+
+// recordRequest reports a request executed by Do.
+func (client *Client) recordRequest(req *Request, resp *Response, err error, duration time.Duration) {
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode()
+	}
+	client.metrics.RequestCompleted(req.Method, endpointClass(req.URL), statusLabel(status, err), duration)
+}
+
+// endpointClass returns the endpoint class of a request URL.
+func endpointClass(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return EndpointOther
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	switch {
+	case path == "/v2":
+		return EndpointBase
+	case !strings.HasPrefix(path, "/v2/"):
+		return EndpointOther
+	case path == "/v2/_catalog":
+		return EndpointCatalog
+	case strings.Contains(path, "/blobs/uploads"):
+		return EndpointUploads
+	case strings.Contains(path, "/blobs/"):
+		return EndpointBlobs
+	case strings.Contains(path, "/manifests/"):
+		return EndpointManifests
+	case strings.HasSuffix(path, "/tags/list"):
+		return EndpointTags
+	case strings.Contains(path, "/referrers/"):
+		return EndpointReferrers
+	}
+	return EndpointOther
+}
+
+// statusLabel returns the status reported for a request.
+func statusLabel(status int, err error) string {
+	if err != nil || status == 0 {
+		return "error"
+	}
+	return strconv.Itoa(status)
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *meteredTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		metered := *req
+		metered.Body = &meteredBody{ReadCloser: req.Body, metrics: t.metrics, direction: DirectionUpload}
+		req = &metered
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.Body != nil {
+		resp.Body = &meteredBody{ReadCloser: resp.Body, metrics: t.metrics, direction: DirectionDownload}
+	}
+	return resp, nil
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.metrics.BytesTransferred(b.direction, int64(n))
+	}
+	return n, err
+}
+
+func (nopMetrics) RequestCompleted(string, string, string, time.Duration) {}
+func (nopMetrics) AuthRetried(string)                                     {}
+func (nopMetrics) TokenCacheLookup(bool)                                  {}
+func (nopMetrics) BytesTransferred(string, int64)                         {}
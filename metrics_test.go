@@ -0,0 +1,149 @@
+package reggie
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	mu          sync.Mutex
+	requests    map[string]int
+	authRetries map[string]int
+	cacheHits   int
+	cacheMisses int
+	bytes       map[string]int64
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{
+		requests:    map[string]int{},
+		authRetries: map[string]int{},
+		bytes:       map[string]int64{},
+	}
+}
+
+func (m *testMetrics) RequestCompleted(method string, endpoint string, status string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[fmt.Sprintf("%s %s %s", method, endpoint, status)]++
+}
+
+func (m *testMetrics) AuthRetried(scheme string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.authRetries[scheme]++
+}
+
+func (m *testMetrics) TokenCacheLookup(hit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hit {
+		m.cacheHits++
+	} else {
+		m.cacheMisses++
+	}
+}
+
+func (m *testMetrics) BytesTransferred(direction string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytes[direction] += n
+}
+
+func TestMetrics(t *testing.T) {
+	var generation int32 = 1
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"token": "token-%d", "expires_in": 300}`, atomic.LoadInt32(&generation))
+	}))
+	defer authServer.Close()
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", atomic.LoadInt32(&generation)) {
+			w.Header().Set("Www-Authenticate", fmt.Sprintf(`Bearer realm="%s",service="test",scope="repository:a:pull,push"`, authServer.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == PUT {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/tags/list") {
+			w.Write([]byte(`{"name": "a", "tags": ["v1"]}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer registry.Close()
+
+	metrics := newTestMetrics()
+	client, err := NewClient(registry.URL, WithMetrics(metrics), WithDefaultName("a"))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	do := func(req *Request) {
+		t.Helper()
+		if _, err := client.Do(req); err != nil {
+			t.Fatalf("Errors executing request: %s", err)
+		}
+	}
+	do(client.NewRequest(GET, "/v2/<name>/tags/list"))
+	do(client.NewRequest(PUT, "/v2/<name>/manifests/<reference>", WithReference("v1")).
+		SetBody([]byte("manifest")))
+
+	// a revoked token is replaced
+	atomic.StoreInt32(&generation, 2)
+	do(client.NewRequest(HEAD, "/v2/<name>/blobs/<digest>", WithDigest(DigestFromBytes(nil))))
+
+	expected := map[string]int{
+		"GET tags 200":      1,
+		"PUT manifests 201": 1,
+		"HEAD blobs 404":    1,
+		"GET token 200":     2,
+	}
+	for k, v := range expected {
+		if metrics.requests[k] != v {
+			t.Fatalf("Expected %d requests for %q but got %d: %v", v, k, metrics.requests[k], metrics.requests)
+		}
+	}
+	if len(metrics.requests) != len(expected) {
+		t.Fatalf("Unexpected requests recorded: %v", metrics.requests)
+	}
+	if metrics.authRetries["bearer"] != 3 {
+		t.Fatalf("Expected 3 auth retries but got %d", metrics.authRetries["bearer"])
+	}
+	if metrics.cacheHits != 2 || metrics.cacheMisses != 1 {
+		t.Fatalf("Expected 2 token cache hits and 1 miss but got %d and %d", metrics.cacheHits, metrics.cacheMisses)
+	}
+
+	// the manifest is sent twice, before and after the 401
+	if up := metrics.bytes[DirectionUpload]; up != 2*int64(len("manifest")) {
+		t.Fatalf("Expected %d bytes uploaded but got %d", 2*len("manifest"), up)
+	}
+	if down := metrics.bytes[DirectionDownload]; down < int64(len(`{"name": "a", "tags": ["v1"]}`)) {
+		t.Fatalf("Expected tag list to be counted as downloaded but got %d bytes", down)
+	}
+}
+
+func TestEndpointClass(t *testing.T) {
+	for u, class := range map[string]string{
+		"https://r.io/v2/":                               EndpointBase,
+		"https://r.io/v2/_catalog?n=10":                  EndpointCatalog,
+		"https://r.io/v2/a/b/manifests/v1":               EndpointManifests,
+		"https://r.io/v2/a/blobs/sha256:abc":             EndpointBlobs,
+		"https://r.io/v2/a/blobs/uploads/":               EndpointUploads,
+		"https://r.io/v2/a/blobs/uploads/123?digest=sha": EndpointUploads,
+		"https://r.io/v2/a/tags/list":                    EndpointTags,
+		"https://r.io/v2/a/referrers/sha256:abc":         EndpointReferrers,
+		"https://storage.io/bucket/blob?sig=abc":         EndpointOther,
+	} {
+		if got := endpointClass(u); got != class {
+			t.Fatalf("Expected %s to be classed as %s but got %s", u, class, got)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package reggie
+
+import (
+	"net/http"
+
+	"github.com/go-resty/resty/v2"
+)
+
+type (
+	// BeforeRequestFunc is called before each attempt of a request executed
+	// by Do, including the retry with auth after a 401 and attempts against
+	// mirrors. Returning an error aborts the request.
+	BeforeRequestFunc func(req *Request) error
+
+	// AfterResponseFunc is called after each attempt of a request executed
+	// by Do which received a response. Returning an error aborts the
+	// request, and the error is returned by Do along with the response.
+	AfterResponseFunc func(req *Request, resp *Response) error
+)
+
+// UseBeforeRequest adds middleware called before each attempt of a request,
+// after any added previously. It must not be called concurrently with
+// requests.
+func (client *Client) UseBeforeRequest(fns ...BeforeRequestFunc) *Client {
+	client.beforeRequest = append(client.beforeRequest, fns...)
+	return client
+}
+
+// UseAfterResponse adds middleware called after each attempt of a request
+// which received a response, after any added previously. It must not be
+// called concurrently with requests.
+func (client *Client) UseAfterResponse(fns ...AfterResponseFunc) *Client {
+	client.afterResponse = append(client.afterResponse, fns...)
+	return client
+}
+
+// UseTransport wraps the client's transport, including any wrappers
+// configured with WithTransportWrapper, such that wrapper sees every HTTP
+// request made by the client, including token requests and redirects. It
+// must not be called concurrently with requests.
+func (client *Client) UseTransport(wrapper TransportWrapper) *Client {
+	client.SetTransport(wrapper(client.GetClient().Transport))
+	return client
+}
+
+// SetPreRequestHook adds a hook called with each outgoing http.Request,
+// after the client's own pre-request hook and any hooks added previously.
+// Unlike the resty method it shadows, existing hooks are kept.
+func (client *Client) SetPreRequestHook(h resty.PreRequestHook) *Client {
+	client.preRequestHooks = append(client.preRequestHooks, h)
+	return client
+}
+
+// execute runs a single attempt of a request, surrounded by middleware.
+func (client *Client) execute(req *Request) (*Response, error) {
+	for _, fn := range client.beforeRequest {
+		if err := fn(req); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := req.Execute(req.Method, req.URL)
+	if err != nil {
+		return resp, err
+	}
+	for _, fn := range client.afterResponse {
+		if err := fn(req, resp); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+// runPreRequestHooks runs the hooks added with SetPreRequestHook.
+func (client *Client) runPreRequestHooks(rc *resty.Client, req *http.Request) error {
+	for _, h := range client.preRequestHooks {
+		if err := h(rc, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package reggie
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+)
+
+func TestMiddleware(t *testing.T) {
+	var received []http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Clone())
+		if r.Header.Get("Authorization") == "" {
+			w.Header().Set("Www-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL, WithUsernamePassword("user", "pass"))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	var statuses []int
+	roundTrips := 0
+	client.
+		UseBeforeRequest(func(req *Request) error {
+			req.Request.SetHeader("X-Attempt", "first")
+			return nil
+		}, func(req *Request) error {
+			req.Request.SetHeader("X-Attempt", req.Header.Get("X-Attempt")+",second")
+			return nil
+		}).
+		UseAfterResponse(func(req *Request, resp *Response) error {
+			statuses = append(statuses, resp.StatusCode())
+			return nil
+		}).
+		UseTransport(func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				roundTrips++
+				return next.RoundTrip(req)
+			})
+		})
+	client.SetPreRequestHook(func(_ *resty.Client, req *http.Request) error {
+		req.Header.Set("X-Hook", "1")
+		return nil
+	})
+	client.SetPreRequestHook(func(_ *resty.Client, req *http.Request) error {
+		req.Header.Set("X-Hook", req.Header.Get("X-Hook")+"2")
+		return nil
+	})
+
+	req := client.NewRequest(GET, "/v2/").SetHeader("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		t.Fatalf("Expected status 200 but got %d", resp.StatusCode())
+	}
+
+	// middleware runs around both the original request and the auth retry
+	if len(received) != 2 || roundTrips != 2 {
+		t.Fatalf("Expected 2 requests but got %d (%d round trips)", len(received), roundTrips)
+	}
+	for _, h := range received {
+		if a := h.Get("X-Attempt"); a != "first,second" {
+			t.Fatalf("Expected middleware to run in order but got %q", a)
+		}
+		if h.Get("X-Hook") != "12" {
+			t.Fatalf("Expected pre-request hooks to be chained but got %q", h.Get("X-Hook"))
+		}
+		if h.Get("Accept") != "application/json" {
+			t.Fatalf("Expected Accept header to be kept but got %q", h.Get("Accept"))
+		}
+	}
+	if len(statuses) != 2 || statuses[0] != http.StatusUnauthorized || statuses[1] != http.StatusOK {
+		t.Fatalf("Expected after-response middleware to see [401 200] but got %v", statuses)
+	}
+
+	// the Accept workaround still applies alongside user hooks
+	received = nil
+	if _, err := client.Do(client.NewRequest(PUT, "/a/b/c")); err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if a := received[0].Get("Accept"); a != "" {
+		t.Fatalf("Expected Accept header to be removed but got %q", a)
+	}
+}
+
+func TestMiddlewareErrors(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL)
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	denied := errors.New("denied")
+	client.UseBeforeRequest(func(req *Request) error {
+		if req.Method == DELETE {
+			return denied
+		}
+		return nil
+	})
+	if _, err := client.Do(client.NewRequest(DELETE, "/v2/a/manifests/v1")); !errors.Is(err, denied) {
+		t.Fatalf("Expected before-request error but got %v", err)
+	}
+	if requests != 0 {
+		t.Fatalf("Expected request to be aborted but server received %d", requests)
+	}
+
+	audit := errors.New("audit failed")
+	client.UseAfterResponse(func(req *Request, resp *Response) error {
+		return audit
+	})
+	resp, err := client.Do(client.NewRequest(GET, "/v2/"))
+	if !errors.Is(err, audit) || resp == nil || resp.StatusCode() != http.StatusOK {
+		t.Fatalf("Expected after-response error with response but got %v, %v", resp, err)
+	}
+}
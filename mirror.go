@@ -0,0 +1,293 @@
+package reggie
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMirrorCooldown is how long an unhealthy mirror is skipped for.
+	DefaultMirrorCooldown = 30 * time.Second
+)
+
+const (
+	// PullFromMirrorAll uses a mirror for all pulls. This is the default.
+	PullFromMirrorAll = "all"
+
+	// PullFromMirrorDigestOnly only uses a mirror for manifests referenced by digest.
+	PullFromMirrorDigestOnly = "digest-only"
+
+	// PullFromMirrorTagOnly only uses a mirror for manifests referenced by tag.
+	PullFromMirrorTagOnly = "tag-only"
+)
+
+type (
+	// Mirror is an alternative endpoint serving the content of the
+	// registry, such as a pull-through cache.
+	Mirror struct {
+		// Location is the URL of the mirror, optionally including a
+		// namespace prefix (e.g. "https://mirror.io/dockerhub"). The
+		// scheme defaults to https.
+		Location string
+
+		// Insecure skips TLS verification for the mirror.
+		Insecure bool
+
+		// PullFromMirror restricts which manifests are pulled from the
+		// mirror. Requests for blobs and tag lists are always attempted.
+		PullFromMirror string
+
+		// ReplacePrefix is a namespace prefix of repositories at the
+		// registry which the namespace in Location replaces, rather than
+		// being prepended to.
+		ReplacePrefix string
+
+		// Username and Password answer auth challenges from the mirror.
+		// The registry's credentials are never sent to a mirror, which
+		// is accessed anonymously if these are empty.
+		Username string
+		Password string
+	}
+
+	// mirrorEndpoint is a parsed Mirror.
+	mirrorEndpoint struct {
+		Mirror
+		base   *url.URL
+		prefix string
+	}
+
+	// endpointHealth remembers which endpoints have recently failed.
+	endpointHealth struct {
+		cooldown time.Duration
+
+		mu        sync.Mutex
+		unhealthy map[string]time.Time
+	}
+
+	// insecureHostTransport skips TLS verification for requests to
+	// specific hosts.
+	insecureHostTransport struct {
+		next     http.RoundTripper
+		insecure http.RoundTripper
+		hosts    map[string]bool
+	}
+)
+
+// WithMirrors configures endpoints which are tried, in order, before the
+// registry address for pull requests (GET and HEAD). A mirror which returns
+// a server error or cannot be reached is skipped for the cooldown period.
+func WithMirrors(mirrors ...Mirror) clientOption {
+	return func(c *clientConfig) {
+		c.Mirrors = append(c.Mirrors, mirrors...)
+	}
+}
+
+// WithMirrorCooldown sets how long an unhealthy mirror is skipped for.
+// Defaults to DefaultMirrorCooldown.
+func WithMirrorCooldown(cooldown time.Duration) clientOption {
+	return func(c *clientConfig) {
+		c.MirrorCooldown = cooldown
+	}
+}
+
+// parseMirrors validates the configured mirrors.
+func parseMirrors(mirrors []Mirror) ([]*mirrorEndpoint, error) {
+	endpoints := make([]*mirrorEndpoint, 0, len(mirrors))
+	for _, m := range mirrors {
+		loc := m.Location
+		if !strings.Contains(loc, "://") {
+			loc = "https://" + loc
+		}
+		u, err := url.Parse(loc)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid mirror location %q", m.Location)
+		}
+		switch m.PullFromMirror {
+		case "", PullFromMirrorAll, PullFromMirrorDigestOnly, PullFromMirrorTagOnly:
+		default:
+			return nil, fmt.Errorf("invalid pull-from-mirror value %q for mirror %s", m.PullFromMirror, m.Location)
+		}
+		endpoints = append(endpoints, &mirrorEndpoint{
+			Mirror: m,
+			base:   &url.URL{Scheme: u.Scheme, Host: u.Host},
+			prefix: strings.Trim(u.Path, "/"),
+		})
+	}
+	return endpoints, nil
+}
+
+// String returns the URL of the mirror, including any namespace prefix.
+func (m *mirrorEndpoint) String() string {
+	if m.prefix == "" {
+		return m.base.String()
+	}
+	return m.base.String() + "/" + m.prefix
+}
+
+// rewrite returns the URL a request for u should use on the mirror, or false
+// if the mirror should not serve it.
+func (m *mirrorEndpoint) rewrite(u *url.URL) (string, bool) {
+	path := strings.TrimPrefix(u.Path, "/v2/")
+	if path == u.Path || path == "" || strings.HasPrefix(path, "_") {
+		return "", false
+	}
+	if i := strings.LastIndex(path, "/manifests/"); i >= 0 {
+		isDigest := strings.Contains(path[i+len("/manifests/"):], ":")
+		switch m.PullFromMirror {
+		case PullFromMirrorDigestOnly:
+			if !isDigest {
+				return "", false
+			}
+		case PullFromMirrorTagOnly:
+			if isDigest {
+				return "", false
+			}
+		}
+	}
+	if p := strings.Trim(m.ReplacePrefix, "/"); p != "" {
+		if !strings.HasPrefix(path, p+"/") {
+			return "", false
+		}
+		path = strings.TrimPrefix(path, p+"/")
+	}
+	if m.prefix != "" {
+		path = m.prefix + "/" + path
+	}
+	rewritten := *m.base
+	rewritten.Path = "/v2/" + path
+	rewritten.RawQuery = u.RawQuery
+	return rewritten.String(), true
+}
+
+func newEndpointHealth(cooldown time.Duration) *endpointHealth {
+	return &endpointHealth{
+		cooldown:  durationOrDefault(cooldown, DefaultMirrorCooldown),
+		unhealthy: map[string]time.Time{},
+	}
+}
+
+func (h *endpointHealth) healthy(endpoint string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	until, ok := h.unhealthy[endpoint]
+	if ok && time.Now().After(until) {
+		delete(h.unhealthy, endpoint)
+		return true
+	}
+	return !ok
+}
+
+func (h *endpointHealth) markUnhealthy(endpoint string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.unhealthy[endpoint] = time.Now().Add(h.cooldown)
+}
+
+// doWithMirrors attempts a pull request against each healthy mirror in turn,
+// falling back to the registry itself.
+func (client *Client) doWithMirrors(req *Request) (*Response, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil || u.Host != client.host() {
+		return client.do(req)
+	}
+
+	origURL := req.URL
+	origQuery := cloneValues(req.QueryParam)
+	for _, m := range client.mirrors {
+		endpoint := m.String()
+		mirrorURL, ok := m.rewrite(u)
+		if !ok || !client.mirrorHealth.healthy(endpoint) {
+			continue
+		}
+
+		req.URL = mirrorURL
+		req.QueryParam = cloneValues(origQuery)
+		req.mirror = m
+		resp, err := client.do(req)
+		req.mirror = nil
+		resetAuth(req)
+		if err == nil && resp.StatusCode() < http.StatusBadRequest {
+			resp.endpoint = endpoint
+			return resp, nil
+		}
+		if err != nil || resp.StatusCode() >= http.StatusInternalServerError ||
+			resp.StatusCode() == http.StatusTooManyRequests {
+			client.mirrorHealth.markUnhealthy(endpoint)
+		}
+		if resp != nil {
+			if body := resp.RawBody(); body != nil {
+				body.Close()
+			}
+		}
+		if err := req.Request.Context().Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	req.URL = origURL
+	req.QueryParam = origQuery
+	return client.do(req)
+}
+
+// resetAuth removes any credentials set on a request by a previous attempt.
+func resetAuth(req *Request) {
+	req.Token = ""
+	req.UserInfo = nil
+	req.Request.Header.Del("Authorization")
+}
+
+func cloneValues(v url.Values) url.Values {
+	c := url.Values{}
+	for k, vs := range v {
+		c[k] = append([]string{}, vs...)
+	}
+	return c
+}
+
+// isPull returns whether a request only reads content, and may therefore be
+// served by a mirror.
+func isPull(req *Request) bool {
+	return req.Method == GET || req.Method == HEAD
+}
+
+// insecureMirrorHosts returns the hosts of mirrors configured to skip TLS verification.
+func (c *clientConfig) insecureMirrorHosts() map[string]bool {
+	hosts := map[string]bool{}
+	for _, m := range c.Mirrors {
+		if !m.Insecure {
+			continue
+		}
+		loc := m.Location
+		if !strings.Contains(loc, "://") {
+			loc = "https://" + loc
+		}
+		if u, err := url.Parse(loc); err == nil {
+			hosts[u.Host] = true
+		}
+	}
+	return hosts
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *insecureHostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.hosts[req.URL.Host] {
+		return t.insecure.RoundTrip(req)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// newInsecureHostTransport routes requests for hosts through a copy of
+// transport which skips TLS verification.
+func newInsecureHostTransport(transport *http.Transport, hosts map[string]bool) http.RoundTripper {
+	insecure := transport.Clone()
+	if insecure.TLSClientConfig == nil {
+		insecure.TLSClientConfig = &tls.Config{}
+	}
+	insecure.TLSClientConfig.InsecureSkipVerify = true //nolint: gosec
+	return &insecureHostTransport{next: transport, insecure: insecure, hosts: hosts}
+}
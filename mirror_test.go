@@ -0,0 +1,199 @@
+package reggie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMirrors(t *testing.T) {
+	var primaryHits, brokenHits, emptyHits, cacheHits int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primary.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&brokenHits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&emptyHits, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer empty.Close()
+	var cachePath string
+	cache := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&cacheHits, 1)
+		cachePath = r.URL.RequestURI()
+		if r.URL.Path == "/v2/upstream/myorg/myrepo/manifests/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer cache.Close()
+
+	client, err := NewClient(primary.URL,
+		WithDefaultName("myorg/myrepo"),
+		WithMirrorCooldown(100*time.Millisecond),
+		WithMirrors(
+			Mirror{Location: broken.URL},
+			Mirror{Location: empty.URL},
+			Mirror{Location: cache.URL + "/upstream", PullFromMirror: PullFromMirrorTagOnly}))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	// the broken mirror is marked unhealthy, the empty one misses, and the
+	// cache serves the request under its namespace prefix
+	req := client.NewRequest(GET, "/v2/<name>/manifests/<reference>", WithReference("latest")).
+		SetQueryParam("foo", "bar")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if e := resp.Endpoint(); e != cache.URL+"/upstream" {
+		t.Fatalf("Expected response from cache mirror but got %s", e)
+	}
+	if cachePath != "/v2/upstream/myorg/myrepo/manifests/latest?foo=bar" {
+		t.Fatalf("Unexpected request on mirror: %s", cachePath)
+	}
+	if brokenHits != 1 || emptyHits != 1 || primaryHits != 0 {
+		t.Fatalf("Unexpected hits: broken=%d empty=%d primary=%d", brokenHits, emptyHits, primaryHits)
+	}
+
+	// the broken mirror is skipped during its cooldown
+	resp, err = client.Do(client.NewRequest(GET, "/v2/<name>/manifests/<reference>", WithReference("missing")))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if e := resp.Endpoint(); e != primary.URL {
+		t.Fatalf("Expected fallback to primary but got %s", e)
+	}
+	if brokenHits != 1 || emptyHits != 2 || primaryHits != 1 {
+		t.Fatalf("Unexpected hits: broken=%d empty=%d primary=%d", brokenHits, emptyHits, primaryHits)
+	}
+
+	// digests are not pulled from a tag-only mirror
+	cacheHits = 0
+	digest := DigestFromBytes([]byte("x"))
+	resp, err = client.Do(client.NewRequest(HEAD, "/v2/<name>/manifests/<reference>", WithReference(digest)))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if cacheHits != 0 || resp.Endpoint() != primary.URL {
+		t.Fatalf("Expected digest to be pulled from primary")
+	}
+
+	// pushes never go to mirrors
+	primaryHits, emptyHits = 0, 0
+	if _, err := client.Do(client.NewRequest(PUT, "/v2/<name>/manifests/<reference>", WithReference("latest"))); err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if primaryHits != 1 || emptyHits != 0 {
+		t.Fatalf("Expected push to go to primary only")
+	}
+
+	// the broken mirror is retried once its cooldown has passed
+	time.Sleep(150 * time.Millisecond)
+	if _, err := client.Do(client.NewRequest(GET, "/v2/<name>/tags/list")); err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if brokenHits != 2 {
+		t.Fatalf("Expected broken mirror to be retried after cooldown")
+	}
+
+	if _, err := NewClient(primary.URL, WithMirrors(Mirror{Location: "https://"})); err == nil {
+		t.Fatalf("Expected error for invalid mirror location")
+	}
+	if _, err := NewClient(primary.URL, WithMirrors(Mirror{Location: "m.io", PullFromMirror: "sometimes"})); err == nil {
+		t.Fatalf("Expected error for invalid pull-from-mirror value")
+	}
+}
+
+func TestInsecureMirror(t *testing.T) {
+	mirror := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mirror.Close()
+
+	client, err := NewClient("https://registry.invalid",
+		WithMirrors(Mirror{Location: mirror.Listener.Addr().String(), Insecure: true}))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	resp, err := client.Do(client.NewRequest(GET, "/v2/<name>/tags/list", WithName("a/b")))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if resp.Endpoint() != mirror.URL {
+		t.Fatalf("Expected response from insecure mirror but got %s", resp.Endpoint())
+	}
+}
+
+func TestMirrorCredentials(t *testing.T) {
+	var mirrorAuth, realmAuth []string
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primary.Close()
+	realm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realmAuth = append(realmAuth, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"token":"mirror-token"}`))
+	}))
+	defer realm.Close()
+	basic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrorAuth = append(mirrorAuth, r.Header.Get("Authorization"))
+		if user, pass, ok := r.BasicAuth(); ok && user == "mirror" && pass == "mirror-secret" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Www-Authenticate", `Basic realm="mirror"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer basic.Close()
+	bearer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrorAuth = append(mirrorAuth, r.Header.Get("Authorization"))
+		w.Header().Set("Www-Authenticate", `Bearer realm="`+realm.URL+`",service="mirror"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer bearer.Close()
+
+	for _, test := range []struct {
+		name     string
+		mirror   Mirror
+		endpoint string
+	}{
+		{"anonymous basic", Mirror{Location: basic.URL}, primary.URL},
+		{"anonymous bearer", Mirror{Location: bearer.URL}, primary.URL},
+		{"own credentials", Mirror{Location: basic.URL, Username: "mirror", Password: "mirror-secret"}, basic.URL},
+	} {
+		mirrorAuth, realmAuth = nil, nil
+		client, err := NewClient(primary.URL,
+			WithDefaultName("myorg/myrepo"),
+			WithUsernamePassword("user", "secret"),
+			WithMirrors(test.mirror))
+		if err != nil {
+			t.Fatalf("Errors creating client: %s", err)
+		}
+		resp, err := client.Do(client.NewRequest(GET, "/v2/<name>/manifests/latest"))
+		if err != nil {
+			t.Fatalf("Errors executing request %s: %s", test.name, err)
+		}
+		if e := resp.Endpoint(); e != test.endpoint {
+			t.Fatalf("Expected response %s from %s but got %s", test.name, test.endpoint, e)
+		}
+		for _, auth := range append(mirrorAuth, realmAuth...) {
+			if user, pass, ok := (&http.Request{Header: http.Header{"Authorization": {auth}}}).BasicAuth(); ok && (user == "user" || pass == "secret") {
+				t.Fatalf("Expected registry credentials not to be sent to the mirror %s", test.name)
+			}
+		}
+		if test.name == "anonymous bearer" && (len(realmAuth) != 1 || realmAuth[0] != "") {
+			t.Fatalf("Expected anonymous token request but got %q", realmAuth)
+		}
+	}
+}
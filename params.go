@@ -0,0 +1,102 @@
+package reggie
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type (
+	// ParamValidator checks the value substituted for a placeholder.
+	ParamValidator func(value string) error
+)
+
+var (
+	placeholderMatcher = regexp.MustCompile(`<([A-Za-z0-9_]+)>`)
+)
+
+// WithParam sets the value of a custom placeholder per a single request, such
+// as <project> in "/api/v2.0/projects/<project>/repositories". The key may be
+// given with or without angle brackets.
+func WithParam(key string, value string) requestOption {
+	return func(c *requestConfig) {
+		if c.Params == nil {
+			c.Params = map[string]string{}
+		}
+		c.Params[placeholderName(key)] = value
+	}
+}
+
+// WithPlaceholder registers a placeholder whose values are checked by
+// validate before they are substituted.
+func WithPlaceholder(name string, validate ParamValidator) clientOption {
+	return func(c *clientConfig) {
+		if c.Placeholders == nil {
+			c.Placeholders = map[string]ParamValidator{}
+		}
+		c.Placeholders[placeholderName(name)] = validate
+	}
+}
+
+// MatchParam returns a ParamValidator accepting values which fully match the
+// regular expression re.
+func MatchParam(re *regexp.Regexp) ParamValidator {
+	return func(value string) error {
+		if loc := re.FindStringIndex(value); loc == nil || loc[0] != 0 || loc[1] != len(value) {
+			return fmt.Errorf("does not match %s", re)
+		}
+		return nil
+	}
+}
+
+// RegisterPlaceholder registers a placeholder whose values are checked by
+// validate before they are substituted, replacing any validator registered
+// for it before. Built-in placeholders such as <name> may be registered too.
+func (client *Client) RegisterPlaceholder(name string, validate ParamValidator) {
+	client.paramMu.Lock()
+	defer client.paramMu.Unlock()
+	if client.placeholders == nil {
+		client.placeholders = map[string]ParamValidator{}
+	}
+	client.placeholders[placeholderName(name)] = validate
+}
+
+// expandPlaceholders substitutes params for the placeholders in path,
+// escaping values substituted into its query string. Placeholders without a
+// value are left in place for validateRequest to report.
+func (client *Client) expandPlaceholders(path string, params map[string]string) (string, error) {
+	client.paramMu.Lock()
+	defer client.paramMu.Unlock()
+	var err error
+	expand := func(s string, escape func(string) string) string {
+		return placeholderMatcher.ReplaceAllStringFunc(s, func(m string) string {
+			name := m[1 : len(m)-1]
+			v := params[name]
+			if v == "" {
+				return m
+			}
+			if validate := client.placeholders[name]; validate != nil && err == nil {
+				if verr := validate(v); verr != nil {
+					err = fmt.Errorf("invalid value %q for placeholder <%s>: %w", v, name, verr)
+				}
+			}
+			return escape(v)
+		})
+	}
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = expand(path[:i], noEscape) + "?" + expand(path[i+1:], url.QueryEscape)
+	} else {
+		path = expand(path, noEscape)
+	}
+	return path, err
+}
+
+// placeholderName returns a placeholder name without angle brackets.
+func placeholderName(s string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(s, "<"), ">")
+}
+
+func noEscape(s string) string {
+	return s
+}
@@ -0,0 +1,54 @@
+package reggie
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParams(t *testing.T) {
+	client, err := NewClient("http://localhost:5000",
+		WithPlaceholder("project", MatchParam(regexp.MustCompile(`[a-z0-9-]+`))))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	req := client.NewRequest(GET, "/api/v2.0/projects/<project>/repositories?q=<query>&artifactType=<artifact_type>",
+		WithParam("project", "library"),
+		WithParam("<query>", "name=~app"),
+		WithParam("artifact_type", "application/vnd.example+json"))
+	expected := "http://localhost:5000/api/v2.0/projects/library/repositories" +
+		"?q=name%3D~app&artifactType=application%2Fvnd.example%2Bjson"
+	if req.URL != expected {
+		t.Fatalf("Expected %s but got %s", expected, req.URL)
+	}
+	if err := validateRequest(req); err != nil {
+		t.Fatalf("Errors validating request: %s", err)
+	}
+
+	// missing values are reported by name
+	req = client.NewRequest(GET, "/api/v2.0/projects/<project>/repositories")
+	if _, err := client.Do(req); err == nil || !strings.Contains(err.Error(), "missing value for placeholder <project>") {
+		t.Fatalf("Expected missing placeholder error but got %v", err)
+	}
+
+	// values are validated before the request is sent
+	req = client.NewRequest(GET, "/api/v2.0/projects/<project>/repositories", WithParam("project", "../admin"))
+	if _, err := client.Do(req); err == nil || !strings.Contains(err.Error(), `invalid value "../admin" for placeholder <project>`) {
+		t.Fatalf("Expected invalid placeholder error but got %v", err)
+	}
+
+	// built-in placeholders may be validated too
+	errShort := errors.New("too short")
+	client.RegisterPlaceholder("<name>", func(value string) error {
+		if !strings.Contains(value, "/") {
+			return errShort
+		}
+		return nil
+	})
+	req = client.NewRequest(GET, "/v2/<name>/tags/list", WithName("app"))
+	if _, err := client.Do(req); !errors.Is(err, errShort) {
+		t.Fatalf("Expected validator error but got %v", err)
+	}
+}
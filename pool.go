@@ -0,0 +1,178 @@
+package reggie
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultRegistry is the registry short names resolve to when a
+	// ClientPool has no registries.conf.
+	DefaultRegistry = "docker.io"
+)
+
+type (
+	// ClientPool lazily creates and caches a Client per registry, routing
+	// references to the client for their registry host. It is safe for
+	// concurrent use.
+	ClientPool struct {
+		config *poolConfig
+
+		mu      sync.Mutex
+		clients map[string]*Client
+	}
+
+	poolConfig struct {
+		DefaultOptions  []clientOption
+		HostOptions     map[string][]clientOption
+		PlainHTTPHosts  map[string]bool
+		RegistriesConf  *RegistriesConf
+		DefaultRegistry string
+	}
+
+	poolOption func(c *poolConfig)
+)
+
+// NewClientPool builds a new ClientPool from provided options.
+func NewClientPool(opts ...poolOption) *ClientPool {
+	conf := &poolConfig{
+		HostOptions:     map[string][]clientOption{},
+		PlainHTTPHosts:  map[string]bool{},
+		DefaultRegistry: DefaultRegistry,
+	}
+	for _, o := range opts {
+		o(conf)
+	}
+	return &ClientPool{config: conf, clients: map[string]*Client{}}
+}
+
+// WithDefaultClientOptions sets options applied to every client in the pool.
+func WithDefaultClientOptions(opts ...clientOption) poolOption {
+	return func(c *poolConfig) {
+		c.DefaultOptions = append(c.DefaultOptions, opts...)
+	}
+}
+
+// WithHostClientOptions sets options applied to clients for a registry host,
+// such as credentials. They are applied after the default options, and
+// match either the registry named in a reference or the host it resolves to.
+func WithHostClientOptions(host string, opts ...clientOption) poolOption {
+	return func(c *poolConfig) {
+		c.HostOptions[host] = append(c.HostOptions[host], opts...)
+	}
+}
+
+// WithPlainHTTP uses plain HTTP rather than HTTPS for the given hosts.
+func WithPlainHTTP(hosts ...string) poolOption {
+	return func(c *poolConfig) {
+		for _, h := range hosts {
+			c.PlainHTTPHosts[h] = true
+		}
+	}
+}
+
+// WithRegistriesConf resolves references, mirrors and TLS settings according
+// to a registries.conf configuration.
+func WithRegistriesConf(conf *RegistriesConf) poolOption {
+	return func(c *poolConfig) {
+		c.RegistriesConf = conf
+	}
+}
+
+// WithDefaultRegistry sets the registry short names resolve to when the pool
+// has no registries.conf. Defaults to DefaultRegistry.
+func WithDefaultRegistry(host string) poolOption {
+	return func(c *poolConfig) {
+		c.DefaultRegistry = host
+	}
+}
+
+// Client returns the client for a registry host.
+func (pool *ClientPool) Client(host string) (*Client, error) {
+	address := pool.address(registryAPIHost(host))
+	return pool.client(host+"|"+address+"|", address, pool.hostOptions(host, address))
+}
+
+// ClientFor returns the client for the registry of a reference, along with
+// the reference resolved to the repository on that registry, whose
+// Repository should be used as the name of requests.
+func (pool *ClientPool) ClientFor(reference string) (*Client, Reference, error) {
+	ref, err := ParseReference(reference)
+	if err != nil {
+		return nil, Reference{}, err
+	}
+
+	var address, key string
+	var opts []clientOption
+	resolved := ref
+	if conf := pool.config.RegistriesConf; conf != nil {
+		r, err := conf.Resolve(ref.Name())
+		if err != nil {
+			return nil, Reference{}, err
+		}
+		address = r.Address
+		if u, err := url.Parse(address); err == nil && pool.config.PlainHTTPHosts[u.Host] {
+			address = "http://" + u.Host
+		}
+		resolved.Repository = r.Repository
+		opts = r.Options
+		key = r.Prefix
+	} else {
+		if ref.Registry == "" {
+			ref.Registry = pool.config.DefaultRegistry
+		}
+		if ref.Registry == "docker.io" && !strings.Contains(ref.Repository, "/") {
+			resolved.Repository = "library/" + ref.Repository
+		}
+		address = pool.address(registryAPIHost(ref.Registry))
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, Reference{}, err
+	}
+	resolved.Registry = u.Host
+
+	opts = append(opts, pool.hostOptions(ref.Registry, address)...)
+	client, err := pool.client(ref.Registry+"|"+address+"|"+key, address, opts)
+	if err != nil {
+		return nil, Reference{}, err
+	}
+	return client, resolved, nil
+}
+
+// client returns the cached client for key, creating it if needed.
+func (pool *ClientPool) client(key string, address string, opts []clientOption) (*Client, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if client, ok := pool.clients[key]; ok {
+		return client, nil
+	}
+	options := append(append([]clientOption{}, pool.config.DefaultOptions...), opts...)
+	client, err := NewClient(address, options...)
+	if err != nil {
+		return nil, fmt.Errorf("creating client for %s: %w", address, err)
+	}
+	pool.clients[key] = client
+	return client, nil
+}
+
+// address returns the URL of a registry host.
+func (pool *ClientPool) address(host string) string {
+	if pool.config.PlainHTTPHosts[host] {
+		return "http://" + host
+	}
+	return "https://" + host
+}
+
+// hostOptions returns the options configured for the registry named in a
+// reference and for the host of the address it resolved to.
+func (pool *ClientPool) hostOptions(registry string, address string) []clientOption {
+	opts := append([]clientOption{}, pool.config.HostOptions[registry]...)
+	if u, err := url.Parse(address); err == nil && u.Host != registry {
+		opts = append(opts, pool.config.HostOptions[u.Host]...)
+	}
+	return opts
+}
@@ -0,0 +1,134 @@
+package reggie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClientPool(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]string{}
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			seen[name] = r.Header.Get("User-Agent") + " " + r.URL.Path
+			mu.Unlock()
+		})
+	}
+	a := httptest.NewServer(handler("a"))
+	defer a.Close()
+	b := httptest.NewServer(handler("b"))
+	defer b.Close()
+	hostA := strings.TrimPrefix(a.URL, "http://")
+	hostB := strings.TrimPrefix(b.URL, "http://")
+
+	pool := NewClientPool(
+		WithPlainHTTP(hostA, hostB),
+		WithDefaultClientOptions(WithUserAgent("pool-agent")),
+		WithHostClientOptions(hostB, WithUserAgent("b-agent"), WithUsernamePassword("user", "pass")))
+
+	clientA, refA, err := pool.ClientFor(hostA + "/myorg/app:v1")
+	if err != nil {
+		t.Fatalf("Errors getting client: %s", err)
+	}
+	if refA.Registry != hostA || refA.Repository != "myorg/app" || refA.Tag != "v1" {
+		t.Fatalf("Unexpected resolved reference: %+v", refA)
+	}
+	clientB, _, err := pool.ClientFor(hostB + "/other@" + DigestFromBytes([]byte("x")))
+	if err != nil {
+		t.Fatalf("Errors getting client: %s", err)
+	}
+	if clientA == clientB {
+		t.Fatalf("Expected a client per host")
+	}
+	if clientB.Config.Username != "user" {
+		t.Fatalf("Expected host options to apply")
+	}
+
+	// clients are cached
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, _, err := pool.ClientFor(hostA + "/another/app")
+			if err != nil || c != clientA {
+				t.Errorf("Expected cached client for host")
+			}
+		}()
+	}
+	wg.Wait()
+	if c, err := pool.Client(hostA); err != nil || c != clientA {
+		t.Fatalf("Expected cached client for host")
+	}
+
+	for _, c := range []*Client{clientA, clientB} {
+		if _, err := c.Do(c.NewRequest(GET, "/v2/<name>/tags/list", WithName("x"))); err != nil {
+			t.Fatalf("Errors executing request: %s", err)
+		}
+	}
+	if seen["a"] != "pool-agent /v2/x/tags/list" || seen["b"] != "b-agent /v2/x/tags/list" {
+		t.Fatalf("Unexpected requests: %v", seen)
+	}
+
+	// short names resolve to the default registry
+	client, ref, err := NewClientPool().ClientFor("alpine")
+	if err != nil {
+		t.Fatalf("Errors getting client: %s", err)
+	}
+	if client.Config.Address != "https://registry-1.docker.io" || ref.Repository != "library/alpine" {
+		t.Fatalf("Unexpected client %s for %+v", client.Config.Address, ref)
+	}
+
+	if _, _, err := pool.ClientFor("NOT A REFERENCE"); err == nil {
+		t.Fatalf("Expected error for invalid reference")
+	}
+}
+
+func TestClientPoolRegistriesConf(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	conf, err := ParseRegistriesConf([]byte(`
+unqualified-search-registries = ["internal.io"]
+
+[[registry]]
+prefix = "internal.io"
+location = "` + host + `/mirrored"
+
+[[registry]]
+prefix = "evil.io"
+blocked = true
+`))
+	if err != nil {
+		t.Fatalf("Errors parsing registries.conf: %s", err)
+	}
+	pool := NewClientPool(WithRegistriesConf(conf), WithPlainHTTP(host))
+
+	client, ref, err := pool.ClientFor("app:v2")
+	if err != nil {
+		t.Fatalf("Errors getting client: %s", err)
+	}
+	if ref.Registry != host || ref.Repository != "mirrored/app" || ref.Tag != "v2" {
+		t.Fatalf("Unexpected resolved reference: %+v", ref)
+	}
+	req := client.NewRequest(GET, "/v2/<name>/manifests/<reference>",
+		WithName(ref.Repository), WithReference(ref.Reference()))
+	if _, err := client.Do(req); err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if path != "/v2/mirrored/app/manifests/v2" {
+		t.Fatalf("Unexpected request path: %s", path)
+	}
+
+	if _, _, err := pool.ClientFor("evil.io/app"); err == nil {
+		t.Fatalf("Expected error for blocked registry")
+	}
+}
@@ -0,0 +1,272 @@
+package reggie
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type (
+	// Capabilities are the parts of the distribution spec a registry
+	// supports, as found by Probe.
+	Capabilities struct {
+		// APIVersion is the Docker-Distribution-Api-Version header served
+		// by the /v2/ endpoint, usually "registry/2.0", if any.
+		APIVersion string
+
+		// Catalog reports whether the registry serves /v2/_catalog.
+		Catalog bool
+
+		// Tested reports whether the capabilities below were tested in a
+		// scratch repository. Unless they were, they are all false and
+		// high-level operations assume the registry supports them.
+		Tested bool
+
+		ChunkedUploads bool
+		Mounts         bool
+		Referrers      bool
+
+		// Deletes reports whether the registry deletes blobs, and
+		// ManifestDeletes whether it deletes manifests by digest. Either
+		// may be disabled without the other.
+		Deletes         bool
+		ManifestDeletes bool
+	}
+
+	probeConfig struct {
+		ScratchRepository string
+	}
+
+	probeOption func(c *probeConfig)
+)
+
+// WithScratchRepository tests the capabilities which need content by pushing
+// a small blob to the given repository, mounting it into a repository nested
+// below it, and deleting both copies again if the registry allows it. A
+// manifest referring to the blob is pushed and deleted to test manifest
+// deletes.
+func WithScratchRepository(name string) probeOption {
+	return func(c *probeConfig) {
+		c.ScratchRepository = name
+	}
+}
+
+// Probe checks that the registry serves the /v2/ endpoint and finds which
+// parts of the spec it supports. The result is kept by the client, so
+// high-level operations such as PushBlob avoid strategies the registry is
+// known not to support.
+func (client *Client) Probe(ctx context.Context, opts ...probeOption) (caps *Capabilities, err error) {
+	conf := &probeConfig{}
+	for _, o := range opts {
+		o(conf)
+	}
+	ctx, span := client.startOperation(ctx, "Probe", conf.ScratchRepository, "", 0)
+	defer func() { endSpan(span, err) }()
+
+	resp, err := client.Do(client.NewRequest(GET, "/v2/").SetContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, newResponseError(resp)
+	}
+	caps = &Capabilities{APIVersion: resp.Header().Get("Docker-Distribution-Api-Version")}
+
+	req := client.NewRequest(GET, "/v2/_catalog").SetContext(ctx).SetQueryParam("n", "1")
+	if resp, err = client.Do(req); err != nil {
+		return nil, err
+	}
+	caps.Catalog = resp.StatusCode() == http.StatusOK
+
+	if conf.ScratchRepository != "" {
+		if err := client.probeScratch(ctx, conf.ScratchRepository, caps); err != nil {
+			return nil, err
+		}
+		caps.Tested = true
+	}
+
+	client.capsMu.Lock()
+	client.capabilities = caps
+	client.capsMu.Unlock()
+	return caps, nil
+}
+
+// Capabilities returns the capabilities found by the last successful Probe,
+// or nil if the registry has not been probed.
+func (client *Client) Capabilities() *Capabilities {
+	client.capsMu.Lock()
+	defer client.capsMu.Unlock()
+	return client.capabilities
+}
+
+// probeScratch tests the capabilities which need content in the scratch
+// repository name. Responses rejecting a request mark the capability as
+// unsupported; only failures to make requests are returned.
+func (client *Client) probeScratch(ctx context.Context, name string, caps *Capabilities) error {
+	content := []byte(fmt.Sprintf("reggie probe %d", time.Now().UnixNano()))
+	digest := DigestFromBytes(content)
+
+	uploaded, err := client.probeChunkedUpload(ctx, name, digest, content)
+	if err != nil {
+		return err
+	}
+	caps.ChunkedUploads = uploaded
+	if !uploaded {
+		// the other tests need the blob, however it gets there
+		desc := Descriptor{Digest: digest, Size: int64(len(content))}
+		open := func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(content)), nil
+		}
+		if err := client.uploadBlob(ctx, name, desc, open, &blobConfig{}); err != nil {
+			return err
+		}
+	}
+
+	mountName := name + "/probe-mount"
+	req := client.NewRequest(POST, "/v2/<name>/blobs/uploads/", WithName(mountName)).SetContext(ctx)
+	req.SetQueryParam("mount", digest).SetQueryParam("from", name)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode() {
+	case http.StatusCreated:
+		caps.Mounts = true
+	case http.StatusAccepted:
+		// the registry opened an upload session instead, which is
+		// abandoned
+		if resp.Header().Get("Location") != "" {
+			client.cancelSession(ctx, resp)
+		}
+	}
+
+	req = client.NewRequest(GET, "/v2/<name>/referrers/<digest>", WithName(name), WithDigest(digest)).SetContext(ctx)
+	if resp, err = client.Do(req); err != nil {
+		return err
+	}
+	caps.Referrers = resp.StatusCode() == http.StatusOK
+
+	layer := Descriptor{MediaType: MediaTypeArtifactFile, Digest: digest, Size: int64(len(content))}
+	if caps.ManifestDeletes, err = client.probeManifestDeletes(ctx, name, layer); err != nil {
+		return err
+	}
+
+	req = client.NewRequest(DELETE, "/v2/<name>/blobs/<digest>", WithName(name), WithDigest(digest)).SetContext(ctx)
+	if resp, err = client.Do(req); err != nil {
+		return err
+	}
+	caps.Deletes = resp.StatusCode() == http.StatusAccepted
+	if caps.Deletes && caps.Mounts {
+		req = client.NewRequest(DELETE, "/v2/<name>/blobs/<digest>", WithName(mountName), WithDigest(digest)).SetContext(ctx)
+		if _, err := client.Do(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probeChunkedUpload uploads content in two chunks, returning whether the
+// registry accepted them.
+func (client *Client) probeChunkedUpload(ctx context.Context, name string, digest string, content []byte) (bool, error) {
+	resp, err := client.Do(client.NewRequest(POST, "/v2/<name>/blobs/uploads/", WithName(name)).SetContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode() != http.StatusAccepted {
+		return false, nil
+	}
+	half := len(content) / 2
+	for _, chunk := range []struct {
+		offset int
+		data   []byte
+	}{{0, content[:half]}, {half, content[half:]}} {
+		req := client.newLocationRequest(PATCH, resp).
+			SetContext(ctx).
+			SetHeader("Content-Type", "application/octet-stream").
+			SetHeader("Content-Length", strconv.Itoa(len(chunk.data))).
+			SetHeader("Content-Range", fmt.Sprintf("%d-%d", chunk.offset, chunk.offset+len(chunk.data)-1)).
+			SetBody(chunk.data)
+		session := resp
+		if resp, err = client.Do(req); err != nil {
+			return false, err
+		}
+		if resp.StatusCode() != http.StatusAccepted {
+			client.cancelSession(ctx, session)
+			return false, nil
+		}
+	}
+	req := client.newLocationRequest(PUT, resp).
+		SetContext(ctx).
+		SetHeader("Content-Length", "0").
+		SetQueryParam("digest", digest)
+	if resp, err = client.Do(req); err != nil {
+		return false, err
+	}
+	return resp.StatusCode() == http.StatusCreated, nil
+}
+
+// probeManifestDeletes pushes an untagged manifest with layer as its only
+// layer, returning whether the registry then deletes it by digest. The empty
+// config it refers to is left in the repository, as other content may
+// share it.
+func (client *Client) probeManifestDeletes(ctx context.Context, name string, layer Descriptor) (bool, error) {
+	open := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(emptyJSON)), nil
+	}
+	if err := client.uploadBlob(ctx, name, EmptyConfig, open, &blobConfig{}); err != nil {
+		return false, err
+	}
+	content, err := json.Marshal(Artifact{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageManifest,
+		ArtifactType:  "application/vnd.reggie.probe.v1",
+		Config:        EmptyConfig,
+		Layers:        []Descriptor{layer},
+	})
+	if err != nil {
+		return false, err
+	}
+	digest := DigestFromBytes(content)
+	req := client.NewRequest(PUT, "/v2/<name>/manifests/<reference>", WithName(name), WithReference(digest)).
+		SetContext(ctx).
+		SetHeader("Content-Type", MediaTypeImageManifest).
+		SetBody(content)
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode() != http.StatusCreated {
+		return false, nil
+	}
+	req = client.NewRequest(DELETE, "/v2/<name>/manifests/<reference>", WithName(name), WithReference(digest)).SetContext(ctx)
+	if resp, err = client.Do(req); err != nil {
+		return false, err
+	}
+	return resp.StatusCode() == http.StatusAccepted, nil
+}
+
+// cancelSession cancels an upload session abandoned by the probe. Failures
+// do not fail the probe, as the registry eventually expires the session, but
+// are logged.
+func (client *Client) cancelSession(ctx context.Context, session *Response) {
+	resp, err := client.Do(client.newLocationRequest(DELETE, session).SetContext(ctx))
+	switch {
+	case err != nil:
+		client.logger.WarnContext(ctx, "cancelling upload session", slog.String("error", RedactError(err)))
+	case resp.IsError() && resp.StatusCode() != http.StatusNotFound:
+		client.logger.WarnContext(ctx, "cancelling upload session", slog.String("error", RedactError(newResponseError(resp))))
+	}
+}
+
+// allows returns whether the registry supports the capability tested by
+// supported, assuming it does unless capabilities were tested.
+func (client *Client) allows(supported func(caps *Capabilities) bool) bool {
+	caps := client.Capabilities()
+	return caps == nil || !caps.Tested || supported(caps)
+}
@@ -0,0 +1,95 @@
+package reggie
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bloodorangeio/reggie/reggietest"
+)
+
+func TestProbe(t *testing.T) {
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	client, err := NewClient(registry.URL)
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	if client.Capabilities() != nil {
+		t.Fatalf("Expected no capabilities before probing")
+	}
+
+	caps, err := client.Probe(context.Background())
+	if err != nil {
+		t.Fatalf("Errors probing registry: %s", err)
+	}
+	if caps.APIVersion != "registry/2.0" || !caps.Catalog || caps.Tested || caps.Mounts {
+		t.Fatalf("Unexpected capabilities without scratch repository: %+v", caps)
+	}
+
+	caps, err = client.Probe(context.Background(), WithScratchRepository("probe/scratch"))
+	if err != nil {
+		t.Fatalf("Errors probing registry: %s", err)
+	}
+	expected := Capabilities{APIVersion: "registry/2.0", Catalog: true, Tested: true,
+		ChunkedUploads: true, Mounts: true, Referrers: true, Deletes: true, ManifestDeletes: true}
+	if *caps != expected || client.Capabilities() != caps {
+		t.Fatalf("Expected all capabilities but got %+v", caps)
+	}
+}
+
+func TestProbeLimitedRegistry(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithDeletesDisabled(), reggietest.WithoutReferrersAPI())
+	defer registry.Close()
+	registry.InjectFault(reggietest.Fault{Method: PATCH, Status: http.StatusMethodNotAllowed, Code: "UNSUPPORTED"})
+	registry.InjectFault(reggietest.Fault{Method: POST, Status: http.StatusAccepted, Match: func(req *http.Request) bool {
+		return req.URL.Query().Get("mount") != ""
+	}})
+	client, err := NewClient(registry.URL)
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	caps, err := client.Probe(context.Background(), WithScratchRepository("probe/scratch"))
+	if err != nil {
+		t.Fatalf("Errors probing registry: %s", err)
+	}
+	if !caps.Tested || caps.ChunkedUploads || caps.Mounts || caps.Referrers || caps.Deletes || caps.ManifestDeletes {
+		t.Fatalf("Expected unsupported capabilities but got %+v", caps)
+	}
+
+	// the faults would fail a chunked upload or a mount, so the push only
+	// succeeds if the client falls back to a monolithic upload
+	content := []byte("pushed to a limited registry")
+	desc := Descriptor{Digest: DigestFromBytes(content), Size: int64(len(content))}
+	open := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+	err = client.PushBlob(context.Background(), "org/app", desc, open, WithChunkSize(8), WithMountFrom("probe/scratch"))
+	if err != nil {
+		t.Fatalf("Errors pushing blob: %s", err)
+	}
+}
+
+func TestProbeLogsCancelledSessions(t *testing.T) {
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	registry.InjectFault(reggietest.Fault{Method: PATCH, Status: http.StatusMethodNotAllowed, Code: "UNSUPPORTED"})
+	registry.InjectFault(reggietest.Fault{Method: DELETE, Path: "/blobs/uploads/", Status: http.StatusInternalServerError})
+	var buf bytes.Buffer
+	client, err := NewClient(registry.URL, WithLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	if _, err := client.Probe(context.Background(), WithScratchRepository("probe/scratch")); err != nil {
+		t.Fatalf("Errors probing registry: %s", err)
+	}
+	if !strings.Contains(buf.String(), "cancelling upload session") || !strings.Contains(buf.String(), "500") {
+		t.Fatalf("Expected failure to cancel the session to be logged but got %q", buf.String())
+	}
+}
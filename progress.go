@@ -0,0 +1,172 @@
+package reggie
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultProgressInterval is the minimum time between two
+	// ProgressTransferred events for the same blob.
+	DefaultProgressInterval = 100 * time.Millisecond
+)
+
+const (
+	// ProgressStarted is emitted when a transfer begins.
+	ProgressStarted ProgressEventType = "started"
+
+	// ProgressTransferred is emitted periodically as bytes are sent or received.
+	ProgressTransferred ProgressEventType = "transferred"
+
+	// ProgressChunkCommitted is emitted when the registry accepts a chunk of
+	// a chunked upload.
+	ProgressChunkCommitted ProgressEventType = "chunk-committed"
+
+	// ProgressRetried is emitted when a transfer restarts from the beginning,
+	// e.g. after the registry asked for authentication.
+	ProgressRetried ProgressEventType = "retried"
+
+	// ProgressVerified is emitted when the content of a download has been
+	// checked against its digest and size.
+	ProgressVerified ProgressEventType = "verified"
+
+	// ProgressSkippedExists is emitted when an upload is skipped because the
+	// blob already exists in the repository.
+	ProgressSkippedExists ProgressEventType = "skipped-exists"
+
+	// ProgressMounted is emitted when a blob is mounted from another
+	// repository instead of being uploaded.
+	ProgressMounted ProgressEventType = "mounted"
+
+	// ProgressCompleted is emitted when a transfer finishes successfully.
+	ProgressCompleted ProgressEventType = "completed"
+)
+
+type (
+	// ProgressEventType identifies the kind of a ProgressEvent.
+	ProgressEventType string
+
+	// ProgressEvent describes the state of a blob transfer.
+	ProgressEvent struct {
+		Type        ProgressEventType `json:"type"`
+		Digest      string            `json:"digest"`
+		Total       int64             `json:"total"`
+		Transferred int64             `json:"transferred"`
+		Time        time.Time         `json:"time"`
+	}
+
+	// ProgressFunc receives progress events for a blob transfer.
+	ProgressFunc func(ProgressEvent)
+
+	// progressReporter emits the events of a single transfer, throttling
+	// ProgressTransferred events to the configured interval.
+	progressReporter struct {
+		fn       ProgressFunc
+		interval time.Duration
+		digest   string
+		total    int64
+
+		mu          sync.Mutex
+		transferred int64
+		last        time.Time
+	}
+
+	// progressReader counts the bytes read through it.
+	progressReader struct {
+		io.Reader
+		reporter *progressReporter
+	}
+
+	// progressWriter counts the bytes written through it.
+	progressWriter struct {
+		io.Writer
+		reporter *progressReporter
+	}
+)
+
+func newProgressReporter(fn ProgressFunc, interval time.Duration, desc Descriptor) *progressReporter {
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	return &progressReporter{fn: fn, interval: interval, digest: desc.Digest, total: desc.Size}
+}
+
+// emit sends an event of the given type. A nil reporter discards events.
+func (p *progressReporter) emit(t ProgressEventType) {
+	if p == nil || p.fn == nil {
+		return
+	}
+	p.mu.Lock()
+	transferred := p.transferred
+	if t == ProgressTransferred {
+		p.last = time.Now()
+	}
+	p.mu.Unlock()
+	p.fn(ProgressEvent{
+		Type:        t,
+		Digest:      p.digest,
+		Total:       p.total,
+		Transferred: transferred,
+		Time:        time.Now(),
+	})
+}
+
+// add records n more bytes transferred, emitting an event if the interval
+// has elapsed since the last one.
+func (p *progressReporter) add(n int) {
+	if p == nil || n == 0 {
+		return
+	}
+	p.mu.Lock()
+	p.transferred += int64(n)
+	due := time.Since(p.last) >= p.interval
+	p.mu.Unlock()
+	if due {
+		p.emit(ProgressTransferred)
+	}
+}
+
+// flush emits a ProgressTransferred event regardless of the interval.
+func (p *progressReporter) flush() {
+	if p == nil {
+		return
+	}
+	p.emit(ProgressTransferred)
+}
+
+// reset starts counting transferred bytes from zero again.
+func (p *progressReporter) reset() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.transferred = 0
+	p.mu.Unlock()
+}
+
+func (p *progressReporter) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{Reader: r, reporter: p}
+}
+
+func (p *progressReporter) writer(w io.Writer) io.Writer {
+	if p == nil {
+		return w
+	}
+	return &progressWriter{Writer: w, reporter: p}
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.reporter.add(n)
+	return n, err
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	w.reporter.add(n)
+	return n, err
+}
@@ -0,0 +1,90 @@
+package reggie
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	repositoryMatcher = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*)*$`)
+	tagMatcher        = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+)
+
+type (
+	// Reference identifies a repository, and optionally a tag and/or digest,
+	// e.g. "r.mysite.io/myorg/myrepo:v1".
+	Reference struct {
+		// Registry is the registry host, including any port. It is empty
+		// for short names such as "myrepo:v1".
+		Registry   string
+		Repository string
+		Tag        string
+		Digest     string
+	}
+)
+
+// ParseReference parses a reference of the form
+// [registry/]repository[:tag][@digest].
+func ParseReference(s string) (Reference, error) {
+	var ref Reference
+	rest := s
+	if i := strings.Index(rest, "@"); i >= 0 {
+		ref.Digest = rest[i+1:]
+		rest = rest[:i]
+		if err := validateDigest(ref.Digest); err != nil {
+			return Reference{}, fmt.Errorf("invalid reference %q: %w", s, err)
+		}
+	}
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		ref.Tag = rest[i+1:]
+		rest = rest[:i]
+		if !tagMatcher.MatchString(ref.Tag) {
+			return Reference{}, fmt.Errorf("invalid reference %q: invalid tag %q", s, ref.Tag)
+		}
+	}
+	if i := strings.Index(rest, "/"); i >= 0 && isRegistryHost(rest[:i]) {
+		ref.Registry = rest[:i]
+		rest = rest[i+1:]
+	}
+	ref.Repository = rest
+	if !repositoryMatcher.MatchString(ref.Repository) {
+		return Reference{}, fmt.Errorf("invalid reference %q: invalid repository %q", s, ref.Repository)
+	}
+	return ref, nil
+}
+
+// isRegistryHost returns whether the first component of a reference names a
+// registry rather than a namespace.
+func isRegistryHost(component string) bool {
+	return strings.ContainsAny(component, ".:") || component == "localhost" ||
+		strings.ToLower(component) != component
+}
+
+// Name returns the registry and repository of the reference.
+func (ref Reference) Name() string {
+	if ref.Registry == "" {
+		return ref.Repository
+	}
+	return ref.Registry + "/" + ref.Repository
+}
+
+// Reference returns the digest of the reference if present, or else its tag.
+func (ref Reference) Reference() string {
+	if ref.Digest != "" {
+		return ref.Digest
+	}
+	return ref.Tag
+}
+
+// String returns the reference in its canonical form.
+func (ref Reference) String() string {
+	s := ref.Name()
+	if ref.Tag != "" {
+		s += ":" + ref.Tag
+	}
+	if ref.Digest != "" {
+		s += "@" + ref.Digest
+	}
+	return s
+}
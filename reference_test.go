@@ -0,0 +1,42 @@
+package reggie
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	digest := DigestFromBytes([]byte("x"))
+	for _, tc := range []struct {
+		in   string
+		want Reference
+	}{
+		{"myrepo", Reference{Repository: "myrepo"}},
+		{"myorg/myrepo:v1", Reference{Repository: "myorg/myrepo", Tag: "v1"}},
+		{"localhost/myrepo", Reference{Registry: "localhost", Repository: "myrepo"}},
+		{"localhost:5000/myrepo:v1", Reference{Registry: "localhost:5000", Repository: "myrepo", Tag: "v1"}},
+		{"r.mysite.io/a/b/c@" + digest, Reference{Registry: "r.mysite.io", Repository: "a/b/c", Digest: digest}},
+		{"r.mysite.io/a:v1@" + digest, Reference{Registry: "r.mysite.io", Repository: "a", Tag: "v1", Digest: digest}},
+	} {
+		ref, err := ParseReference(tc.in)
+		if err != nil {
+			t.Fatalf("Errors parsing %s: %s", tc.in, err)
+		}
+		if ref != tc.want {
+			t.Fatalf("Expected %+v but got %+v", tc.want, ref)
+		}
+		if ref.String() != tc.in {
+			t.Fatalf("Expected %s to round trip but got %s", tc.in, ref.String())
+		}
+	}
+
+	for _, in := range []string{"", "UPPER", "r.io/a:b:c", "a@sha256:abc", "r.io/a/:v1", "a:-v1"} {
+		if _, err := ParseReference(in); err == nil {
+			t.Fatalf("Expected error parsing %q", in)
+		}
+	}
+
+	ref, _ := ParseReference("r.io/a:v1@" + digest)
+	if ref.Reference() != digest {
+		t.Fatalf("Expected digest to take precedence over tag")
+	}
+}
@@ -0,0 +1,90 @@
+package reggie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ReferrersTag returns the tag under which registries without the referrers
+// API list the referrers of a subject, per the referrers tag schema.
+func ReferrersTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1)
+}
+
+// Referrers lists the manifests whose subject is the manifest with the
+// given digest, optionally only those with the given artifact type. It uses
+// the referrers API, falling back to the referrers tag schema for registries
+// which do not support it.
+func (client *Client) Referrers(ctx context.Context, name string, digest string, artifactType string) (referrers []Descriptor, err error) {
+	if err := validateDigest(digest); err != nil {
+		return nil, err
+	}
+	ctx, span := client.startOperation(ctx, "Referrers", name, digest, 0)
+	defer func() { endSpan(span, err) }()
+
+	if client.allows(func(caps *Capabilities) bool { return caps.Referrers }) {
+		req := client.NewRequest(GET, "/v2/<name>/referrers/<digest>", WithName(name), WithDigest(digest)).
+			SetContext(ctx).
+			SetHeader("Accept", MediaTypeImageIndex)
+		if artifactType != "" {
+			req.SetQueryParam("artifactType", artifactType)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		switch resp.StatusCode() {
+		case http.StatusOK:
+			referrers, err := parseIndex(resp.Body())
+			if err != nil {
+				return nil, fmt.Errorf("parsing referrers of %s: %w", digest, err)
+			}
+			return filterArtifactType(referrers, artifactType), nil
+		case http.StatusNotFound:
+		default:
+			return nil, newResponseError(resp)
+		}
+	}
+
+	_, content, err := client.GetManifest(ctx, name, ReferrersTag(digest))
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	referrers, err = parseIndex(content)
+	if err != nil {
+		return nil, fmt.Errorf("parsing referrers of %s: %w", digest, err)
+	}
+	return filterArtifactType(referrers, artifactType), nil
+}
+
+// parseIndex returns the manifests listed by an index.
+func parseIndex(content []byte) ([]Descriptor, error) {
+	var index struct {
+		Manifests []Descriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(content, &index); err != nil {
+		return nil, err
+	}
+	return index.Manifests, nil
+}
+
+// filterArtifactType returns the descriptors with the given artifact type,
+// or all of them if it is empty.
+func filterArtifactType(descs []Descriptor, artifactType string) []Descriptor {
+	if artifactType == "" {
+		return descs
+	}
+	var filtered []Descriptor
+	for _, d := range descs {
+		if d.ArtifactType == artifactType {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered
+}
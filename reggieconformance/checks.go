@@ -0,0 +1,589 @@
+package reggieconformance
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bloodorangeio/reggie"
+)
+
+const (
+	mediaTypeImageConfig = "application/vnd.oci.image.config.v1+json"
+	mediaTypeImageLayer  = "application/vnd.oci.image.layer.v1.tar"
+
+	// artifactType is the artifact type of the referrer pushed by checks.
+	artifactType = "application/vnd.reggie.conformance.test"
+)
+
+type (
+	// checkContext holds the client and the content shared by checks.
+	checkContext struct {
+		runner   *Runner
+		client   *reggie.Client
+		name     string
+		setupErr error
+
+		id       string
+		config   content
+		layer    content
+		manifest content
+		tags     []string
+		referrer content
+	}
+
+	// content is a blob or manifest pushed by the checks.
+	content struct {
+		reggie.Descriptor
+		data []byte
+	}
+
+	// imageManifest is the OCI image manifest schema.
+	imageManifest struct {
+		SchemaVersion int                 `json:"schemaVersion"`
+		MediaType     string              `json:"mediaType"`
+		ArtifactType  string              `json:"artifactType,omitempty"`
+		Config        reggie.Descriptor   `json:"config"`
+		Layers        []reggie.Descriptor `json:"layers"`
+		Subject       *reggie.Descriptor  `json:"subject,omitempty"`
+	}
+
+	// index is the OCI image index schema, as returned by the referrers API.
+	index struct {
+		Manifests []struct {
+			reggie.Descriptor
+			ArtifactType string `json:"artifactType"`
+		} `json:"manifests"`
+	}
+)
+
+var (
+	// checks are the checks of each workflow, run in order.
+	checks = map[Workflow][]checkDef{
+		Pull: {
+			{name: "GET /v2/ succeeds", run: checkBase, standalone: true},
+			{name: "HEAD manifest by tag", run: checkHeadManifest},
+			{name: "GET manifest by tag", run: checkGetManifestByTag},
+			{name: "GET manifest by digest", run: checkGetManifestByDigest},
+			{name: "HEAD blob", run: checkHeadBlob},
+			{name: "GET blob", run: checkGetBlob},
+			{name: "GET unknown manifest returns 404", run: checkUnknownManifest, standalone: true},
+			{name: "GET unknown blob returns 404", run: checkUnknownBlob, standalone: true},
+		},
+		Push: {
+			{name: "monolithic upload with POST and PUT", run: checkPostPutUpload, standalone: true},
+			{name: "monolithic upload with single POST", run: checkSinglePostUpload, standalone: true},
+			{name: "chunked upload", run: checkChunkedUpload, standalone: true},
+			{name: "cross-repository blob mount", run: checkMount},
+			{name: "push manifest by tag", run: checkPushManifestByTag},
+			{name: "push manifest by digest", run: checkPushManifestByDigest},
+		},
+		ContentDiscovery: {
+			{name: "list tags", run: checkListTags},
+			{name: "list tags with n", run: checkListTagsN},
+			{name: "list tags with last", run: checkListTagsLast},
+			{name: "list referrers", run: checkListReferrers},
+			{name: "list referrers filtered by artifactType", run: checkListReferrersFiltered},
+		},
+		ContentManagement: {
+			{name: "delete tag", run: checkDeleteTag},
+			{name: "delete manifest by digest", run: checkDeleteManifest},
+			{name: "delete blob", run: checkDeleteBlob},
+		},
+	}
+)
+
+// requireSetup returns an error if a check needs content which could not be
+// pushed.
+func (c *checkContext) requireSetup(def checkDef) error {
+	if def.standalone || c.setupErr == nil {
+		return nil
+	}
+	return fmt.Errorf("setup failed: %w", c.setupErr)
+}
+
+// do executes a request, returning an error if the status is not one of
+// the expected statuses.
+func (c *checkContext) do(ctx context.Context, req *reggie.Request, expected ...int) (*reggie.Response, error) {
+	resp, err := c.client.Do(req.SetContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range expected {
+		if resp.StatusCode() == status {
+			return resp, nil
+		}
+	}
+	return resp, unexpectedStatus(resp, expected...)
+}
+
+// unexpectedStatus returns an error describing an unexpected response.
+func unexpectedStatus(resp *reggie.Response, expected ...int) error {
+	msg := fmt.Sprintf("%s %s: expected status %s but got %d", resp.Request.Method,
+		reggie.RedactURL(resp.Request.URL), statusList(expected), resp.StatusCode())
+	if errs, err := resp.Errors(); err == nil {
+		for _, e := range errs {
+			msg += fmt.Sprintf(" (%s: %s)", e.Code, e.Message)
+		}
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+func statusList(statuses []int) string {
+	s := make([]string, len(statuses))
+	for i, status := range statuses {
+		s[i] = strconv.Itoa(status)
+	}
+	return strings.Join(s, " or ")
+}
+
+// randomContent returns n random bytes.
+func randomContent(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+func newContent(mediaType string, data []byte) content {
+	return content{
+		Descriptor: reggie.Descriptor{MediaType: mediaType, Digest: reggie.DigestFromBytes(data), Size: int64(len(data))},
+		data:       data,
+	}
+}
+
+// newManifest builds an image manifest, with a subject if set.
+func newManifest(config content, layer content, subject *reggie.Descriptor) content {
+	m := imageManifest{
+		SchemaVersion: 2,
+		MediaType:     reggie.MediaTypeImageManifest,
+		Config:        config.Descriptor,
+		Layers:        []reggie.Descriptor{layer.Descriptor},
+		Subject:       subject,
+	}
+	if subject != nil {
+		m.ArtifactType = artifactType
+	}
+	data, _ := json.Marshal(m)
+	return newContent(reggie.MediaTypeImageManifest, data)
+}
+
+// pushBlob pushes a blob with the client's high-level operation.
+func (c *checkContext) pushBlob(ctx context.Context, name string, blob content) error {
+	return c.client.PushBlob(ctx, name, blob.Descriptor, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(blob.data)), nil
+	})
+}
+
+// pushManifest pushes a manifest by tag or digest.
+func (c *checkContext) pushManifest(ctx context.Context, reference string, m content) (*reggie.Response, error) {
+	req := c.client.NewRequest(reggie.PUT, "/v2/<name>/manifests/<reference>",
+		reggie.WithName(c.name), reggie.WithReference(reference)).
+		SetHeader("Content-Type", m.MediaType).
+		SetBody(m.data)
+	return c.do(ctx, req, http.StatusCreated)
+}
+
+// setupContent pushes an image with several tags, and a referrer to it.
+func setupContent(ctx context.Context, c *checkContext) error {
+	c.id = hex.EncodeToString(randomContent(4))
+	c.config = newContent(mediaTypeImageConfig, []byte(fmt.Sprintf(
+		`{"architecture":"amd64","os":"linux","config":{"Labels":{"reggie.conformance":"%s"}},"rootfs":{"type":"layers","diff_ids":[]}}`, c.id)))
+	c.layer = newContent(mediaTypeImageLayer, randomContent(1024))
+	c.manifest = newManifest(c.config, c.layer, nil)
+	c.tags = []string{c.id + "-a", c.id + "-b", c.id + "-c"}
+
+	for _, blob := range []content{c.config, c.layer} {
+		if err := c.pushBlob(ctx, c.name, blob); err != nil {
+			return err
+		}
+	}
+	for _, tag := range c.tags {
+		if _, err := c.pushManifest(ctx, tag, c.manifest); err != nil {
+			return err
+		}
+	}
+	c.referrer = newManifest(c.config, c.layer, &c.manifest.Descriptor)
+	_, err := c.pushManifest(ctx, c.referrer.Digest, c.referrer)
+	return err
+}
+
+func checkBase(ctx context.Context, c *checkContext) error {
+	_, err := c.do(ctx, c.client.NewRequest(reggie.GET, "/v2/"), http.StatusOK)
+	return err
+}
+
+func checkHeadManifest(ctx context.Context, c *checkContext) error {
+	req := c.client.NewRequest(reggie.HEAD, "/v2/<name>/manifests/<reference>",
+		reggie.WithName(c.name), reggie.WithReference(c.tags[0])).
+		SetHeader("Accept", reggie.MediaTypeImageManifest)
+	resp, err := c.do(ctx, req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if digest := resp.Header().Get("Docker-Content-Digest"); digest != "" && digest != c.manifest.Digest {
+		return fmt.Errorf("expected Docker-Content-Digest %s but got %s", c.manifest.Digest, digest)
+	}
+	return nil
+}
+
+func (c *checkContext) getManifest(ctx context.Context, reference string) error {
+	req := c.client.NewRequest(reggie.GET, "/v2/<name>/manifests/<reference>",
+		reggie.WithName(c.name), reggie.WithReference(reference)).
+		SetHeader("Accept", reggie.MediaTypeImageManifest)
+	resp, err := c.do(ctx, req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(resp.Body(), c.manifest.data) {
+		return fmt.Errorf("manifest %s differs from the manifest pushed", reference)
+	}
+	return nil
+}
+
+func checkGetManifestByTag(ctx context.Context, c *checkContext) error {
+	return c.getManifest(ctx, c.tags[0])
+}
+
+func checkGetManifestByDigest(ctx context.Context, c *checkContext) error {
+	return c.getManifest(ctx, c.manifest.Digest)
+}
+
+func checkHeadBlob(ctx context.Context, c *checkContext) error {
+	req := c.client.NewRequest(reggie.HEAD, "/v2/<name>/blobs/<digest>",
+		reggie.WithName(c.name), reggie.WithDigest(c.layer.Digest))
+	resp, err := c.do(ctx, req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if length := resp.Header().Get("Content-Length"); length != "" && length != strconv.FormatInt(c.layer.Size, 10) {
+		return fmt.Errorf("expected Content-Length %d but got %s", c.layer.Size, length)
+	}
+	return nil
+}
+
+func checkGetBlob(ctx context.Context, c *checkContext) error {
+	req := c.client.NewRequest(reggie.GET, "/v2/<name>/blobs/<digest>",
+		reggie.WithName(c.name), reggie.WithDigest(c.layer.Digest))
+	resp, err := c.do(ctx, req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(resp.Body(), c.layer.data) {
+		return fmt.Errorf("blob %s differs from the blob pushed", c.layer.Digest)
+	}
+	return nil
+}
+
+func checkUnknownManifest(ctx context.Context, c *checkContext) error {
+	req := c.client.NewRequest(reggie.GET, "/v2/<name>/manifests/<reference>",
+		reggie.WithName(c.name), reggie.WithReference(reggie.DigestFromBytes(randomContent(16))))
+	_, err := c.do(ctx, req, http.StatusNotFound)
+	return err
+}
+
+func checkUnknownBlob(ctx context.Context, c *checkContext) error {
+	req := c.client.NewRequest(reggie.GET, "/v2/<name>/blobs/<digest>",
+		reggie.WithName(c.name), reggie.WithDigest(reggie.DigestFromBytes(randomContent(16))))
+	_, err := c.do(ctx, req, http.StatusNotFound)
+	return err
+}
+
+// newLocationRequest builds a request against the Location of a response.
+func (c *checkContext) newLocationRequest(method string, resp *reggie.Response) (*reggie.Request, error) {
+	loc, err := locationURL(resp)
+	if err != nil {
+		return nil, err
+	}
+	req := c.client.NewRequest(method, "")
+	req.URL = loc
+	return req, nil
+}
+
+// openUpload opens an upload session.
+func (c *checkContext) openUpload(ctx context.Context) (*reggie.Response, error) {
+	req := c.client.NewRequest(reggie.POST, "/v2/<name>/blobs/uploads/", reggie.WithName(c.name))
+	return c.do(ctx, req, http.StatusAccepted)
+}
+
+func checkPostPutUpload(ctx context.Context, c *checkContext) error {
+	blob := newContent(mediaTypeImageLayer, randomContent(512))
+	resp, err := c.openUpload(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := c.newLocationRequest(reggie.PUT, resp)
+	if err != nil {
+		return err
+	}
+	req.SetQueryParam("digest", blob.Digest).
+		SetHeader("Content-Type", "application/octet-stream").
+		SetBody(blob.data)
+	resp, err = c.do(ctx, req, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	_, err = locationURL(resp)
+	return err
+}
+
+func checkSinglePostUpload(ctx context.Context, c *checkContext) error {
+	blob := newContent(mediaTypeImageLayer, randomContent(512))
+	req := c.client.NewRequest(reggie.POST, "/v2/<name>/blobs/uploads/", reggie.WithName(c.name)).
+		SetQueryParam("digest", blob.Digest).
+		SetHeader("Content-Type", "application/octet-stream").
+		SetBody(blob.data)
+	resp, err := c.do(ctx, req, http.StatusCreated, http.StatusAccepted)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusAccepted {
+		return skipf("registry opened an upload session rather than accepting the blob")
+	}
+	return nil
+}
+
+func checkChunkedUpload(ctx context.Context, c *checkContext) error {
+	blob := newContent(mediaTypeImageLayer, randomContent(1024))
+	resp, err := c.openUpload(ctx)
+	if err != nil {
+		return err
+	}
+	half := len(blob.data) / 2
+	for _, chunk := range [][2]int{{0, half}, {half, len(blob.data)}} {
+		req, err := c.newLocationRequest(reggie.PATCH, resp)
+		if err != nil {
+			return err
+		}
+		req.SetHeader("Content-Type", "application/octet-stream").
+			SetHeader("Content-Range", fmt.Sprintf("%d-%d", chunk[0], chunk[1]-1)).
+			SetBody(blob.data[chunk[0]:chunk[1]])
+		if resp, err = c.do(ctx, req, http.StatusAccepted); err != nil {
+			return err
+		}
+	}
+	req, err := c.newLocationRequest(reggie.PUT, resp)
+	if err != nil {
+		return err
+	}
+	req.SetQueryParam("digest", blob.Digest)
+	_, err = c.do(ctx, req, http.StatusCreated)
+	return err
+}
+
+func checkMount(ctx context.Context, c *checkContext) error {
+	blob := newContent(mediaTypeImageLayer, randomContent(512))
+	if err := c.pushBlob(ctx, c.runner.mountFrom, blob); err != nil {
+		return err
+	}
+	req := c.client.NewRequest(reggie.POST, "/v2/<name>/blobs/uploads/", reggie.WithName(c.name)).
+		SetQueryParam("mount", blob.Digest).
+		SetQueryParam("from", c.runner.mountFrom)
+	resp, err := c.do(ctx, req, http.StatusCreated, http.StatusAccepted)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusAccepted {
+		return skipf("registry opened an upload session rather than mounting the blob")
+	}
+	return nil
+}
+
+func checkPushManifestByTag(ctx context.Context, c *checkContext) error {
+	resp, err := c.pushManifest(ctx, c.id+"-pushed", c.manifest)
+	if err != nil {
+		return err
+	}
+	_, err = locationURL(resp)
+	return err
+}
+
+func checkPushManifestByDigest(ctx context.Context, c *checkContext) error {
+	_, err := c.pushManifest(ctx, c.manifest.Digest, c.manifest)
+	return err
+}
+
+// listTags lists tags with the given query parameters.
+func (c *checkContext) listTags(ctx context.Context, params map[string]string) (*reggie.Response, []string, error) {
+	req := c.client.NewRequest(reggie.GET, "/v2/<name>/tags/list", reggie.WithName(c.name))
+	req.SetQueryParams(params)
+	resp, err := c.do(ctx, req, http.StatusOK)
+	if err != nil {
+		return nil, nil, err
+	}
+	var list struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal(resp.Body(), &list); err != nil {
+		return nil, nil, fmt.Errorf("parsing tags: %w", err)
+	}
+	return resp, list.Tags, nil
+}
+
+func checkListTags(ctx context.Context, c *checkContext) error {
+	_, tags, err := c.listTags(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, tag := range c.tags {
+		if !contains(tags, tag) {
+			return fmt.Errorf("tag %s is missing from %v", tag, tags)
+		}
+	}
+	return nil
+}
+
+func checkListTagsN(ctx context.Context, c *checkContext) error {
+	resp, tags, err := c.listTags(ctx, map[string]string{"n": "1"})
+	if err != nil {
+		return err
+	}
+	if len(tags) != 1 {
+		return fmt.Errorf("expected 1 tag but got %d", len(tags))
+	}
+	if link := resp.Header().Get("Link"); !strings.Contains(link, `rel="next"`) {
+		return fmt.Errorf("expected a Link header to the next page but got %q", link)
+	}
+	return nil
+}
+
+func checkListTagsLast(ctx context.Context, c *checkContext) error {
+	last := c.tags[0]
+	_, tags, err := c.listTags(ctx, map[string]string{"last": last})
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if tag <= last {
+			return fmt.Errorf("expected tags after %s but got %s", last, tag)
+		}
+	}
+	if !sort.StringsAreSorted(tags) {
+		return fmt.Errorf("expected tags in lexical order but got %v", tags)
+	}
+	if !contains(tags, c.tags[1]) {
+		return fmt.Errorf("tag %s is missing from %v", c.tags[1], tags)
+	}
+	return nil
+}
+
+// listReferrers lists the referrers of the test manifest.
+func (c *checkContext) listReferrers(ctx context.Context, params map[string]string) (*reggie.Response, *index, error) {
+	req := c.client.NewRequest(reggie.GET, "/v2/<name>/referrers/<digest>",
+		reggie.WithName(c.name), reggie.WithDigest(c.manifest.Digest))
+	req.SetQueryParams(params)
+	resp, err := c.do(ctx, req, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return nil, nil, skipf("registry does not support the referrers API")
+	}
+	if contentType := resp.Header().Get("Content-Type"); !strings.HasPrefix(contentType, reggie.MediaTypeImageIndex) {
+		return nil, nil, fmt.Errorf("expected Content-Type %s but got %q", reggie.MediaTypeImageIndex, contentType)
+	}
+	var referrers index
+	if err := json.Unmarshal(resp.Body(), &referrers); err != nil {
+		return nil, nil, fmt.Errorf("parsing referrers: %w", err)
+	}
+	return resp, &referrers, nil
+}
+
+// hasReferrer returns whether an index lists the test referrer.
+func (c *checkContext) hasReferrer(referrers *index) bool {
+	for _, m := range referrers.Manifests {
+		if m.Digest == c.referrer.Digest {
+			return true
+		}
+	}
+	return false
+}
+
+func checkListReferrers(ctx context.Context, c *checkContext) error {
+	_, referrers, err := c.listReferrers(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if !c.hasReferrer(referrers) {
+		return fmt.Errorf("referrer %s is missing", c.referrer.Digest)
+	}
+	return nil
+}
+
+func checkListReferrersFiltered(ctx context.Context, c *checkContext) error {
+	resp, referrers, err := c.listReferrers(ctx, map[string]string{"artifactType": artifactType})
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(resp.Header().Get("OCI-Filters-Applied"), "artifactType") {
+		return skipf("registry does not filter referrers")
+	}
+	for _, m := range referrers.Manifests {
+		if m.ArtifactType != artifactType {
+			return fmt.Errorf("filtered referrers include %s of type %q", m.Digest, m.ArtifactType)
+		}
+	}
+	if !c.hasReferrer(referrers) {
+		return fmt.Errorf("referrer %s is missing", c.referrer.Digest)
+	}
+	return nil
+}
+
+// deleteAndVerify deletes content, skipping if deletes are unsupported, and
+// verifies it is no longer found. newRequest builds requests for the content.
+func (c *checkContext) deleteAndVerify(ctx context.Context, newRequest func(method string) *reggie.Request) error {
+	resp, err := c.do(ctx, newRequest(reggie.DELETE),
+		http.StatusAccepted, http.StatusBadRequest, http.StatusMethodNotAllowed)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != http.StatusAccepted {
+		return skipf("registry does not support deletes (status %d)", resp.StatusCode())
+	}
+	_, err = c.do(ctx, newRequest(reggie.HEAD), http.StatusNotFound)
+	return err
+}
+
+// manifestRequest returns a function building requests for a manifest.
+func (c *checkContext) manifestRequest(reference string) func(method string) *reggie.Request {
+	return func(method string) *reggie.Request {
+		return c.client.NewRequest(method, "/v2/<name>/manifests/<reference>",
+			reggie.WithName(c.name), reggie.WithReference(reference))
+	}
+}
+
+func checkDeleteTag(ctx context.Context, c *checkContext) error {
+	return c.deleteAndVerify(ctx, c.manifestRequest(c.tags[2]))
+}
+
+func checkDeleteManifest(ctx context.Context, c *checkContext) error {
+	for _, digest := range []string{c.referrer.Digest, c.manifest.Digest} {
+		if err := c.deleteAndVerify(ctx, c.manifestRequest(digest)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkDeleteBlob(ctx context.Context, c *checkContext) error {
+	return c.deleteAndVerify(ctx, func(method string) *reggie.Request {
+		return c.client.NewRequest(method, "/v2/<name>/blobs/<digest>",
+			reggie.WithName(c.name), reggie.WithDigest(c.layer.Digest))
+	})
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,267 @@
+// Package reggieconformance runs the workflows of the OCI distribution-spec
+// conformance tests against a registry, reporting the result of each check
+// with a transcript of the requests it made.
+package reggieconformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bloodorangeio/reggie"
+)
+
+const (
+	// DefaultNamespace is the repository checks push content to.
+	DefaultNamespace = "reggie-conformance/test"
+
+	// DefaultCrossmountNamespace is the repository blobs are mounted from.
+	DefaultCrossmountNamespace = "reggie-conformance/crossmount"
+
+	// maxTranscriptBody limits the response body recorded per exchange.
+	maxTranscriptBody = 4096
+
+	// maxRedactedBody limits the response body read for redaction, which
+	// needs the whole body. Token server replies are far smaller.
+	maxRedactedBody = 1 << 20
+)
+
+// Workflows of the distribution spec.
+const (
+	Pull              Workflow = "pull"
+	Push              Workflow = "push"
+	ContentDiscovery  Workflow = "content-discovery"
+	ContentManagement Workflow = "content-management"
+
+	// Setup pushes the content used by the other workflows.
+	Setup Workflow = "setup"
+)
+
+// Statuses of a check.
+const (
+	Passed  Status = "pass"
+	Failed  Status = "fail"
+	Skipped Status = "skip"
+)
+
+var (
+	// AllWorkflows are run by default, in order.
+	AllWorkflows = []Workflow{Pull, Push, ContentDiscovery, ContentManagement}
+)
+
+type (
+	// Workflow is a group of checks.
+	Workflow string
+
+	// Status is the result of a check.
+	Status string
+
+	// Check is the result of a single check.
+	Check struct {
+		Workflow   Workflow      `json:"workflow"`
+		Name       string        `json:"name"`
+		Status     Status        `json:"status"`
+		Message    string        `json:"message,omitempty"`
+		Duration   time.Duration `json:"duration"`
+		Transcript []Exchange    `json:"transcript,omitempty"`
+	}
+
+	// Exchange is a request made by a check and the response it received,
+	// with credentials redacted.
+	Exchange struct {
+		Method         string      `json:"method"`
+		URL            string      `json:"url"`
+		RequestHeader  http.Header `json:"request_header,omitempty"`
+		StatusCode     int         `json:"status_code"`
+		ResponseHeader http.Header `json:"response_header,omitempty"`
+		ResponseBody   string      `json:"response_body,omitempty"`
+
+		// Error is why the request failed without a response, if it did.
+		Error string `json:"error,omitempty"`
+	}
+
+	// Runner runs conformance checks with a client.
+	Runner struct {
+		client     *reggie.Client
+		name       string
+		mountFrom  string
+		workflows  []Workflow
+		checkNames map[string]bool
+
+		mu         sync.Mutex
+		transcript []*Exchange
+	}
+
+	// Option configures a Runner.
+	Option func(r *Runner)
+
+	// checkFunc runs a check, returning an error created with skipf to
+	// skip it.
+	checkFunc func(ctx context.Context, c *checkContext) error
+
+	// checkDef defines a check of a workflow. Standalone checks do not
+	// need the content pushed by setup.
+	checkDef struct {
+		name       string
+		run        checkFunc
+		standalone bool
+	}
+
+	skipError struct {
+		msg string
+	}
+)
+
+// WithNamespace sets the repository checks push content to. Defaults to
+// DefaultNamespace.
+func WithNamespace(name string) Option {
+	return func(r *Runner) {
+		r.name = name
+	}
+}
+
+// WithCrossmountNamespace sets the repository blobs are mounted from.
+// Defaults to DefaultCrossmountNamespace.
+func WithCrossmountNamespace(name string) Option {
+	return func(r *Runner) {
+		r.mountFrom = name
+	}
+}
+
+// WithWorkflows sets the workflows to run. Defaults to AllWorkflows.
+func WithWorkflows(workflows ...Workflow) Option {
+	return func(r *Runner) {
+		r.workflows = workflows
+	}
+}
+
+// WithChecks restricts the checks run to those with the given names.
+func WithChecks(names ...string) Option {
+	return func(r *Runner) {
+		r.checkNames = map[string]bool{}
+		for _, name := range names {
+			r.checkNames[name] = true
+		}
+	}
+}
+
+// NewRunner returns a Runner making requests with client. While checks are
+// running, the client's transport is wrapped to record transcripts, so the
+// client should not be used for other requests until Run returns.
+func NewRunner(client *reggie.Client, opts ...Option) *Runner {
+	r := &Runner{
+		client:    client,
+		name:      DefaultNamespace,
+		mountFrom: DefaultCrossmountNamespace,
+		workflows: AllWorkflows,
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// ParseWorkflow parses the name of a workflow.
+func ParseWorkflow(s string) (Workflow, error) {
+	for _, w := range AllWorkflows {
+		if string(w) == s {
+			return w, nil
+		}
+	}
+	return "", fmt.Errorf("unknown workflow %q", s)
+}
+
+// Run pushes the content used by the checks, then runs the checks of each
+// workflow in order. Checks depending on content which could not be pushed
+// fail.
+func (r *Runner) Run(ctx context.Context) *Report {
+	report := &Report{
+		Registry:  r.client.Config.Address,
+		Namespace: r.name,
+		Started:   time.Now(),
+	}
+	transport := r.client.GetClient().Transport
+	r.client.UseTransport(func(next http.RoundTripper) http.RoundTripper {
+		return &recorder{next: next, runner: r}
+	})
+	defer r.client.SetTransport(transport)
+
+	c := &checkContext{runner: r, client: r.client, name: r.name}
+	report.Checks = append(report.Checks, r.runCheck(ctx, c, Setup, checkDef{name: "push test content", run: setupContent, standalone: true}))
+	for _, w := range r.workflows {
+		for _, def := range checks[w] {
+			if r.checkNames != nil && !r.checkNames[def.name] {
+				continue
+			}
+			report.Checks = append(report.Checks, r.runCheck(ctx, c, w, def))
+		}
+	}
+	report.Duration = time.Since(report.Started)
+	return report
+}
+
+// runCheck runs a single check, recording its transcript.
+func (r *Runner) runCheck(ctx context.Context, c *checkContext, w Workflow, def checkDef) Check {
+	r.mu.Lock()
+	r.transcript = nil
+	r.mu.Unlock()
+
+	start := time.Now()
+	err := c.requireSetup(def)
+	if err == nil {
+		err = def.run(ctx, c)
+	}
+	check := Check{Workflow: w, Name: def.name, Status: Passed, Duration: time.Since(start)}
+	var skip *skipError
+	switch {
+	case errors.As(err, &skip):
+		check.Status = Skipped
+		check.Message = skip.msg
+	case err != nil:
+		check.Status = Failed
+		check.Message = reggie.RedactError(err)
+	}
+	if w == Setup && err != nil {
+		c.setupErr = err
+	}
+
+	r.mu.Lock()
+	for _, e := range r.transcript {
+		check.Transcript = append(check.Transcript, *e)
+	}
+	r.transcript = nil
+	r.mu.Unlock()
+	return check
+}
+
+// skipf returns an error skipping a check.
+func skipf(format string, args ...interface{}) error {
+	return &skipError{msg: fmt.Sprintf(format, args...)}
+}
+
+// Error satisfies the error interface.
+func (e *skipError) Error() string {
+	return "skipped: " + e.msg
+}
+
+// locationURL resolves the Location header of a response against the URL of
+// its request.
+func locationURL(resp *reggie.Response) (string, error) {
+	loc := resp.Header().Get("Location")
+	if loc == "" {
+		return "", fmt.Errorf("%s %s: response has no Location header", resp.Request.Method, reggie.RedactURL(resp.Request.URL))
+	}
+	base, err := url.Parse(resp.Request.URL)
+	if err != nil {
+		return "", err
+	}
+	u, err := base.Parse(loc)
+	if err != nil {
+		return "", fmt.Errorf("parsing Location header %q: %w", reggie.RedactURL(loc), err)
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,242 @@
+package reggieconformance_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bloodorangeio/reggie"
+	"github.com/bloodorangeio/reggie/reggieconformance"
+	"github.com/bloodorangeio/reggie/reggietest"
+)
+
+type (
+	// tokenCollector collects the bearer tokens sent by a client.
+	tokenCollector struct {
+		next   http.RoundTripper
+		mu     sync.Mutex
+		tokens map[string]bool
+	}
+)
+
+func runConformance(t *testing.T, registry *reggietest.Registry, opts ...reggieconformance.Option) *reggieconformance.Report {
+	t.Helper()
+	report, _ := runConformanceWithTokens(t, registry, opts...)
+	return report
+}
+
+// runConformanceWithTokens runs the conformance checks, also returning the
+// bearer tokens the client was issued.
+func runConformanceWithTokens(t *testing.T, registry *reggietest.Registry, opts ...reggieconformance.Option) (*reggieconformance.Report, map[string]bool) {
+	t.Helper()
+	client, err := reggie.NewClient(registry.URL, reggie.WithUsernamePassword("user", "pass"))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	collector := &tokenCollector{tokens: map[string]bool{}}
+	client.UseTransport(func(next http.RoundTripper) http.RoundTripper {
+		collector.next = next
+		return collector
+	})
+	report := reggieconformance.NewRunner(client, opts...).Run(context.Background())
+	return report, collector.tokens
+}
+
+func (c *tokenCollector) RoundTrip(req *http.Request) (*http.Response, error) {
+	if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+		c.mu.Lock()
+		c.tokens[token] = true
+		c.mu.Unlock()
+	}
+	return c.next.RoundTrip(req)
+}
+
+func checkStatuses(report *reggieconformance.Report) map[string]reggieconformance.Status {
+	statuses := map[string]reggieconformance.Status{}
+	for _, c := range report.Checks {
+		statuses[c.Name] = c.Status
+	}
+	return statuses
+}
+
+func TestConformance(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithTokenAuth("user", "pass"))
+	defer registry.Close()
+
+	report, tokens := runConformanceWithTokens(t, registry)
+	passed, failed, skipped := report.Counts()
+	if failed != 0 || skipped != 0 || !report.Passed() {
+		for _, c := range report.Checks {
+			if c.Status != reggieconformance.Passed {
+				t.Errorf("%s/%s: %s %s", c.Workflow, c.Name, c.Status, c.Message)
+			}
+		}
+		t.Fatalf("Expected all checks to pass")
+	}
+	if passed != len(report.Checks) || passed < 20 {
+		t.Fatalf("Expected all checks to run but got %d", passed)
+	}
+
+	// transcripts include auth, with credentials redacted
+	transcript := report.Checks[0].Transcript
+	if len(transcript) == 0 || transcript[0].StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected transcript to start with a 401 but got %+v", transcript)
+	}
+	for _, e := range transcript {
+		if auth := e.RequestHeader.Get("Authorization"); auth != "" && auth != "REDACTED" {
+			t.Fatalf("Expected Authorization header to be redacted but got %q", auth)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatalf("Errors writing JSON report: %s", err)
+	}
+	var decoded reggieconformance.Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded.Checks) != len(report.Checks) {
+		t.Fatalf("Expected JSON report to round-trip: %v", err)
+	}
+
+	// tokens issued by the token server never reach the reports
+	if err := report.WriteJUnit(&buf); err != nil {
+		t.Fatalf("Errors writing JUnit report: %s", err)
+	}
+	if len(tokens) == 0 {
+		t.Fatalf("Expected the client to be issued tokens")
+	}
+	for token := range tokens {
+		if strings.Contains(buf.String(), token) {
+			t.Fatalf("Expected token %s to be redacted from the reports", token)
+		}
+	}
+}
+
+func TestConformanceSkipsAndFailures(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithDeletesDisabled(), reggietest.WithoutReferrersAPI())
+	defer registry.Close()
+	registry.InjectFault(reggietest.Fault{Path: "/tags/list", Status: http.StatusInternalServerError})
+
+	report := runConformance(t, registry,
+		reggieconformance.WithWorkflows(reggieconformance.ContentDiscovery, reggieconformance.ContentManagement))
+	statuses := checkStatuses(report)
+	for name, expected := range map[string]reggieconformance.Status{
+		"push test content":         reggieconformance.Passed,
+		"list tags":                 reggieconformance.Failed,
+		"list referrers":            reggieconformance.Skipped,
+		"delete manifest by digest": reggieconformance.Skipped,
+		"delete blob":               reggieconformance.Skipped,
+	} {
+		if statuses[name] != expected {
+			t.Fatalf("Expected %q to be %s but got %s", name, expected, statuses[name])
+		}
+	}
+	if _, ok := statuses["GET blob"]; ok {
+		t.Fatalf("Expected only the selected workflows to run")
+	}
+	if report.Passed() {
+		t.Fatalf("Expected report to fail")
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteJUnit(&buf); err != nil {
+		t.Fatalf("Errors writing JUnit report: %s", err)
+	}
+	var suites struct {
+		Failures int `xml:"failures,attr"`
+		Suites   []struct {
+			Name  string `xml:"name,attr"`
+			Cases []struct {
+				Name      string    `xml:"name,attr"`
+				Failure   *struct{} `xml:"failure"`
+				SystemOut string    `xml:"system-out"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("Errors parsing JUnit report: %s", err)
+	}
+	if len(suites.Suites) != 3 || suites.Suites[1].Name != "content-discovery" || suites.Failures != 3 {
+		t.Fatalf("Unexpected JUnit report %s", buf.Bytes())
+	}
+	listTags := suites.Suites[1].Cases[0]
+	if listTags.Failure == nil || !strings.Contains(listTags.SystemOut, "< 500") {
+		t.Fatalf("Expected failing check with transcript but got %+v", listTags)
+	}
+}
+
+func TestConformanceSetupFailure(t *testing.T) {
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	registry.InjectFault(reggietest.Fault{Method: reggie.PUT, Path: "/manifests/", Status: http.StatusForbidden, Code: "DENIED"})
+
+	report := runConformance(t, registry, reggieconformance.WithWorkflows(reggieconformance.Pull))
+	statuses := checkStatuses(report)
+	if statuses["push test content"] != reggieconformance.Failed || statuses["GET manifest by tag"] != reggieconformance.Failed ||
+		statuses["GET /v2/ succeeds"] != reggieconformance.Passed {
+		t.Fatalf("Expected checks needing content to fail after setup failed but got %v", statuses)
+	}
+}
+
+func TestConformanceRecordsOnlyWhileRunning(t *testing.T) {
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	client, err := reggie.NewClient(registry.URL)
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	opts := []reggieconformance.Option{reggieconformance.WithWorkflows(reggieconformance.Pull),
+		reggieconformance.WithChecks("GET /v2/ succeeds")}
+	transport := client.GetClient().Transport
+	reggieconformance.NewRunner(client, opts...)
+	report := reggieconformance.NewRunner(client, opts...).Run(context.Background())
+	base := report.Checks[1]
+	if base.Name != "GET /v2/ succeeds" || len(base.Transcript) != 1 {
+		t.Fatalf("Expected a single exchange with two runners on the client but got %+v", base.Transcript)
+	}
+
+	if client.GetClient().Transport != transport {
+		t.Fatalf("Expected the client's transport to be restored once Run returns")
+	}
+
+	// requests failing without a response are recorded
+	registry.Close()
+	report = reggieconformance.NewRunner(client, opts...).Run(context.Background())
+	base = report.Checks[1]
+	if base.Status != reggieconformance.Failed || len(base.Transcript) != 1 || base.Transcript[0].Error == "" ||
+		!strings.Contains(base.TranscriptText(), "< error: ") {
+		t.Fatalf("Expected failed exchange to be recorded but got %+v", base.Transcript)
+	}
+}
+
+func TestJUnitGroupsWorkflows(t *testing.T) {
+	report := &reggieconformance.Report{Checks: []reggieconformance.Check{
+		{Workflow: reggieconformance.Pull, Name: "a", Status: reggieconformance.Passed, Duration: time.Second},
+		{Workflow: reggieconformance.Push, Name: "b", Status: reggieconformance.Passed, Duration: time.Second},
+		{Workflow: reggieconformance.Pull, Name: "c", Status: reggieconformance.Failed, Duration: 2 * time.Second},
+	}}
+	var buf bytes.Buffer
+	if err := report.WriteJUnit(&buf); err != nil {
+		t.Fatalf("Errors writing JUnit report: %s", err)
+	}
+	var suites struct {
+		Suites []struct {
+			Name     string `xml:"name,attr"`
+			Tests    int    `xml:"tests,attr"`
+			Failures int    `xml:"failures,attr"`
+			Time     string `xml:"time,attr"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("Errors parsing JUnit report: %s", err)
+	}
+	if len(suites.Suites) != 2 || suites.Suites[0].Name != "pull" || suites.Suites[0].Tests != 2 ||
+		suites.Suites[0].Failures != 1 || suites.Suites[0].Time != "3.000" || suites.Suites[1].Time != "1.000" {
+		t.Fatalf("Expected one suite per workflow but got %s", buf.Bytes())
+	}
+}
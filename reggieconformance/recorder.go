@@ -0,0 +1,120 @@
+package reggieconformance
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/bloodorangeio/reggie"
+)
+
+type (
+	// recorder is an http.RoundTripper adding each exchange made while a
+	// Runner runs to the transcript of the current check, including token
+	// requests and requests which failed without a response.
+	recorder struct {
+		next   http.RoundTripper
+		runner *Runner
+	}
+
+	// recordedBody records the start of a response body into an exchange
+	// as it is read.
+	recordedBody struct {
+		io.ReadCloser
+		runner   *Runner
+		exchange *Exchange
+		body     []byte
+		size     int
+		once     sync.Once
+	}
+)
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	e := &Exchange{
+		Method:        req.Method,
+		URL:           reggie.RedactURL(req.URL.String()),
+		RequestHeader: reggie.RedactHeaders(req.Header),
+	}
+	if err != nil {
+		e.Error = reggie.RedactError(err)
+		t.runner.add(e)
+		return resp, err
+	}
+	e.StatusCode = resp.StatusCode
+	e.ResponseHeader = reggie.RedactHeaders(resp.Header)
+	if loc := e.ResponseHeader.Get("Location"); loc != "" {
+		e.ResponseHeader.Set("Location", reggie.RedactURL(loc))
+	}
+	t.runner.add(e)
+	if resp.Body != nil {
+		resp.Body = &recordedBody{ReadCloser: resp.Body, runner: t.runner, exchange: e}
+	}
+	return resp, nil
+}
+
+// add adds an exchange to the transcript of the current check.
+func (r *Runner) add(e *Exchange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transcript = append(r.transcript, e)
+}
+
+func (b *recordedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if keep := maxRedactedBody - len(b.body); keep > 0 {
+		b.body = append(b.body, p[:min(n, keep)]...)
+	}
+	b.size += n
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordedBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+// finish records the body read into the exchange with its secret fields
+// redacted, truncated to maxTranscriptBody bytes, or only its size if it is
+// not text.
+func (b *recordedBody) finish() {
+	b.once.Do(func() {
+		body := b.body
+		truncated := b.size > len(body)
+		if sanitized, ok := reggie.RedactBody(body); ok && !truncated {
+			body = sanitized
+		}
+		if len(body) > maxTranscriptBody {
+			body, truncated = body[:maxTranscriptBody], true
+		}
+		if truncated {
+			body = trimPartialRune(body)
+		}
+		text := string(body)
+		switch {
+		case !utf8.Valid(body):
+			text = fmt.Sprintf("<%d bytes>", b.size)
+		case truncated:
+			text += "..."
+		}
+		b.runner.mu.Lock()
+		defer b.runner.mu.Unlock()
+		b.exchange.ResponseBody = text
+	})
+}
+
+// trimPartialRune removes a rune cut off at the end of a truncated body.
+func trimPartialRune(body []byte) []byte {
+	for i := 0; i < utf8.UTFMax && i < len(body); i++ {
+		if utf8.Valid(body[:len(body)-i]) {
+			return body[:len(body)-i]
+		}
+	}
+	return body
+}
@@ -0,0 +1,180 @@
+package reggieconformance
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// Report is the result of a conformance run.
+	Report struct {
+		Registry  string        `json:"registry"`
+		Namespace string        `json:"namespace"`
+		Started   time.Time     `json:"started"`
+		Duration  time.Duration `json:"duration"`
+		Checks    []Check       `json:"checks"`
+	}
+
+	junitTestSuites struct {
+		XMLName  xml.Name         `xml:"testsuites"`
+		Name     string           `xml:"name,attr"`
+		Tests    int              `xml:"tests,attr"`
+		Failures int              `xml:"failures,attr"`
+		Skipped  int              `xml:"skipped,attr"`
+		Time     string           `xml:"time,attr"`
+		Suites   []junitTestSuite `xml:"testsuite"`
+	}
+
+	junitTestSuite struct {
+		Name      string          `xml:"name,attr"`
+		Tests     int             `xml:"tests,attr"`
+		Failures  int             `xml:"failures,attr"`
+		Skipped   int             `xml:"skipped,attr"`
+		Time      string          `xml:"time,attr"`
+		Timestamp string          `xml:"timestamp,attr"`
+		Cases     []junitTestCase `xml:"testcase"`
+	}
+
+	junitTestCase struct {
+		Name      string        `xml:"name,attr"`
+		ClassName string        `xml:"classname,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitMessage `xml:"failure,omitempty"`
+		Skipped   *junitMessage `xml:"skipped,omitempty"`
+		SystemOut string        `xml:"system-out,omitempty"`
+	}
+
+	junitMessage struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// Counts returns the number of checks passed, failed and skipped.
+func (r *Report) Counts() (passed int, failed int, skipped int) {
+	for _, c := range r.Checks {
+		switch c.Status {
+		case Passed:
+			passed++
+		case Failed:
+			failed++
+		case Skipped:
+			skipped++
+		}
+	}
+	return passed, failed, skipped
+}
+
+// Passed returns whether no check failed.
+func (r *Report) Passed() bool {
+	_, failed, _ := r.Counts()
+	return failed == 0
+}
+
+// WriteJSON writes the report as JSON, with durations in nanoseconds.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteJUnit writes the report as JUnit XML, with a test suite per workflow
+// and the transcript of each check as its output.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	passed, failed, skipped := r.Counts()
+	suites := junitTestSuites{
+		Name:     "reggie conformance " + r.Registry,
+		Tests:    passed + failed + skipped,
+		Failures: failed,
+		Skipped:  skipped,
+		Time:     seconds(r.Duration),
+	}
+	// checks are grouped by workflow, in the order workflows first appear
+	index := map[Workflow]int{}
+	durations := map[Workflow]time.Duration{}
+	for _, c := range r.Checks {
+		i, ok := index[c.Workflow]
+		if !ok {
+			i = len(suites.Suites)
+			index[c.Workflow] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{
+				Name:      string(c.Workflow),
+				Timestamp: r.Started.UTC().Format("2006-01-02T15:04:05"),
+			})
+		}
+		suite := &suites.Suites[i]
+		durations[c.Workflow] += c.Duration
+		tc := junitTestCase{
+			Name:      c.Name,
+			ClassName: "conformance." + string(c.Workflow),
+			Time:      seconds(c.Duration),
+			SystemOut: c.TranscriptText(),
+		}
+		switch c.Status {
+		case Failed:
+			tc.Failure = &junitMessage{Message: c.Message, Text: c.Message}
+			suite.Failures++
+		case Skipped:
+			tc.Skipped = &junitMessage{Message: c.Message}
+			suite.Skipped++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+	}
+	for i := range suites.Suites {
+		suites.Suites[i].Time = seconds(durations[Workflow(suites.Suites[i].Name)])
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// TranscriptText formats the transcript of a check for humans.
+func (c *Check) TranscriptText() string {
+	var b strings.Builder
+	for _, e := range c.Transcript {
+		fmt.Fprintf(&b, "> %s %s\n", e.Method, e.URL)
+		writeHeaders(&b, "> ", e.RequestHeader)
+		if e.Error != "" {
+			fmt.Fprintf(&b, "< error: %s\n\n", e.Error)
+			continue
+		}
+		fmt.Fprintf(&b, "< %d\n", e.StatusCode)
+		writeHeaders(&b, "< ", e.ResponseHeader)
+		if e.ResponseBody != "" {
+			fmt.Fprintf(&b, "%s\n", e.ResponseBody)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func writeHeaders(b *strings.Builder, prefix string, header map[string][]string) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range header[name] {
+			fmt.Fprintf(b, "%s%s: %s\n", prefix, name, v)
+		}
+	}
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,298 @@
+// Package reggiehelm stores Helm charts in OCI registries, in the layout
+// helm push and helm pull use, on top of the client's blob and manifest
+// operations.
+package reggiehelm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bloodorangeio/reggie"
+	"github.com/bloodorangeio/reggie/internal/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// Media types of charts.
+const (
+	MediaTypeConfig     = "application/vnd.cncf.helm.config.v1+json"
+	MediaTypeChart      = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	MediaTypeProvenance = "application/vnd.cncf.helm.chart.provenance.v1.prov"
+)
+
+const (
+	// maxChartFileSize limits the size of the Chart.yaml and config read
+	// from a chart.
+	maxChartFileSize = 1 << 20
+)
+
+var (
+	// ErrNotChart is returned when pulling a manifest which is not a chart.
+	ErrNotChart = errors.New("not a Helm chart")
+
+	// chartName matches the names of charts, which name a single component
+	// of a repository name.
+	chartName = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+)
+
+type (
+	// Metadata holds the fields of a chart's Chart.yaml most often needed.
+	// The config pushed with a chart holds all of them.
+	Metadata struct {
+		APIVersion  string            `json:"apiVersion,omitempty" yaml:"apiVersion"`
+		Name        string            `json:"name,omitempty" yaml:"name"`
+		Version     string            `json:"version,omitempty" yaml:"version"`
+		AppVersion  string            `json:"appVersion,omitempty" yaml:"appVersion"`
+		Description string            `json:"description,omitempty" yaml:"description"`
+		Type        string            `json:"type,omitempty" yaml:"type"`
+		Home        string            `json:"home,omitempty" yaml:"home"`
+		Deprecated  bool              `json:"deprecated,omitempty" yaml:"deprecated"`
+		Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations"`
+	}
+
+	// Chart is a chart stored in a repository.
+	Chart struct {
+		Metadata   Metadata
+		Repository string
+		Tag        string
+
+		// Descriptor describes the chart's manifest.
+		Descriptor reggie.Descriptor
+
+		// Path is the packaged chart pushed or pulled, and ProvenancePath
+		// its provenance file, if any.
+		Path           string
+		ProvenancePath string
+	}
+
+	pushConfig struct {
+		ProvenancePath string
+	}
+
+	pushOption func(c *pushConfig)
+)
+
+// WithProvenance pushes the provenance file at path with a chart, as
+// helm package --sign creates it.
+func WithProvenance(path string) pushOption {
+	return func(c *pushConfig) {
+		c.ProvenancePath = path
+	}
+}
+
+// Push pushes a packaged chart to the repository named after the chart
+// within namespace, tagged with its version, as helm push does. The name and
+// version are read from the chart's Chart.yaml, and must be a lowercase
+// repository name component and a semantic version.
+func Push(ctx context.Context, client *reggie.Client, namespace string, chartPath string, opts ...pushOption) (*Chart, error) {
+	conf := &pushConfig{}
+	for _, o := range opts {
+		o(conf)
+	}
+	raw, err := readChartYAML(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	var metadata Metadata
+	if err := yaml.Unmarshal(raw, &metadata); err != nil {
+		return nil, fmt.Errorf("parsing Chart.yaml of %s: %w", chartPath, err)
+	}
+	if metadata.Name == "" || metadata.Version == "" {
+		return nil, fmt.Errorf("Chart.yaml of %s has no name or version", chartPath)
+	}
+	if !chartName.MatchString(metadata.Name) {
+		return nil, fmt.Errorf("chart name %q of %s must be lowercase and contain no slashes", metadata.Name, chartPath)
+	}
+	if _, ok := semver.Parse(metadata.Version); !ok {
+		return nil, fmt.Errorf("chart version %q of %s is not a semantic version", metadata.Version, chartPath)
+	}
+	config, err := configJSON(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing Chart.yaml of %s: %w", chartPath, err)
+	}
+
+	chart := &Chart{
+		Metadata:       metadata,
+		Repository:     path.Join(namespace, metadata.Name),
+		Tag:            Tag(metadata.Version),
+		Path:           chartPath,
+		ProvenancePath: conf.ProvenancePath,
+	}
+	filename := metadata.Name + "-" + metadata.Version + ".tgz"
+	files := []reggie.ArtifactFile{{Path: chartPath, MediaType: MediaTypeChart, Title: filename}}
+	if conf.ProvenancePath != "" {
+		files = append(files, reggie.ArtifactFile{Path: conf.ProvenancePath, MediaType: MediaTypeProvenance, Title: filename + ".prov"})
+	}
+	annotations := map[string]string{
+		"org.opencontainers.image.title":   metadata.Name,
+		"org.opencontainers.image.version": metadata.Version,
+	}
+	if metadata.Description != "" {
+		annotations["org.opencontainers.image.description"] = metadata.Description
+	}
+	if metadata.Home != "" {
+		annotations["org.opencontainers.image.url"] = metadata.Home
+	}
+	artifact, err := client.PushArtifact(ctx, chart.Repository, chart.Tag, "", files,
+		reggie.WithArtifactConfig(MediaTypeConfig, config),
+		reggie.WithArtifactAnnotations(annotations))
+	if err != nil {
+		return nil, err
+	}
+	chart.Descriptor = artifact.Descriptor
+	return chart, nil
+}
+
+// Pull pulls a chart by version into dir, naming it <name>-<version>.tgz as
+// helm pull does, along with its provenance file if it has one. An empty
+// version pulls the highest version which is not a pre-release, as helm pull
+// does without --devel.
+func Pull(ctx context.Context, client *reggie.Client, repository string, version string, dir string) (*Chart, error) {
+	if version == "" {
+		versions, err := Versions(ctx, client, repository)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range versions {
+			if p, _ := semver.Parse(v); !p.PreRelease() {
+				version = v
+				break
+			}
+		}
+		if version == "" {
+			return nil, fmt.Errorf("%s has no released chart versions", repository)
+		}
+	}
+	chart := &Chart{Repository: repository, Tag: Tag(version)}
+	artifact, err := client.FetchArtifact(ctx, repository, chart.Tag)
+	if err != nil {
+		return nil, err
+	}
+	if artifact.Config.MediaType != MediaTypeConfig {
+		return nil, fmt.Errorf("%w: %s:%s has config of type %s", ErrNotChart, repository, chart.Tag, artifact.Config.MediaType)
+	}
+	chart.Descriptor = artifact.Descriptor
+
+	var config bytes.Buffer
+	if artifact.Config.Size > maxChartFileSize {
+		return nil, fmt.Errorf("config of %s:%s is larger than %d bytes", repository, chart.Tag, maxChartFileSize)
+	}
+	if err := client.PullBlob(ctx, repository, artifact.Config, &config); err != nil {
+		return nil, fmt.Errorf("pulling config: %w", err)
+	}
+	if err := json.Unmarshal(config.Bytes(), &chart.Metadata); err != nil {
+		return nil, fmt.Errorf("parsing config of %s:%s: %w", repository, chart.Tag, err)
+	}
+	filename := chart.Metadata.Name + "-" + chart.Metadata.Version + ".tgz"
+	if chart.Metadata.Name == "" || filepath.Base(filename) != filename || !filepath.IsLocal(filename) {
+		return nil, fmt.Errorf("chart name %q is not a valid filename", chart.Metadata.Name)
+	}
+
+	var content, provenance *reggie.Descriptor
+	for i, layer := range artifact.Layers {
+		switch layer.MediaType {
+		case MediaTypeChart:
+			if content != nil {
+				return nil, fmt.Errorf("%s:%s has more than one chart layer", repository, chart.Tag)
+			}
+			content = &artifact.Layers[i]
+		case MediaTypeProvenance:
+			provenance = &artifact.Layers[i]
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("%w: %s:%s has no chart layer", ErrNotChart, repository, chart.Tag)
+	}
+	chart.Path = filepath.Join(dir, filename)
+	if err := client.PullBlobToFile(ctx, repository, *content, chart.Path); err != nil {
+		return nil, fmt.Errorf("pulling chart: %w", err)
+	}
+	if provenance != nil {
+		chart.ProvenancePath = chart.Path + ".prov"
+		if err := client.PullBlobToFile(ctx, repository, *provenance, chart.ProvenancePath); err != nil {
+			return nil, fmt.Errorf("pulling provenance: %w", err)
+		}
+	}
+	return chart, nil
+}
+
+// Versions lists the versions of the chart in a repository, highest first.
+// Tags which are not semantic versions are skipped.
+func Versions(ctx context.Context, client *reggie.Client, repository string) ([]string, error) {
+	tags, err := client.ListTags(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	parsed := map[string]semver.Version{}
+	for _, tag := range tags {
+		v := strings.ReplaceAll(tag, "_", "+")
+		if p, ok := semver.Parse(v); ok {
+			versions = append(versions, v)
+			parsed[v] = p
+		}
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return parsed[versions[i]].Compare(parsed[versions[j]]) > 0
+	})
+	return versions, nil
+}
+
+// Tag returns the tag of a chart version. Tags cannot contain +, so build
+// metadata is separated by _ instead, as Helm does.
+func Tag(version string) string {
+	return strings.ReplaceAll(version, "+", "_")
+}
+
+// readChartYAML returns the content of the Chart.yaml at the top of a
+// packaged chart.
+func readChartYAML(chartPath string) ([]byte, error) {
+	f, err := os.Open(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", chartPath, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s has no Chart.yaml", chartPath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", chartPath, err)
+		}
+		dir, file := path.Split(path.Clean(hdr.Name))
+		if file != "Chart.yaml" || dir == "" || strings.Count(dir, "/") != 1 {
+			continue
+		}
+		if hdr.Size > maxChartFileSize {
+			return nil, fmt.Errorf("Chart.yaml of %s is larger than %d bytes", chartPath, maxChartFileSize)
+		}
+		return io.ReadAll(tr)
+	}
+}
+
+// configJSON converts the content of a Chart.yaml to the JSON of a chart's
+// config, keeping all its fields.
+func configJSON(raw []byte) ([]byte, error) {
+	var fields map[string]interface{}
+	if err := yaml.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
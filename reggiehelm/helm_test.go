@@ -0,0 +1,157 @@
+package reggiehelm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bloodorangeio/reggie"
+	"github.com/bloodorangeio/reggie/reggietest"
+)
+
+// packageChart writes a packaged chart with the given Chart.yaml to dir,
+// returning its path.
+func packageChart(t *testing.T, dir string, name string, chartYAML string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for file, content := range map[string]string{
+		name + "/Chart.yaml":                chartYAML,
+		name + "/values.yaml":               "replicas: 1\n",
+		name + "/charts/dep/Chart.yaml":     "name: dep\nversion: 9.9.9\n",
+		name + "/templates/deployment.yaml": "kind: Deployment\n",
+	} {
+		tw.WriteHeader(&tar.Header{Name: file, Mode: 0o644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	path := filepath.Join(dir, name+".tgz")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Errors writing chart: %s", err)
+	}
+	return path
+}
+
+func TestPushAndPull(t *testing.T) {
+	ctx := context.Background()
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	client, _ := reggie.NewClient(registry.URL)
+	src := t.TempDir()
+
+	path := packageChart(t, src, "app", "apiVersion: v2\nname: app\nversion: 1.2.0+build.3\nappVersion: \"2.0\"\n"+
+		"description: An app\nkeywords: [web]\nmaintainers:\n  - name: ops\n")
+	prov := filepath.Join(src, "app.tgz.prov")
+	os.WriteFile(prov, []byte("-----BEGIN PGP SIGNED MESSAGE-----\n"), 0o644)
+	chart, err := Push(ctx, client, "charts", path, WithProvenance(prov))
+	if err != nil {
+		t.Fatalf("Errors pushing chart: %s", err)
+	}
+	if chart.Repository != "charts/app" || chart.Tag != "1.2.0_build.3" || chart.Metadata.AppVersion != "2.0" {
+		t.Fatalf("Unexpected chart pushed: %+v", chart)
+	}
+
+	m, ok := registry.Manifest("charts/app", "1.2.0_build.3")
+	if !ok {
+		t.Fatalf("Expected chart to be tagged with its version")
+	}
+	var manifest reggie.Artifact
+	json.Unmarshal(m.Content, &manifest)
+	if manifest.ArtifactType != "" || manifest.Config.MediaType != MediaTypeConfig || len(manifest.Layers) != 2 ||
+		manifest.Layers[0].MediaType != MediaTypeChart || manifest.Layers[1].MediaType != MediaTypeProvenance ||
+		manifest.Annotations["org.opencontainers.image.version"] != "1.2.0+build.3" {
+		t.Fatalf("Unexpected manifest: %s", m.Content)
+	}
+	config, _ := registry.Blob("charts/app", manifest.Config.Digest)
+	var fields map[string]interface{}
+	if err := json.Unmarshal(config, &fields); err != nil || fields["name"] != "app" || fields["keywords"] == nil || fields["maintainers"] == nil {
+		t.Fatalf("Expected config to hold all fields of Chart.yaml but got %s: %v", config, err)
+	}
+
+	path = packageChart(t, src, "app", "apiVersion: v2\nname: app\nversion: 1.10.0\n")
+	if _, err := Push(ctx, client, "charts", path); err != nil {
+		t.Fatalf("Errors pushing chart: %s", err)
+	}
+	for _, version := range []string{"1.10.0-rc.1", "1.11.0-rc.1"} {
+		path = packageChart(t, src, "app", "apiVersion: v2\nname: app\nversion: "+version+"\n")
+		if _, err := Push(ctx, client, "charts", path); err != nil {
+			t.Fatalf("Errors pushing chart: %s", err)
+		}
+	}
+	registry.PutManifest("charts/app", "latest", reggie.MediaTypeImageManifest, m.Content)
+
+	versions, err := Versions(ctx, client, "charts/app")
+	if err != nil {
+		t.Fatalf("Errors listing versions: %s", err)
+	}
+	if strings.Join(versions, ",") != "1.11.0-rc.1,1.10.0,1.10.0-rc.1,1.2.0+build.3" {
+		t.Fatalf("Unexpected versions: %v", versions)
+	}
+
+	dst := t.TempDir()
+	pulled, err := Pull(ctx, client, "charts/app", "1.2.0+build.3", dst)
+	if err != nil {
+		t.Fatalf("Errors pulling chart: %s", err)
+	}
+	if pulled.Path != filepath.Join(dst, "app-1.2.0+build.3.tgz") || pulled.ProvenancePath != pulled.Path+".prov" ||
+		pulled.Metadata.Description != "An app" || pulled.Descriptor.Digest != chart.Descriptor.Digest {
+		t.Fatalf("Unexpected chart pulled: %+v", pulled)
+	}
+	want, _ := os.ReadFile(filepath.Join(src, "app.tgz.prov"))
+	if got, _ := os.ReadFile(pulled.ProvenancePath); !bytes.Equal(got, want) {
+		t.Fatalf("Expected provenance to be pulled")
+	}
+
+	latest, err := Pull(ctx, client, "charts/app", "", dst)
+	if err != nil {
+		t.Fatalf("Errors pulling latest chart: %s", err)
+	}
+	if latest.Metadata.Version != "1.10.0" || latest.ProvenancePath != "" {
+		t.Fatalf("Expected highest release to be pulled but got %+v", latest)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "app-1.10.0.tgz")); err != nil {
+		t.Fatalf("Expected chart to be written: %s", err)
+	}
+}
+
+func TestPushAndPullErrors(t *testing.T) {
+	ctx := context.Background()
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	client, _ := reggie.NewClient(registry.URL)
+	src := t.TempDir()
+
+	if _, err := Push(ctx, client, "charts", packageChart(t, src, "app", "name: app\n")); err == nil {
+		t.Fatalf("Expected chart without a version to be rejected")
+	}
+	for _, chartYAML := range []string{"name: a/b\nversion: 1.0.0\n", "name: App\nversion: 1.0.0\n", "name: app\nversion: latest\n"} {
+		if _, err := Push(ctx, client, "charts", packageChart(t, src, "app", chartYAML)); err == nil {
+			t.Fatalf("Expected chart with %q to be rejected", chartYAML)
+		}
+	}
+	if tags := registry.Tags("charts/a/b"); len(tags) != 0 {
+		t.Fatalf("Expected nothing to be pushed to a nested repository")
+	}
+	notChart := filepath.Join(src, "notes.txt")
+	os.WriteFile(notChart, []byte("not a chart"), 0o644)
+	if _, err := Push(ctx, client, "charts", notChart); err == nil {
+		t.Fatalf("Expected file which is not a packaged chart to be rejected")
+	}
+
+	if _, err := client.PushArtifact(ctx, "charts/app", "1.0.0", "application/vnd.example",
+		[]reggie.ArtifactFile{{Path: notChart}}); err != nil {
+		t.Fatalf("Errors pushing artifact: %s", err)
+	}
+	if _, err := Pull(ctx, client, "charts/app", "1.0.0", t.TempDir()); !errors.Is(err, ErrNotChart) {
+		t.Fatalf("Expected ErrNotChart pulling an artifact which is not a chart but got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+// Package reggieprom reports the metrics of reggie clients to Prometheus.
+package reggieprom
+
+import (
+	"time"
+
+	"github.com/bloodorangeio/reggie"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics implements reggie.Metrics using Prometheus collectors. The token
+// cache hit ratio is
+//
+//	reggie_token_cache_lookups_total{result="hit"} / ignoring(result) sum(reggie_token_cache_lookups_total)
+type Metrics struct {
+	requests    *prometheus.CounterVec
+	latency     *prometheus.HistogramVec
+	authRetries *prometheus.CounterVec
+	tokenCache  *prometheus.CounterVec
+	bytes       *prometheus.CounterVec
+}
+
+var _ reggie.Metrics = (*Metrics)(nil)
+
+// NewMetrics creates the collectors for reggie clients and registers them
+// with reg. Use the same Metrics for every client.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "reggie_requests_total",
+			Help: "Requests made to registries and authorization services.",
+		}, []string{"method", "endpoint", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "reggie_request_duration_seconds",
+			Help:    "Duration of requests, including auth retries and mirror fallbacks.",
+			Buckets: prometheus.ExponentialBuckets(0.005, 4, 8),
+		}, []string{"method", "endpoint"}),
+		authRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "reggie_auth_retries_total",
+			Help: "Requests retried with auth after a 401 response.",
+		}, []string{"scheme"}),
+		tokenCache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "reggie_token_cache_lookups_total",
+			Help: "Lookups of bearer tokens in the token cache.",
+		}, []string{"result"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "reggie_transferred_bytes_total",
+			Help: "Bytes of request and response bodies.",
+		}, []string{"direction"}),
+	}
+	for _, c := range []prometheus.Collector{m.requests, m.latency, m.authRetries, m.tokenCache, m.bytes} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// RequestCompleted satisfies the reggie.Metrics interface.
+func (m *Metrics) RequestCompleted(method string, endpoint string, status string, duration time.Duration) {
+	m.requests.WithLabelValues(method, endpoint, status).Inc()
+	m.latency.WithLabelValues(method, endpoint).Observe(duration.Seconds())
+}
+
+// AuthRetried satisfies the reggie.Metrics interface.
+func (m *Metrics) AuthRetried(scheme string) {
+	m.authRetries.WithLabelValues(scheme).Inc()
+}
+
+// TokenCacheLookup satisfies the reggie.Metrics interface.
+func (m *Metrics) TokenCacheLookup(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.tokenCache.WithLabelValues(result).Inc()
+}
+
+// BytesTransferred satisfies the reggie.Metrics interface.
+func (m *Metrics) BytesTransferred(direction string, n int64) {
+	m.bytes.WithLabelValues(direction).Add(float64(n))
+}
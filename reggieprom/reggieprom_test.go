@@ -0,0 +1,67 @@
+package reggieprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bloodorangeio/reggie"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.Header().Set("Www-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"name": "a", "tags": ["v1"]}`))
+	}))
+	defer ts.Close()
+
+	reg := prometheus.NewRegistry()
+	metrics, err := NewMetrics(reg)
+	if err != nil {
+		t.Fatalf("Errors creating metrics: %s", err)
+	}
+	client, err := reggie.NewClient(ts.URL,
+		reggie.WithUsernamePassword("user", "pass"),
+		reggie.WithMetrics(metrics))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	if _, err := client.Do(client.NewRequest(reggie.GET, "/v2/a/tags/list")); err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	metrics.TokenCacheLookup(true)
+
+	expected := `
+# HELP reggie_auth_retries_total Requests retried with auth after a 401 response.
+# TYPE reggie_auth_retries_total counter
+reggie_auth_retries_total{scheme="basic"} 1
+# HELP reggie_requests_total Requests made to registries and authorization services.
+# TYPE reggie_requests_total counter
+reggie_requests_total{endpoint="tags",method="GET",status="200"} 1
+# HELP reggie_token_cache_lookups_total Lookups of bearer tokens in the token cache.
+# TYPE reggie_token_cache_lookups_total counter
+reggie_token_cache_lookups_total{result="hit"} 1
+`
+	err = testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"reggie_auth_retries_total", "reggie_requests_total", "reggie_token_cache_lookups_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(metrics.latency); n != 1 {
+		t.Fatalf("Expected 1 latency histogram but got %d", n)
+	}
+	if b := testutil.ToFloat64(metrics.bytes.WithLabelValues(reggie.DirectionDownload)); b < 1 {
+		t.Fatalf("Expected downloaded bytes to be counted but got %v", b)
+	}
+
+	if _, err := NewMetrics(reg); err == nil {
+		t.Fatalf("Expected error registering metrics twice")
+	}
+}
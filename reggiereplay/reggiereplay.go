@@ -0,0 +1,272 @@
+// Package reggiereplay records the HTTP interactions of a reggie Client to
+// cassette files, and replays them without network access.
+//
+// Recorded interactions are sanitized: credentials and cookies are removed
+// from headers, tokens from token responses, and the values of query
+// parameters outside the distribution spec, such as the signatures of
+// pre-signed URLs, from URLs.
+package reggiereplay
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/bloodorangeio/reggie"
+)
+
+type (
+	// Cassette is a sequence of recorded interactions.
+	Cassette struct {
+		Interactions []Interaction `json:"interactions"`
+	}
+
+	// Interaction is a recorded request and its response.
+	Interaction struct {
+		Request  Request  `json:"request"`
+		Response Response `json:"response"`
+	}
+
+	// Request is a recorded request. Request bodies are not recorded.
+	Request struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header,omitempty"`
+	}
+
+	// Response is a recorded response. Bodies which are not valid UTF-8 are
+	// base64-encoded.
+	Response struct {
+		StatusCode   int         `json:"status_code"`
+		Header       http.Header `json:"header,omitempty"`
+		Body         string      `json:"body,omitempty"`
+		BodyEncoding string      `json:"body_encoding,omitempty"`
+	}
+
+	// Recorder is a transport wrapper which records interactions.
+	Recorder struct {
+		path string
+
+		mu       sync.Mutex
+		cassette Cassette
+	}
+
+	// Replayer is a transport which serves recorded interactions.
+	Replayer struct {
+		matchQuery bool
+		headers    []string
+
+		mu       sync.Mutex
+		cassette *Cassette
+		used     []bool
+	}
+
+	// ReplayOption configures how a Replayer matches requests.
+	ReplayOption func(r *Replayer)
+
+	recordingTransport struct {
+		recorder *Recorder
+		next     http.RoundTripper
+	}
+)
+
+// NewRecorder returns a Recorder which saves interactions to the cassette
+// file at path.
+func NewRecorder(path string) *Recorder {
+	return &Recorder{path: path}
+}
+
+// Wrap returns a transport recording the interactions of next. It may be
+// passed to reggie.WithTransportWrapper.
+func (r *Recorder) Wrap(next http.RoundTripper) http.RoundTripper {
+	return &recordingTransport{recorder: r, next: next}
+}
+
+// Cassette returns the interactions recorded so far.
+func (r *Recorder) Cassette() Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Cassette{Interactions: append([]Interaction{}, r.cassette.Interactions...)}
+}
+
+// Save writes the interactions recorded so far to the cassette file.
+func (r *Recorder) Save() error {
+	data, err := json.MarshalIndent(r.Cassette(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(data, '\n'), 0644)
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.recorder.mu.Lock()
+	defer t.recorder.mu.Unlock()
+	t.recorder.cassette.Interactions = append(t.recorder.cassette.Interactions, Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    reggie.RedactURL(req.URL.String()),
+			Header: reggie.RedactHeaders(req.Header),
+		},
+		Response: newResponse(resp, body),
+	})
+	return resp, nil
+}
+
+// newResponse sanitizes a response for recording.
+func newResponse(resp *http.Response, body []byte) Response {
+	header := reggie.RedactHeaders(resp.Header)
+	if loc := header.Get("Location"); loc != "" {
+		header.Set("Location", reggie.RedactURL(loc))
+	}
+	if sanitized, ok := reggie.RedactBody(body); ok {
+		body = sanitized
+		if header.Get("Content-Length") != "" {
+			header.Set("Content-Length", strconv.Itoa(len(body)))
+		}
+	}
+	r := Response{StatusCode: resp.StatusCode, Header: header}
+	if utf8.Valid(body) {
+		r.Body = string(body)
+	} else {
+		r.Body = base64.StdEncoding.EncodeToString(body)
+		r.BodyEncoding = "base64"
+	}
+	return r
+}
+
+// WithMatchQuery sets whether requests must match the query of a recorded
+// request, after redaction. Defaults to true.
+func WithMatchQuery(match bool) ReplayOption {
+	return func(r *Replayer) {
+		r.matchQuery = match
+	}
+}
+
+// WithMatchHeaders requires requests to match the given headers of a
+// recorded request, after redaction.
+func WithMatchHeaders(names ...string) ReplayOption {
+	return func(r *Replayer) {
+		r.headers = append(r.headers, names...)
+	}
+}
+
+// NewReplayer loads the cassette file at path for replay. Requests are
+// matched to recorded requests by method and path, and by default query.
+func NewReplayer(path string, opts ...ReplayOption) (*Replayer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing cassette %s: %w", path, err)
+	}
+	return NewCassetteReplayer(&c, opts...), nil
+}
+
+// NewCassetteReplayer returns a Replayer serving the interactions of c.
+func NewCassetteReplayer(c *Cassette, opts ...ReplayOption) *Replayer {
+	r := &Replayer{
+		matchQuery: true,
+		cassette:   c,
+		used:       make([]bool, len(c.Interactions)),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// Wrap returns the Replayer, ignoring next so that no request reaches the
+// network. It may be passed to reggie.WithTransportWrapper.
+func (r *Replayer) Wrap(next http.RoundTripper) http.RoundTripper {
+	return r
+}
+
+// RoundTrip satisfies the http.RoundTripper interface. Each recorded
+// interaction is served once, in the order recorded, so that repeated
+// requests receive successive responses.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+	u, err := url.Parse(reggie.RedactURL(req.URL.String()))
+	if err != nil {
+		return nil, err
+	}
+	header := reggie.RedactHeaders(req.Header)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || !r.matches(interaction.Request, req.Method, u, header) {
+			continue
+		}
+		r.used[i] = true
+		return interaction.Response.httpResponse(req)
+	}
+	return nil, fmt.Errorf("reggiereplay: no recorded interaction for %s %s", req.Method, u)
+}
+
+func (r *Replayer) matches(recorded Request, method string, u *url.URL, header http.Header) bool {
+	ru, err := url.Parse(recorded.URL)
+	if err != nil || recorded.Method != method || ru.Path != u.Path {
+		return false
+	}
+	if r.matchQuery && ru.Query().Encode() != u.Query().Encode() {
+		return false
+	}
+	for _, name := range r.headers {
+		if recorded.Header.Get(name) != header.Get(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// httpResponse builds a response to req from a recorded response.
+func (resp Response) httpResponse(req *http.Request) (*http.Response, error) {
+	body := []byte(resp.Body)
+	if resp.BodyEncoding == "base64" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(resp.Body); err != nil {
+			return nil, err
+		}
+	}
+	contentLength := int64(len(body))
+	if n, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		contentLength = n
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        resp.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: contentLength,
+		Request:       req,
+	}, nil
+}
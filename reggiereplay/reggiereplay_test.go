@@ -0,0 +1,154 @@
+package reggiereplay_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bloodorangeio/reggie"
+	"github.com/bloodorangeio/reggie/reggiereplay"
+	"github.com/bloodorangeio/reggie/reggietest"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	content := []byte("recorded blob")
+	desc := reggie.Descriptor{Digest: reggie.DigestFromBytes(content), Size: int64(len(content))}
+
+	// record against a registry with token auth and storage redirects
+	registry := reggietest.NewRegistry(reggietest.WithTokenAuth("user", "secret-password"), reggietest.WithStorageRedirects())
+	recorder := reggiereplay.NewRecorder(cassette)
+	client, err := reggie.NewClient(registry.URL,
+		reggie.WithUsernamePassword("user", "secret-password"),
+		reggie.WithTransportWrapper(recorder.Wrap))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	ctx := context.Background()
+	err = client.PushBlob(ctx, "a", desc, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	})
+	if err != nil {
+		t.Fatalf("Errors pushing blob: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := client.PullBlob(ctx, "a", desc, &buf); err != nil {
+		t.Fatalf("Errors pulling blob: %s", err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("Errors saving cassette: %s", err)
+	}
+	registryURL := registry.URL
+	registry.Close()
+
+	// secrets are not recorded
+	data, err := os.ReadFile(cassette)
+	if err != nil {
+		t.Fatalf("Errors reading cassette: %s", err)
+	}
+	if strings.Contains(string(data), "secret-password") {
+		t.Fatalf("Expected cassette not to contain password")
+	}
+	for _, interaction := range recorder.Cassette().Interactions {
+		if auth := interaction.Request.Header.Get("Authorization"); auth != "" && !strings.HasSuffix(auth, "REDACTED") {
+			t.Fatalf("Expected Authorization header to be redacted but got %q", auth)
+		}
+		if strings.Contains(interaction.Response.Body, `"token"`) && !strings.Contains(interaction.Response.Body, `"token":"REDACTED"`) {
+			t.Fatalf("Expected token to be redacted but got %s", interaction.Response.Body)
+		}
+		if loc := interaction.Response.Header.Get("Location"); strings.Contains(loc, "X-Signature=") && !strings.Contains(loc, "X-Signature=REDACTED") {
+			t.Fatalf("Expected signature to be redacted but got %s", loc)
+		}
+	}
+
+	// replay without the registry
+	replayer, err := reggiereplay.NewReplayer(cassette)
+	if err != nil {
+		t.Fatalf("Errors loading cassette: %s", err)
+	}
+	client, err = reggie.NewClient(registryURL,
+		reggie.WithUsernamePassword("user", "secret-password"),
+		reggie.WithTransportWrapper(replayer.Wrap))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	err = client.PushBlob(ctx, "a", desc, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	})
+	if err != nil {
+		t.Fatalf("Errors replaying blob push: %s", err)
+	}
+	buf.Reset()
+	if err := client.PullBlob(ctx, "a", desc, &buf); err != nil {
+		t.Fatalf("Errors replaying blob pull: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), content) {
+		t.Fatalf("Expected to replay %q but got %q", content, buf.Bytes())
+	}
+
+	// interactions are served once
+	if _, err := client.Do(client.NewRequest(reggie.GET, "/v2/")); err == nil {
+		t.Fatalf("Expected error once cassette is exhausted")
+	}
+}
+
+func TestReplayMatching(t *testing.T) {
+	cassette := &reggiereplay.Cassette{Interactions: []reggiereplay.Interaction{
+		{
+			Request:  reggiereplay.Request{Method: "GET", URL: "https://example.com/v2/a/tags/list?n=1"},
+			Response: reggiereplay.Response{StatusCode: 200, Body: `{"name":"a","tags":["v1"]}`},
+		},
+		{
+			Request: reggiereplay.Request{Method: "GET", URL: "https://example.com/v2/a/manifests/v1",
+				Header: map[string][]string{"Accept": {"application/vnd.oci.image.index.v1+json"}}},
+			Response: reggiereplay.Response{StatusCode: 200, Body: "index"},
+		},
+		{
+			Request: reggiereplay.Request{Method: "GET", URL: "https://example.com/v2/a/manifests/v1",
+				Header: map[string][]string{"Accept": {"application/vnd.oci.image.manifest.v1+json"}}},
+			Response: reggiereplay.Response{StatusCode: 200, Body: "bWFuaWZlc3Q=", BodyEncoding: "base64"},
+		},
+	}}
+
+	replayer := reggiereplay.NewCassetteReplayer(cassette, reggiereplay.WithMatchHeaders("Accept"))
+	client, err := reggie.NewClient("https://example.com",
+		reggie.WithDefaultName("a"),
+		reggie.WithTransportWrapper(replayer.Wrap))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	// the query must match by default
+	if _, err := client.Do(client.NewRequest(reggie.GET, "/v2/<name>/tags/list")); err == nil {
+		t.Fatalf("Expected request with different query not to match")
+	}
+	resp, err := client.Do(client.NewRequest(reggie.GET, "/v2/<name>/tags/list").SetQueryParam("n", "1"))
+	if err != nil || resp.StatusCode() != 200 {
+		t.Fatalf("Errors replaying tags: %v", err)
+	}
+
+	// selected headers must match
+	resp, err = client.Do(client.NewRequest(reggie.GET, "/v2/<name>/manifests/v1").
+		SetHeader("Accept", "application/vnd.oci.image.manifest.v1+json"))
+	if err != nil {
+		t.Fatalf("Errors replaying manifest: %s", err)
+	}
+	if string(resp.Body()) != "manifest" {
+		t.Fatalf("Expected manifest but got %q", resp.Body())
+	}
+
+	replayer = reggiereplay.NewCassetteReplayer(cassette, reggiereplay.WithMatchQuery(false))
+	client, err = reggie.NewClient("https://example.com",
+		reggie.WithDefaultName("a"),
+		reggie.WithTransportWrapper(replayer.Wrap))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	if _, err := client.Do(client.NewRequest(reggie.GET, "/v2/<name>/tags/list")); err != nil {
+		t.Fatalf("Expected query to be ignored: %s", err)
+	}
+}
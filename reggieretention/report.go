@@ -0,0 +1,189 @@
+package reggieretention
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bloodorangeio/reggie"
+)
+
+// Statuses of a deletion.
+const (
+	Deleted  Status = "deleted"
+	NotFound Status = "not-found"
+	Failed   Status = "failed"
+)
+
+type (
+	// Status is the result of a deletion.
+	Status string
+
+	// Result is the result of executing a deletion.
+	Result struct {
+		Deletion
+		Status Status `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}
+
+	// Report is the result of executing a plan.
+	Report struct {
+		Repository string        `json:"repository"`
+		Started    time.Time     `json:"started"`
+		Duration   time.Duration `json:"duration"`
+		Kept       int           `json:"kept"`
+		Results    []Result      `json:"results"`
+	}
+)
+
+// Execute makes the deletions of a plan, running up to the engine's
+// concurrency at once. Referrers are deleted before the manifests they
+// refer to. Deletions which fail do not stop the others.
+func (e *Engine) Execute(ctx context.Context, plan *Plan) *Report {
+	report := &Report{
+		Repository: plan.Repository,
+		Started:    e.now(),
+		Kept:       len(plan.Keep),
+		Results:    make([]Result, len(plan.Delete)),
+	}
+	start := time.Now()
+
+	// referrers and the manifests they refer to are deleted in separate
+	// phases, so subjects outlive their referrers
+	var referrers, others []int
+	for i, d := range plan.Delete {
+		if d.Action == DeleteReferrer {
+			referrers = append(referrers, i)
+		} else {
+			others = append(others, i)
+		}
+	}
+	for _, phase := range [][]int{referrers, others} {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, e.concurrency)
+		for _, i := range phase {
+			i := i
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				report.Results[i] = e.delete(ctx, plan.Repository, plan.Delete[i])
+			}()
+		}
+		wg.Wait()
+	}
+	report.Duration = time.Since(start)
+	return report
+}
+
+// delete makes a single deletion.
+func (e *Engine) delete(ctx context.Context, name string, d Deletion) Result {
+	var result *reggie.DeleteResult
+	var err error
+	if d.Action == Untag {
+		// DeleteTag never removes the manifest, which other tags refer to
+		result, err = e.client.DeleteTag(ctx, name, d.Tags[0])
+	} else {
+		result, err = e.client.DeleteManifest(ctx, name, d.Digest)
+	}
+	switch {
+	case err != nil:
+		return Result{Deletion: d, Status: Failed, Error: reggie.RedactError(err)}
+	case result.NotFound:
+		return Result{Deletion: d, Status: NotFound}
+	}
+	return Result{Deletion: d, Status: Deleted}
+}
+
+// Counts returns the number of deletions made, already gone and failed.
+func (r *Report) Counts() (deleted int, notFound int, failed int) {
+	for _, res := range r.Results {
+		switch res.Status {
+		case Deleted:
+			deleted++
+		case NotFound:
+			notFound++
+		case Failed:
+			failed++
+		}
+	}
+	return deleted, notFound, failed
+}
+
+// Passed returns whether no deletion failed.
+func (r *Report) Passed() bool {
+	_, _, failed := r.Counts()
+	return failed == 0
+}
+
+// WriteJSON writes the report as JSON, with the duration in nanoseconds.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes the result of each deletion and a summary for humans.
+func (r *Report) WriteText(w io.Writer) error {
+	for _, res := range r.Results {
+		line := fmt.Sprintf("%-9s  %s", res.Status, describe(res.Deletion))
+		if res.Error != "" {
+			line += ": " + res.Error
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	deleted, notFound, failed := r.Counts()
+	_, err := fmt.Fprintf(w, "\n%s: %d deleted, %d already gone, %d failed, %d tags kept in %s\n",
+		r.Repository, deleted, notFound, failed, r.Kept, r.Duration.Round(time.Millisecond))
+	return err
+}
+
+// WriteJSON writes the plan as JSON.
+func (p *Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// WriteText writes the tags kept and the deletions planned, with their
+// reasons, for humans.
+func (p *Plan) WriteText(w io.Writer) error {
+	for _, k := range p.Keep {
+		if _, err := fmt.Fprintf(w, "keep       %s (%s)\n", k.Tag, k.Reason); err != nil {
+			return err
+		}
+	}
+	for _, d := range p.Delete {
+		if _, err := fmt.Fprintf(w, "delete     %s (%s)\n", describe(d), d.Reason); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%s: %d tags kept, %d deletions planned\n", p.Repository, len(p.Keep), len(p.Delete))
+	return err
+}
+
+// describe formats what a deletion removes.
+func describe(d Deletion) string {
+	switch d.Action {
+	case Untag:
+		return "tag " + d.Tags[0]
+	case DeleteReferrer:
+		return "referrer " + d.Digest + " of " + d.Subject
+	}
+	s := "manifest " + d.Digest
+	for i, tag := range d.Tags {
+		if i == 0 {
+			s += " tagged "
+		} else {
+			s += ", "
+		}
+		s += tag
+	}
+	return s
+}
@@ -0,0 +1,458 @@
+// Package reggieretention prunes the tags of a repository according to
+// retention policies. An Engine first plans which tags and manifests to
+// delete, which may be reviewed as a dry run, then executes the plan.
+package reggieretention
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloodorangeio/reggie"
+	"github.com/bloodorangeio/reggie/internal/semver"
+)
+
+const (
+	// DefaultConcurrency is how many deletions run at once by default.
+	DefaultConcurrency = 4
+
+	// annotationCreated is the annotation holding the creation date of a
+	// manifest.
+	annotationCreated = "org.opencontainers.image.created"
+
+	// maxConfigSize limits the size of image configs read for their
+	// creation date.
+	maxConfigSize = 4 << 20
+)
+
+// Actions of a deletion.
+const (
+	// DeleteManifest deletes a manifest by digest, removing all its tags.
+	DeleteManifest Action = "delete-manifest"
+
+	// Untag deletes a tag whose manifest is also referred to by a tag
+	// which is kept.
+	Untag Action = "untag"
+
+	// DeleteReferrer deletes a manifest whose subject is deleted or gone.
+	DeleteReferrer Action = "delete-referrer"
+)
+
+var (
+	// referrersTagMatcher matches the tags of the referrers tag schema.
+	referrersTagMatcher = regexp.MustCompile(`^(sha256-[a-f0-9]{64}|sha512-[a-f0-9]{128})$`)
+)
+
+type (
+	// Policy decides which tags of a repository are kept. Tags matching
+	// KeepTags or KeepVersions, or among the KeepLast most recently
+	// created, are always kept. Other tags are deleted if they are older
+	// than MaxAge, when set, and KeepLast or MaxAge is set. A policy which
+	// sets neither deletes no tags.
+	Policy struct {
+		// KeepLast keeps the most recently created tags, by the creation
+		// date of their image.
+		KeepLast int
+
+		// KeepTags keeps tags matching any of the expressions.
+		KeepTags []*regexp.Regexp
+
+		// KeepVersions keeps tags which are semantic versions, optionally
+		// prefixed with v, within any of the ranges, such as ">=1.2.0
+		// <2.0.0", "^1.4", "~1.2.3" or "1.x". Pre-releases are lower than
+		// their release.
+		KeepVersions []string
+
+		// MaxAge deletes tags created longer ago. Tags whose creation date
+		// is unknown are kept.
+		MaxAge time.Duration
+
+		// DeleteOrphanedReferrers deletes the referrers of deleted
+		// manifests, and the referrers listed by referrers tag schema tags
+		// whose subject is gone.
+		DeleteOrphanedReferrers bool
+	}
+
+	// Action is what a deletion does.
+	Action string
+
+	// Decision records why a tag is kept.
+	Decision struct {
+		Tag     string     `json:"tag"`
+		Digest  string     `json:"digest"`
+		Created *time.Time `json:"created,omitempty"`
+		Reason  string     `json:"reason"`
+	}
+
+	// Deletion is a deletion planned by an Engine.
+	Deletion struct {
+		Action  Action     `json:"action"`
+		Digest  string     `json:"digest"`
+		Tags    []string   `json:"tags,omitempty"`
+		Subject string     `json:"subject,omitempty"`
+		Created *time.Time `json:"created,omitempty"`
+		Reason  string     `json:"reason"`
+	}
+
+	// Plan lists the tags an Engine keeps and the deletions it makes in a
+	// repository. Referrers are deleted before the manifests they refer
+	// to.
+	Plan struct {
+		Repository string     `json:"repository"`
+		Created    time.Time  `json:"created"`
+		Keep       []Decision `json:"keep"`
+		Delete     []Deletion `json:"delete"`
+	}
+
+	// Engine plans and executes deletions with a client. It is safe for
+	// concurrent use.
+	Engine struct {
+		client      *reggie.Client
+		policy      Policy
+		versions    []semver.Range
+		concurrency int
+		now         func() time.Time
+
+		// contentCache holds the manifests fetched by Plan by digest,
+		// which repositories may share.
+		mu           sync.Mutex
+		contentCache map[string]*content
+	}
+
+	// Option configures an Engine.
+	Option func(e *Engine)
+
+	// content is a manifest with the fields needed to date it.
+	content struct {
+		desc        reggie.Descriptor
+		Config      *reggie.Descriptor  `json:"config"`
+		Manifests   []reggie.Descriptor `json:"manifests"`
+		Annotations map[string]string   `json:"annotations"`
+	}
+
+	// tagInfo is a tag with the manifest it refers to.
+	tagInfo struct {
+		name    string
+		digest  string
+		created *time.Time
+	}
+)
+
+// WithConcurrency sets how many deletions run at once. Defaults to
+// DefaultConcurrency.
+func WithConcurrency(n int) Option {
+	return func(e *Engine) {
+		e.concurrency = n
+	}
+}
+
+// WithClock sets the function returning the current time, which ages are
+// measured against.
+func WithClock(now func() time.Time) Option {
+	return func(e *Engine) {
+		e.now = now
+	}
+}
+
+// NewEngine returns an Engine applying policy with client.
+func NewEngine(client *reggie.Client, policy Policy, opts ...Option) (*Engine, error) {
+	e := &Engine{
+		client:       client,
+		policy:       policy,
+		concurrency:  DefaultConcurrency,
+		now:          time.Now,
+		contentCache: map[string]*content{},
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	if policy.KeepLast < 0 || policy.MaxAge < 0 {
+		return nil, fmt.Errorf("KeepLast and MaxAge must not be negative")
+	}
+	if e.concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1")
+	}
+	for _, s := range policy.KeepVersions {
+		r, err := semver.ParseRange(s)
+		if err != nil {
+			return nil, err
+		}
+		e.versions = append(e.versions, r)
+	}
+	return e, nil
+}
+
+// Plan decides which tags of a repository to keep and what to delete,
+// without deleting anything.
+func (e *Engine) Plan(ctx context.Context, name string) (*Plan, error) {
+	plan := &Plan{Repository: name, Created: e.now()}
+	tags, err := e.client.ListTags(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos, referrersTags []*tagInfo
+	for _, tag := range tags {
+		c, err := e.fetch(ctx, name, tag)
+		if err != nil {
+			return nil, err
+		}
+		info := &tagInfo{name: tag, digest: c.desc.Digest}
+		if referrersTagMatcher.MatchString(tag) {
+			referrersTags = append(referrersTags, info)
+			continue
+		}
+		if info.created, err = e.created(ctx, name, c); err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	// newest first, with unknown creation dates last
+	sort.SliceStable(infos, func(i, j int) bool {
+		a, b := infos[i].created, infos[j].created
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return a.After(*b)
+	})
+	kept := map[string]bool{}
+	deleted := map[string][]*tagInfo{}
+	var digests []string
+	for i, info := range infos {
+		reason, keep := e.keep(info, i)
+		if keep {
+			plan.Keep = append(plan.Keep, Decision{Tag: info.name, Digest: info.digest, Created: info.created, Reason: reason})
+			e.markKept(info.digest, kept)
+			continue
+		}
+		if deleted[info.digest] == nil {
+			digests = append(digests, info.digest)
+		}
+		deleted[info.digest] = append(deleted[info.digest], info)
+	}
+
+	var manifests, untags []Deletion
+	gone := map[string]bool{}
+	for _, digest := range digests {
+		for _, info := range deleted[digest] {
+			reason, _ := e.keep(info, -1)
+			if kept[digest] {
+				untags = append(untags, Deletion{Action: Untag, Digest: digest, Tags: []string{info.name}, Created: info.created, Reason: reason})
+			} else if len(manifests) == 0 || manifests[len(manifests)-1].Digest != digest {
+				manifests = append(manifests, Deletion{Action: DeleteManifest, Digest: digest, Tags: []string{info.name}, Created: info.created, Reason: reason})
+			} else {
+				manifests[len(manifests)-1].Tags = append(manifests[len(manifests)-1].Tags, info.name)
+			}
+		}
+		if !kept[digest] {
+			gone[digest] = true
+		}
+	}
+
+	if e.policy.DeleteOrphanedReferrers {
+		referrers, err := e.orphanedReferrers(ctx, name, manifests, referrersTags, gone, kept)
+		if err != nil {
+			return nil, err
+		}
+		plan.Delete = append(plan.Delete, referrers...)
+	}
+	plan.Delete = append(plan.Delete, manifests...)
+	plan.Delete = append(plan.Delete, untags...)
+	return plan, nil
+}
+
+// markKept marks a manifest as kept, along with the manifests of an index,
+// so deleting another tag never deletes content a kept tag refers to.
+func (e *Engine) markKept(digest string, kept map[string]bool) {
+	if kept[digest] {
+		return
+	}
+	kept[digest] = true
+	if c, ok := e.cached(digest); ok {
+		for _, d := range c.Manifests {
+			e.markKept(d.Digest, kept)
+		}
+	}
+}
+
+// keep returns whether the policy keeps a tag, which is the rank-th most
+// recently created, and why. A negative rank skips KeepLast.
+func (e *Engine) keep(info *tagInfo, rank int) (string, bool) {
+	p := e.policy
+	for _, re := range p.KeepTags {
+		if re.MatchString(info.name) {
+			return fmt.Sprintf("matches %s", re), true
+		}
+	}
+	if v, ok := semver.Parse(info.name); ok {
+		for i, r := range e.versions {
+			if r.Contains(v) {
+				return fmt.Sprintf("version in range %s", p.KeepVersions[i]), true
+			}
+		}
+	}
+	if rank >= 0 && rank < p.KeepLast {
+		return fmt.Sprintf("one of the %d most recent", p.KeepLast), true
+	}
+	if p.MaxAge > 0 {
+		if info.created == nil {
+			return "creation date unknown", true
+		}
+		if age := e.now().Sub(*info.created); age <= p.MaxAge {
+			return fmt.Sprintf("created %s ago, within %s", age.Round(time.Second), p.MaxAge), true
+		}
+		return fmt.Sprintf("created more than %s ago", p.MaxAge), false
+	}
+	if p.KeepLast > 0 {
+		return fmt.Sprintf("not one of the %d most recent", p.KeepLast), false
+	}
+	return "no policy deletes it", true
+}
+
+// orphanedReferrers plans deleting the referrers of deleted manifests, and
+// those listed by referrers tags whose subject is gone, along with the
+// referrers tags themselves.
+func (e *Engine) orphanedReferrers(ctx context.Context, name string, manifests []Deletion, referrersTags []*tagInfo, gone map[string]bool, kept map[string]bool) ([]Deletion, error) {
+	var deletions []Deletion
+	planned := map[string]bool{}
+	var walk func(subject string, referrers []reggie.Descriptor, reason string) error
+	walk = func(subject string, referrers []reggie.Descriptor, reason string) error {
+		for _, r := range referrers {
+			if planned[r.Digest] || kept[r.Digest] {
+				continue
+			}
+			planned[r.Digest] = true
+			nested, err := e.client.Referrers(ctx, name, r.Digest, "")
+			if err != nil {
+				return err
+			}
+			if err := walk(r.Digest, nested, "subject "+r.Digest+" is deleted"); err != nil {
+				return err
+			}
+			deletions = append(deletions, Deletion{Action: DeleteReferrer, Digest: r.Digest, Subject: subject, Reason: reason})
+		}
+		return nil
+	}
+
+	for _, m := range manifests {
+		referrers, err := e.client.Referrers(ctx, name, m.Digest, "")
+		if err != nil {
+			return nil, err
+		}
+		if err := walk(m.Digest, referrers, "subject "+m.Digest+" is deleted"); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, info := range referrersTags {
+		subject := strings.Replace(info.name, "-", ":", 1)
+		reason := "subject " + subject + " is gone"
+		if gone[subject] {
+			reason = "subject " + subject + " is deleted"
+		} else {
+			_, err := e.client.ResolveManifest(ctx, name, subject)
+			if err == nil {
+				continue
+			}
+			if !isNotFound(err) {
+				return nil, err
+			}
+		}
+		c, err := e.fetch(ctx, name, info.digest)
+		if err != nil {
+			return nil, err
+		}
+		if err := walk(subject, c.Manifests, reason); err != nil {
+			return nil, err
+		}
+		if !planned[info.digest] {
+			planned[info.digest] = true
+			deletions = append(deletions, Deletion{Action: DeleteManifest, Digest: info.digest, Tags: []string{info.name}, Subject: subject, Reason: reason})
+		}
+	}
+	return deletions, nil
+}
+
+// fetch fetches a manifest, caching it by digest.
+func (e *Engine) fetch(ctx context.Context, name string, reference string) (*content, error) {
+	if c, ok := e.cached(reference); ok {
+		return c, nil
+	}
+	desc, body, err := e.client.GetManifest(ctx, name, reference)
+	if err != nil {
+		return nil, err
+	}
+	c := &content{desc: desc}
+	if err := json.Unmarshal(body, c); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s:%s: %w", name, reference, err)
+	}
+	e.mu.Lock()
+	e.contentCache[desc.Digest] = c
+	e.mu.Unlock()
+	return c, nil
+}
+
+// cached returns the manifest with the given digest if it was fetched.
+func (e *Engine) cached(digest string) (*content, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c, ok := e.contentCache[digest]
+	return c, ok
+}
+
+// created returns the creation date of a manifest: its created annotation,
+// the created field of its image config, or for an index the newest of its
+// manifests. It returns nil if the date is unknown.
+func (e *Engine) created(ctx context.Context, name string, c *content) (*time.Time, error) {
+	if s := c.Annotations[annotationCreated]; s != "" {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return &t, nil
+		}
+	}
+	if c.Manifests != nil {
+		var newest *time.Time
+		for _, d := range c.Manifests {
+			child, err := e.fetch(ctx, name, d.Digest)
+			if err != nil {
+				return nil, err
+			}
+			t, err := e.created(ctx, name, child)
+			if err != nil {
+				return nil, err
+			}
+			if t != nil && (newest == nil || t.After(*newest)) {
+				newest = t
+			}
+		}
+		return newest, nil
+	}
+	if c.Config == nil || c.Config.Size > maxConfigSize {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := e.client.PullBlob(ctx, name, *c.Config, &buf); err != nil {
+		return nil, err
+	}
+	var config struct {
+		Created *time.Time `json:"created"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &config); err != nil {
+		return nil, nil
+	}
+	return config.Created, nil
+}
+
+// isNotFound returns whether err is a response error with status 404.
+func isNotFound(err error) bool {
+	var respErr *reggie.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
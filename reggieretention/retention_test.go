@@ -0,0 +1,235 @@
+package reggieretention
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bloodorangeio/reggie"
+	"github.com/bloodorangeio/reggie/reggietest"
+)
+
+var now = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// putImage stores an image created the given number of days before now,
+// returning the digest of its manifest.
+func putImage(t *testing.T, registry *reggietest.Registry, name string, tag string, days int) string {
+	t.Helper()
+	config := []byte(fmt.Sprintf(`{"created":"%s","architecture":"amd64","os":"linux"}`,
+		now.AddDate(0, 0, -days).Format(time.RFC3339)))
+	configDigest := registry.PutBlob(name, config)
+	manifest := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"%s","size":%d},"layers":[]}`,
+		reggie.MediaTypeImageManifest, configDigest, len(config)))
+	digest, err := registry.PutManifest(name, tag, reggie.MediaTypeImageManifest, manifest)
+	if err != nil {
+		t.Fatalf("Errors storing manifest: %s", err)
+	}
+	return digest
+}
+
+// putReferrer stores an artifact referring to subject, returning its
+// descriptor.
+func putReferrer(t *testing.T, registry *reggietest.Registry, name string, subject string) reggie.Descriptor {
+	t.Helper()
+	manifest := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","artifactType":"application/vnd.example.signature",`+
+		`"config":{"mediaType":"application/vnd.oci.empty.v1+json","digest":"%s","size":2},"layers":[],`+
+		`"subject":{"mediaType":"%s","digest":"%s","size":1}}`,
+		reggie.MediaTypeImageManifest, reggie.DigestFromBytes([]byte("{}")), reggie.MediaTypeImageManifest, subject))
+	digest, err := registry.PutManifest(name, reggie.DigestFromBytes(manifest), reggie.MediaTypeImageManifest, manifest)
+	if err != nil {
+		t.Fatalf("Errors storing referrer: %s", err)
+	}
+	return reggie.Descriptor{MediaType: reggie.MediaTypeImageManifest, Digest: digest, Size: int64(len(manifest))}
+}
+
+func TestPlanAndExecute(t *testing.T) {
+	ctx := context.Background()
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	old := putImage(t, registry, "ci/app", "ci-1", 30)
+	registry.PutManifest("ci/app", "latest", reggie.MediaTypeImageManifest, mustManifest(t, registry, "ci/app", old))
+	putImage(t, registry, "ci/app", "ci-2", 2)
+	putImage(t, registry, "ci/app", "ci-3", 1)
+	putImage(t, registry, "ci/app", "v1.0.0", 40)
+	putImage(t, registry, "ci/app", "v1.1.0", 35)
+	v2 := putImage(t, registry, "ci/app", "v2.0.0", 20)
+	signature := putReferrer(t, registry, "ci/app", v2)
+
+	client, _ := reggie.NewClient(registry.URL)
+	engine, err := NewEngine(client, Policy{
+		KeepLast:                2,
+		KeepTags:                []*regexp.Regexp{regexp.MustCompile(`^latest$`)},
+		KeepVersions:            []string{"^1.0"},
+		DeleteOrphanedReferrers: true,
+	}, WithClock(func() time.Time { return now }), WithConcurrency(2))
+	if err != nil {
+		t.Fatalf("Errors creating engine: %s", err)
+	}
+	plan, err := engine.Plan(ctx, "ci/app")
+	if err != nil {
+		t.Fatalf("Errors planning: %s", err)
+	}
+
+	var kept []string
+	for _, k := range plan.Keep {
+		kept = append(kept, k.Tag)
+	}
+	if strings.Join(kept, ",") != "ci-3,ci-2,latest,v1.1.0,v1.0.0" {
+		t.Fatalf("Unexpected tags kept: %v", kept)
+	}
+	if len(plan.Delete) != 3 ||
+		plan.Delete[0].Action != DeleteReferrer || plan.Delete[0].Digest != signature.Digest || plan.Delete[0].Subject != v2 ||
+		plan.Delete[1].Action != DeleteManifest || plan.Delete[1].Digest != v2 ||
+		plan.Delete[2].Action != Untag || plan.Delete[2].Tags[0] != "ci-1" {
+		t.Fatalf("Unexpected deletions: %+v", plan.Delete)
+	}
+	var text bytes.Buffer
+	plan.WriteText(&text)
+	if !strings.Contains(text.String(), "keep       v1.0.0 (version in range ^1.0)") ||
+		!strings.Contains(text.String(), "delete     tag ci-1 (not one of the 2 most recent)") {
+		t.Fatalf("Unexpected plan text:\n%s", text.String())
+	}
+
+	// the plan is a dry run
+	if _, ok := registry.Manifest("ci/app", "v2.0.0"); !ok {
+		t.Fatalf("Expected planning not to delete anything")
+	}
+
+	report := engine.Execute(ctx, plan)
+	if deleted, notFound, failed := report.Counts(); deleted != 3 || notFound != 0 || failed != 0 || !report.Passed() {
+		t.Fatalf("Unexpected report: %+v", report.Results)
+	}
+	for _, tag := range []string{"v2.0.0", "ci-1"} {
+		if _, ok := registry.Manifest("ci/app", tag); ok {
+			t.Fatalf("Expected %s to be deleted", tag)
+		}
+	}
+	for _, ref := range []string{"latest", old, "v1.0.0", "ci-3"} {
+		if _, ok := registry.Manifest("ci/app", ref); !ok {
+			t.Fatalf("Expected %s to be kept", ref)
+		}
+	}
+	if _, ok := registry.Manifest("ci/app", signature.Digest); ok {
+		t.Fatalf("Expected referrer to be deleted")
+	}
+
+	// executing again finds everything gone
+	report = engine.Execute(ctx, plan)
+	if _, notFound, _ := report.Counts(); notFound != 3 {
+		t.Fatalf("Expected deletions to find content gone but got %+v", report.Results)
+	}
+}
+
+func TestMaxAgeAndOrphanedReferrersTag(t *testing.T) {
+	ctx := context.Background()
+	registry := reggietest.NewRegistry(reggietest.WithoutReferrersAPI())
+	defer registry.Close()
+	putImage(t, registry, "ci/app", "fresh", 3)
+	putImage(t, registry, "ci/app", "stale", 10)
+
+	// a referrers tag whose subject was deleted long ago
+	gone := reggie.DigestFromBytes([]byte("gone"))
+	signature := putReferrer(t, registry, "ci/app", gone)
+	index := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","manifests":[{"mediaType":"%s","digest":"%s","size":%d}]}`,
+		reggie.MediaTypeImageIndex, signature.MediaType, signature.Digest, signature.Size))
+	indexDigest, err := registry.PutManifest("ci/app", reggie.ReferrersTag(gone), reggie.MediaTypeImageIndex, index)
+	if err != nil {
+		t.Fatalf("Errors storing referrers tag: %s", err)
+	}
+
+	client, _ := reggie.NewClient(registry.URL)
+	engine, err := NewEngine(client, Policy{MaxAge: 7 * 24 * time.Hour, DeleteOrphanedReferrers: true},
+		WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("Errors creating engine: %s", err)
+	}
+	plan, err := engine.Plan(ctx, "ci/app")
+	if err != nil {
+		t.Fatalf("Errors planning: %s", err)
+	}
+	if len(plan.Keep) != 1 || plan.Keep[0].Tag != "fresh" || len(plan.Delete) != 3 ||
+		plan.Delete[0].Digest != signature.Digest || plan.Delete[1].Digest != indexDigest ||
+		plan.Delete[2].Tags[0] != "stale" || plan.Delete[2].Reason != "created more than 168h0m0s ago" {
+		t.Fatalf("Unexpected plan: %+v", plan)
+	}
+	report := engine.Execute(ctx, plan)
+	if !report.Passed() {
+		t.Fatalf("Unexpected failures: %+v", report.Results)
+	}
+	var text bytes.Buffer
+	report.WriteText(&text)
+	if !strings.Contains(text.String(), "ci/app: 3 deleted, 0 already gone, 0 failed, 1 tags kept") {
+		t.Fatalf("Unexpected report text:\n%s", text.String())
+	}
+}
+
+func TestConcurrentPlans(t *testing.T) {
+	ctx := context.Background()
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	for _, name := range []string{"ci/a", "ci/b"} {
+		for i := 1; i <= 3; i++ {
+			putImage(t, registry, name, fmt.Sprintf("ci-%d", i), i)
+		}
+	}
+	client, _ := reggie.NewClient(registry.URL)
+	engine, err := NewEngine(client, Policy{KeepLast: 1}, WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("Errors creating engine: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"ci/a", "ci/b", "ci/a", "ci/b"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			plan, err := engine.Plan(ctx, name)
+			if err != nil || len(plan.Keep) != 1 || len(plan.Delete) != 2 {
+				t.Errorf("Unexpected plan of %s: %+v: %v", name, plan, err)
+			}
+		}(name)
+	}
+	wg.Wait()
+}
+
+func TestExecuteFailures(t *testing.T) {
+	ctx := context.Background()
+	registry := reggietest.NewRegistry(reggietest.WithTagDeletesDisabled())
+	defer registry.Close()
+	digest := putImage(t, registry, "ci/app", "old", 30)
+	registry.PutManifest("ci/app", "keep", reggie.MediaTypeImageManifest, mustManifest(t, registry, "ci/app", digest))
+
+	client, _ := reggie.NewClient(registry.URL)
+	engine, _ := NewEngine(client, Policy{MaxAge: time.Hour, KeepTags: []*regexp.Regexp{regexp.MustCompile(`^keep$`)}},
+		WithClock(func() time.Time { return now }))
+	plan, err := engine.Plan(ctx, "ci/app")
+	if err != nil {
+		t.Fatalf("Errors planning: %s", err)
+	}
+	report := engine.Execute(ctx, plan)
+	if report.Passed() || len(report.Results) != 1 || report.Results[0].Status != Failed {
+		t.Fatalf("Expected untagging to fail rather than delete the kept manifest but got %+v", report.Results)
+	}
+	if _, ok := registry.Manifest("ci/app", "keep"); !ok {
+		t.Fatalf("Expected kept tag to survive")
+	}
+
+	if _, err := NewEngine(client, Policy{KeepVersions: []string{">=1.0 <"}}); err == nil {
+		t.Fatalf("Expected invalid version range to be rejected")
+	}
+}
+
+// mustManifest returns the content of a stored manifest.
+func mustManifest(t *testing.T, registry *reggietest.Registry, name string, reference string) []byte {
+	t.Helper()
+	m, ok := registry.Manifest(name, reference)
+	if !ok {
+		t.Fatalf("Expected manifest %s", reference)
+	}
+	return m.Content
+}
@@ -0,0 +1,112 @@
+package reggietest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	// grant is the access given by a token issued by the token server.
+	grant struct {
+		actions map[string]bool
+		expires time.Time
+	}
+)
+
+// authorize checks that a request is authorized for the given scopes, of the
+// form "repository:<name>:<actions>", writing a challenge if it is not.
+func (r *Registry) authorize(w http.ResponseWriter, req *http.Request, scopes ...string) bool {
+	switch {
+	case r.basicAuth:
+		if username, password, ok := req.BasicAuth(); ok && username == r.username && password == r.password {
+			return true
+		}
+		w.Header().Set("Www-Authenticate", fmt.Sprintf(`Basic realm=%q`, Service))
+	case r.tokenAuth:
+		scheme, token, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+		if strings.EqualFold(scheme, "bearer") && r.tokenAllows(token, scopes) {
+			return true
+		}
+		challenge := fmt.Sprintf(`Bearer realm="%s/token",service=%q`, r.URL, Service)
+		if len(scopes) > 0 {
+			challenge += fmt.Sprintf(`,scope=%q`, strings.Join(scopes, " "))
+		}
+		w.Header().Set("Www-Authenticate", challenge)
+	default:
+		return true
+	}
+	writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+	return false
+}
+
+// tokenAllows returns whether a token has been issued, has not expired, and
+// grants every action of scopes.
+func (r *Registry) tokenAllows(token string, scopes []string) bool {
+	r.tokensMu.Lock()
+	defer r.tokensMu.Unlock()
+	g, ok := r.tokens[token]
+	if !ok || time.Now().After(g.expires) {
+		return false
+	}
+	for _, scope := range scopes {
+		for _, action := range scopeActions(scope) {
+			if !g.actions[action] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// serveToken issues a token granting the requested scopes to clients with
+// valid credentials.
+func (r *Registry) serveToken(w http.ResponseWriter, req *http.Request) {
+	if r.username != "" || r.password != "" {
+		username, password, ok := req.BasicAuth()
+		if !ok || username != r.username || password != r.password {
+			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
+			return
+		}
+	}
+	if service := req.URL.Query().Get("service"); service != Service {
+		writeError(w, http.StatusBadRequest, "DENIED", "unknown service")
+		return
+	}
+
+	g := &grant{actions: map[string]bool{}, expires: time.Now().Add(r.tokenExpiry)}
+	for _, param := range req.URL.Query()["scope"] {
+		for _, scope := range strings.Fields(param) {
+			for _, action := range scopeActions(scope) {
+				g.actions[action] = true
+			}
+		}
+	}
+	token := randomID()
+	r.tokensMu.Lock()
+	r.tokens[token] = g
+	r.tokensMu.Unlock()
+
+	writeJSON(w, "application/json", map[string]interface{}{
+		"token":        token,
+		"access_token": token,
+		"expires_in":   int(r.tokenExpiry.Seconds()),
+		"issued_at":    time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// scopeActions splits a scope such as "repository:a:pull,push" into the
+// individual actions it covers, e.g. "repository:a:pull" and
+// "repository:a:push".
+func scopeActions(scope string) []string {
+	i := strings.LastIndex(scope, ":")
+	if i < 0 {
+		return nil
+	}
+	var actions []string
+	for _, action := range strings.Split(scope[i+1:], ",") {
+		actions = append(actions, scope[:i+1]+action)
+	}
+	return actions
+}
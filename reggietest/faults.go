@@ -0,0 +1,248 @@
+package reggietest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errDropped = errors.New("reggietest: connection dropped by fault")
+)
+
+type (
+	// Fault describes a failure injected into the responses of a Registry,
+	// and of its blob storage host when using WithStorageRedirects.
+	Fault struct {
+		// Method and Path select the requests the fault applies to. Path is
+		// a regular expression matched against the URL path. Empty values
+		// match any request.
+		Method string
+		Path   string
+
+		// Match further selects requests, if set.
+		Match func(req *http.Request) bool
+
+		// Times is how many matching requests the fault applies to. Zero
+		// applies it to all of them.
+		Times int
+
+		// Latency delays the response.
+		Latency time.Duration
+
+		// ExpireTokens expires all tokens issued by the token server
+		// before the request is authorized.
+		ExpireTokens bool
+
+		// Status replaces the response with one of the given status, with
+		// an OCI error body if Code is set.
+		Status  int
+		Code    string
+		Message string
+
+		// RetryAfter sets the Retry-After header of the replaced response,
+		// whose status defaults to 429 Too Many Requests.
+		RetryAfter time.Duration
+
+		// Drop closes the connection after DropAfter bytes of the response
+		// body have been sent.
+		Drop      bool
+		DropAfter int64
+
+		path    *regexp.Regexp
+		applied int
+	}
+
+	// droppingWriter closes the connection once a number of bytes of the
+	// response body have been written.
+	droppingWriter struct {
+		http.ResponseWriter
+		remaining int64
+		dropped   bool
+	}
+)
+
+// WithStorageRedirects serves blob downloads from a separate blob storage
+// host, to which the registry redirects with a pre-signed URL, as registries
+// backed by cloud storage do.
+func WithStorageRedirects() Option {
+	return func(r *Registry) {
+		r.storageRedirects = true
+	}
+}
+
+// InjectFault adds a fault to the registry. Faults are applied in the order
+// they were added; only the first matching fault applies to a request. The
+// Path of the fault must be a valid regular expression.
+func (r *Registry) InjectFault(f Fault) {
+	if f.Path != "" {
+		f.path = regexp.MustCompile(f.Path)
+	}
+	r.faultsMu.Lock()
+	defer r.faultsMu.Unlock()
+	r.faults = append(r.faults, &f)
+}
+
+// ClearFaults removes all faults from the registry.
+func (r *Registry) ClearFaults() {
+	r.faultsMu.Lock()
+	defer r.faultsMu.Unlock()
+	r.faults = nil
+}
+
+// ExpireTokens expires all tokens issued by the token server.
+func (r *Registry) ExpireTokens() {
+	r.tokensMu.Lock()
+	defer r.tokensMu.Unlock()
+	r.tokens = map[string]*grant{}
+}
+
+// Requests returns the method and path of each request received by the
+// registry and its blob storage host, e.g. "GET /v2/a/blobs/sha256:...".
+func (r *Registry) Requests() []string {
+	r.faultsMu.Lock()
+	defer r.faultsMu.Unlock()
+	return append([]string{}, r.requests...)
+}
+
+// StorageURL returns the URL of the blob storage host, or an empty string if
+// storage redirects are disabled.
+func (r *Registry) StorageURL() string {
+	if r.storage == nil {
+		return ""
+	}
+	return r.storage.URL
+}
+
+// Close shuts down the registry and its blob storage host.
+func (r *Registry) Close() {
+	r.Server.Close()
+	if r.storage != nil {
+		r.storage.Close()
+	}
+}
+
+// startStorage starts the blob storage host, which serves blobs at pre-signed
+// URLs without further auth.
+func (r *Registry) startStorage() {
+	r.storageSignature = randomID()
+	r.storage = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w, ok := r.applyFault(w, req)
+		if !ok {
+			return
+		}
+		name, digest, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/storage/"), "@")
+		if req.URL.Query().Get("X-Signature") != r.storageSignature {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		content, ok := r.Blob(name, digest)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(content))
+	}))
+}
+
+// storageLocation returns the pre-signed URL of a blob on the storage host.
+func (r *Registry) storageLocation(name string, digest string) string {
+	return fmt.Sprintf("%s/storage/%s@%s?X-Signature=%s&X-Expires=300", r.storage.URL, name, digest, r.storageSignature)
+}
+
+// applyFault records a request and applies the first matching fault,
+// returning the writer to serve the request with, or false if the fault
+// replaced the response.
+func (r *Registry) applyFault(w http.ResponseWriter, req *http.Request) (http.ResponseWriter, bool) {
+	r.faultsMu.Lock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+	var fault *Fault
+	for _, f := range r.faults {
+		if f.matches(req) {
+			f.applied++
+			fault = f
+			break
+		}
+	}
+	r.faultsMu.Unlock()
+	if fault == nil {
+		return w, true
+	}
+
+	if fault.Latency > 0 {
+		select {
+		case <-time.After(fault.Latency):
+		case <-req.Context().Done():
+			return w, false
+		}
+	}
+	if fault.ExpireTokens {
+		r.ExpireTokens()
+	}
+
+	status := fault.Status
+	if status == 0 && fault.RetryAfter > 0 {
+		status = http.StatusTooManyRequests
+	}
+	if status != 0 {
+		if fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(fault.RetryAfter.Seconds())))
+		}
+		if fault.Code != "" {
+			writeError(w, status, fault.Code, fault.Message)
+		} else {
+			w.WriteHeader(status)
+		}
+		return w, false
+	}
+	if fault.Drop {
+		return &droppingWriter{ResponseWriter: w, remaining: fault.DropAfter}, true
+	}
+	return w, true
+}
+
+func (f *Fault) matches(req *http.Request) bool {
+	if f.Times > 0 && f.applied >= f.Times {
+		return false
+	}
+	if f.Method != "" && f.Method != req.Method {
+		return false
+	}
+	if f.path != nil && !f.path.MatchString(req.URL.Path) {
+		return false
+	}
+	return f.Match == nil || f.Match(req)
+}
+
+func (w *droppingWriter) Write(p []byte) (int, error) {
+	if w.dropped {
+		return 0, errDropped
+	}
+	if int64(len(p)) <= w.remaining {
+		w.remaining -= int64(len(p))
+		return w.ResponseWriter.Write(p)
+	}
+	n, _ := w.ResponseWriter.Write(p[:w.remaining])
+	w.drop()
+	return n, errDropped
+}
+
+// drop flushes what was written so far and closes the connection.
+func (w *droppingWriter) drop() {
+	w.dropped = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		if conn, _, err := h.Hijack(); err == nil {
+			conn.Close()
+		}
+	}
+}
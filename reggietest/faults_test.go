@@ -0,0 +1,164 @@
+package reggietest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bloodorangeio/reggie"
+	"github.com/bloodorangeio/reggie/reggietest"
+)
+
+func TestFaults(t *testing.T) {
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+
+	client, err := reggie.NewClient(registry.URL, reggie.WithDefaultName("a"))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	digest := registry.PutBlob("a", content)
+	desc := reggie.Descriptor{Digest: digest, Size: int64(len(content))}
+
+	// OCI error bodies, applied a limited number of times
+	registry.InjectFault(reggietest.Fault{
+		Method:  reggie.GET,
+		Path:    "/tags/list",
+		Times:   1,
+		Status:  http.StatusForbidden,
+		Code:    "DENIED",
+		Message: "requested access to the resource is denied",
+	})
+	resp, err := client.Do(client.NewRequest(reggie.GET, "/v2/<name>/tags/list"))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if errs, _ := resp.Errors(); resp.StatusCode() != http.StatusForbidden || len(errs) != 1 || errs[0].Code != "DENIED" {
+		t.Fatalf("Expected DENIED error but got %d %s", resp.StatusCode(), resp.Body())
+	}
+	resp, err = client.Do(client.NewRequest(reggie.GET, "/v2/<name>/tags/list"))
+	if err != nil || resp.StatusCode() != http.StatusOK {
+		t.Fatalf("Expected fault to apply once: %v", err)
+	}
+
+	// 429 with Retry-After
+	registry.InjectFault(reggietest.Fault{Path: "/tags/list", RetryAfter: 2 * time.Second})
+	resp, err = client.Do(client.NewRequest(reggie.GET, "/v2/<name>/tags/list"))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if resp.StatusCode() != http.StatusTooManyRequests || resp.Header().Get("Retry-After") != "2" {
+		t.Fatalf("Expected 429 with Retry-After but got %d %q", resp.StatusCode(), resp.Header().Get("Retry-After"))
+	}
+
+	// dropped connections are caught by digest and size verification
+	registry.InjectFault(reggietest.Fault{Method: reggie.GET, Path: "/blobs/", Times: 1, Drop: true, DropAfter: 100})
+	var buf bytes.Buffer
+	if err := client.PullBlob(ctx, "a", desc, &buf); err == nil {
+		t.Fatalf("Expected error pulling blob over dropped connection")
+	}
+	buf.Reset()
+	if err := client.PullBlob(ctx, "a", desc, &buf); err != nil || !bytes.Equal(buf.Bytes(), content) {
+		t.Fatalf("Expected blob to be pulled after fault was exhausted: %v", err)
+	}
+
+	// latency
+	registry.InjectFault(reggietest.Fault{Path: "/manifests/", Latency: time.Second})
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	req := client.NewRequest(reggie.GET, "/v2/<name>/manifests/v1").SetContext(timeout)
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected request to time out but got %v", err)
+	}
+
+	registry.ClearFaults()
+	resp, err = client.Do(client.NewRequest(reggie.GET, "/v2/<name>/tags/list"))
+	if err != nil || resp.StatusCode() != http.StatusOK {
+		t.Fatalf("Expected faults to be cleared: %v", err)
+	}
+}
+
+func TestFaultExpireTokens(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithTokenAuth("", ""))
+	defer registry.Close()
+
+	client, err := reggie.NewClient(registry.URL)
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	// the token expires part way through a chunked upload, and is renewed
+	registry.InjectFault(reggietest.Fault{
+		Method:       reggie.PATCH,
+		Times:        1,
+		ExpireTokens: true,
+		Match: func(req *http.Request) bool {
+			return strings.HasPrefix(req.Header.Get("Content-Range"), "4-")
+		},
+	})
+	content := []byte("uploaded in three chunks")
+	desc := reggie.Descriptor{Digest: reggie.DigestFromBytes(content), Size: int64(len(content))}
+	err = client.PushBlob(context.Background(), "a", desc, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}, reggie.WithChunkSize(4))
+	if err != nil {
+		t.Fatalf("Errors pushing blob: %s", err)
+	}
+	if stored, _ := registry.Blob("a", desc.Digest); !bytes.Equal(stored, content) {
+		t.Fatalf("Expected registry to store %q but got %q", content, stored)
+	}
+
+	tokenRequests := 0
+	for _, r := range registry.Requests() {
+		if r == "GET /token" {
+			tokenRequests++
+		}
+	}
+	// one token each for the pull and push scopes, and one to replace the
+	// expired push token
+	if tokenRequests != 3 {
+		t.Fatalf("Expected 3 token requests but got %d", tokenRequests)
+	}
+}
+
+func TestStorageRedirects(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithStorageRedirects(), reggietest.WithBasicAuth("user", "pass"))
+	defer registry.Close()
+
+	client, err := reggie.NewClient(registry.URL, reggie.WithUsernamePassword("user", "pass"))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	content := []byte("served from storage")
+	digest := registry.PutBlob("a", content)
+	desc := reggie.Descriptor{Digest: digest, Size: int64(len(content))}
+
+	var buf bytes.Buffer
+	if err := client.PullBlob(context.Background(), "a", desc, &buf); err != nil {
+		t.Fatalf("Errors pulling blob: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), content) {
+		t.Fatalf("Expected %q but got %q", content, buf.Bytes())
+	}
+	if requests := registry.Requests(); requests[len(requests)-1] != "GET /storage/a@"+digest {
+		t.Fatalf("Expected blob to be served by storage host but got requests %v", requests)
+	}
+
+	// faults apply to the storage host too
+	registry.InjectFault(reggietest.Fault{Path: "^/storage/", Status: http.StatusServiceUnavailable})
+	resp, err := client.Do(client.NewRequest(reggie.GET, "/v2/<name>/blobs/<digest>",
+		reggie.WithName("a"), reggie.WithDigest(digest)))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if resp.StatusCode() != http.StatusServiceUnavailable || !strings.HasPrefix(resp.RawResponse.Request.URL.String(), registry.StorageURL()) {
+		t.Fatalf("Expected storage host to fail but got %d", resp.StatusCode())
+	}
+}
@@ -0,0 +1,839 @@
+// Package reggietest provides an in-memory OCI registry for tests.
+//
+// The registry implements the pull, push, content discovery and content
+// management parts of the OCI distribution spec: blobs, monolithic and
+// chunked uploads, cross-repository mounts, manifests, tags, referrers, the
+// catalog and deletes, as well as extension discovery. It may require Basic
+// auth, or Bearer tokens issued by a built-in token server.
+package reggietest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MediaTypeImageIndex is the media type of referrers responses.
+	MediaTypeImageIndex = "application/vnd.oci.image.index.v1+json"
+
+	// Service is the service name of the built-in token server.
+	Service = "reggietest"
+)
+
+var (
+	nameMatcher = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*)*$`)
+	tagMatcher  = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+)
+
+type (
+	// Registry is an in-memory OCI registry served over HTTP.
+	Registry struct {
+		*httptest.Server
+
+		basicAuth          bool
+		tokenAuth          bool
+		username           string
+		password           string
+		deletesDisabled    bool
+		tagDeletesDisabled bool
+		referrersDisabled  bool
+		tokenExpiry        time.Duration
+		extensions         []Extension
+
+		mu      sync.Mutex
+		repos   map[string]*repository
+		uploads int
+
+		tokensMu sync.Mutex
+		tokens   map[string]*grant
+
+		storageRedirects bool
+		storage          *httptest.Server
+		storageSignature string
+
+		faultsMu sync.Mutex
+		faults   []*Fault
+		requests []string
+	}
+
+	// Option configures a Registry.
+	Option func(r *Registry)
+
+	// Manifest is a manifest stored in a Registry.
+	Manifest struct {
+		MediaType    string
+		ArtifactType string
+		Content      []byte
+		Subject      string
+		Annotations  map[string]string
+	}
+
+	// Descriptor describes content in referrers responses.
+	Descriptor struct {
+		MediaType    string            `json:"mediaType"`
+		ArtifactType string            `json:"artifactType,omitempty"`
+		Digest       string            `json:"digest"`
+		Size         int64             `json:"size"`
+		Annotations  map[string]string `json:"annotations,omitempty"`
+	}
+
+	// Extension is an extension listed by the discover endpoints of the
+	// OCI extensions proposal.
+	Extension struct {
+		Name        string   `json:"name"`
+		URL         string   `json:"url,omitempty"`
+		Description string   `json:"description,omitempty"`
+		Endpoints   []string `json:"endpoints,omitempty"`
+	}
+
+	repository struct {
+		blobs     map[string][]byte
+		manifests map[string]*Manifest
+		tags      map[string]string
+		uploads   map[string]*bytes.Buffer
+	}
+
+	manifestFields struct {
+		MediaType    string            `json:"mediaType"`
+		ArtifactType string            `json:"artifactType"`
+		Annotations  map[string]string `json:"annotations"`
+		Config       *struct {
+			MediaType string `json:"mediaType"`
+		} `json:"config"`
+		Subject *struct {
+			Digest string `json:"digest"`
+		} `json:"subject"`
+	}
+
+	errorInfo struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+)
+
+// WithBasicAuth requires requests to use Basic auth with the given
+// credentials.
+func WithBasicAuth(username string, password string) Option {
+	return func(r *Registry) {
+		r.basicAuth = true
+		r.username = username
+		r.password = password
+	}
+}
+
+// WithTokenAuth requires requests to use Bearer tokens, issued by a token
+// server at /token. Tokens are issued to clients authenticating with the
+// given credentials, or to anonymous clients if both are empty.
+func WithTokenAuth(username string, password string) Option {
+	return func(r *Registry) {
+		r.tokenAuth = true
+		r.username = username
+		r.password = password
+	}
+}
+
+// WithTokenExpiry sets the expires_in of tokens issued by the token server.
+func WithTokenExpiry(expiry time.Duration) Option {
+	return func(r *Registry) {
+		r.tokenExpiry = expiry
+	}
+}
+
+// WithDeletesDisabled rejects deletes with 405 Method Not Allowed, as
+// registries do when deletion is disabled.
+func WithDeletesDisabled() Option {
+	return func(r *Registry) {
+		r.deletesDisabled = true
+	}
+}
+
+// WithTagDeletesDisabled rejects deletes of manifests by tag with 400 Bad
+// Request, as registries which only delete manifests by digest do.
+func WithTagDeletesDisabled() Option {
+	return func(r *Registry) {
+		r.tagDeletesDisabled = true
+	}
+}
+
+// WithoutReferrersAPI serves 404 Not Found for the referrers API, as
+// registries which predate it do.
+func WithoutReferrersAPI() Option {
+	return func(r *Registry) {
+		r.referrersDisabled = true
+	}
+}
+
+// WithExtensions lists extensions at /v2/_oci/ext/discover and at the
+// discover endpoint of every repository. Without it, both are not found, as
+// with registries which do not implement the extensions proposal.
+func WithExtensions(extensions ...Extension) Option {
+	return func(r *Registry) {
+		r.extensions = extensions
+	}
+}
+
+// NewRegistry starts a Registry. Callers should call Close when finished.
+func NewRegistry(opts ...Option) *Registry {
+	r := newRegistry(opts)
+	r.Server = httptest.NewServer(r)
+	if r.storageRedirects {
+		r.startStorage()
+	}
+	return r
+}
+
+// NewTLSRegistry starts a Registry serving HTTPS. Clients may trust it using
+// the certificate of its Server.
+func NewTLSRegistry(opts ...Option) *Registry {
+	r := newRegistry(opts)
+	r.Server = httptest.NewTLSServer(r)
+	if r.storageRedirects {
+		r.startStorage()
+	}
+	return r
+}
+
+func newRegistry(opts []Option) *Registry {
+	r := &Registry{
+		repos:       map[string]*repository{},
+		tokens:      map[string]*grant{},
+		tokenExpiry: 5 * time.Minute,
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// Host returns the host and port of the registry, for use in references.
+func (r *Registry) Host() string {
+	u, _ := url.Parse(r.URL)
+	return u.Host
+}
+
+// PutBlob stores a blob in a repository and returns its digest.
+func (r *Registry) PutBlob(name string, content []byte) string {
+	digest := sha256Digest(content)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.repo(name).blobs[digest] = append([]byte{}, content...)
+	return digest
+}
+
+// Blob returns a blob stored in a repository.
+func (r *Registry) Blob(name string, digest string) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, ok := r.repos[name]
+	if !ok {
+		return nil, false
+	}
+	b, ok := repo.blobs[digest]
+	return b, ok
+}
+
+// PutManifest stores a manifest in a repository, tagging it if reference is
+// a tag, and returns its digest.
+func (r *Registry) PutManifest(name string, reference string, mediaType string, content []byte) (string, error) {
+	m, err := parseManifest(mediaType, content)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.putManifest(name, reference, m), nil
+}
+
+// Manifest returns a manifest stored in a repository, by tag or digest.
+func (r *Registry) Manifest(name string, reference string) (*Manifest, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, m := r.manifest(name, reference)
+	return m, m != nil
+}
+
+// Tags returns the tags of a repository in lexical order.
+func (r *Registry) Tags(name string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, ok := r.repos[name]
+	if !ok {
+		return nil
+	}
+	return sortedKeys(repo.tags)
+}
+
+// Uploads returns how many upload sessions have been started.
+func (r *Registry) Uploads() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.uploads
+}
+
+// ServeHTTP satisfies the http.Handler interface.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w, ok := r.applyFault(w, req)
+	if !ok {
+		return
+	}
+	path := req.URL.Path
+	if path == "/token" && r.tokenAuth {
+		r.serveToken(w, req)
+		return
+	}
+	if path != "/v2" && !strings.HasPrefix(path, "/v2/") {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		return
+	}
+	if path == "/v2/" || path == "/v2" {
+		if r.authorize(w, req) {
+			w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+			w.WriteHeader(http.StatusOK)
+		}
+		return
+	}
+	if path == "/v2/_oci/ext/discover" {
+		if r.authorize(w, req) {
+			r.serveExtensions(w, req, "", "")
+		}
+		return
+	}
+	if path == "/v2/_catalog" {
+		if r.authorize(w, req, "registry:catalog:*") {
+			r.serveCatalog(w, req)
+		}
+		return
+	}
+
+	// the repository name may itself contain the separators of other
+	// routes, so the route whose separator appears last is used
+	rest := strings.TrimPrefix(path, "/v2/")
+	var serve func(w http.ResponseWriter, req *http.Request, name string, arg string)
+	var name, arg string
+	best := -1
+	for _, route := range []struct {
+		sep   string
+		serve func(w http.ResponseWriter, req *http.Request, name string, arg string)
+	}{
+		{"/blobs/uploads/", r.serveUpload},
+		{"/blobs/uploads", r.serveUpload},
+		{"/blobs/", r.serveBlob},
+		{"/manifests/", r.serveManifest},
+		{"/tags/list", r.serveTags},
+		{"/referrers/", r.serveReferrers},
+		{"/_oci/ext/discover", r.serveExtensions},
+	} {
+		i := strings.LastIndex(rest, route.sep)
+		if i <= best || (route.sep == "/tags/list" || route.sep == "/blobs/uploads" || route.sep == "/_oci/ext/discover") && i+len(route.sep) != len(rest) {
+			continue
+		}
+		best, serve = i, route.serve
+		name, arg = rest[:i], rest[i+len(route.sep):]
+	}
+	if serve == nil {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		return
+	}
+	if !nameMatcher.MatchString(name) {
+		writeError(w, http.StatusBadRequest, "NAME_INVALID", "invalid repository name")
+		return
+	}
+	scopes := []string{"repository:" + name + ":" + action(req.Method)}
+	if from := req.URL.Query().Get("from"); req.Method == http.MethodPost && from != "" {
+		scopes = append(scopes, "repository:"+from+":pull")
+	}
+	if r.authorize(w, req, scopes...) {
+		serve(w, req, name, arg)
+	}
+}
+
+func (r *Registry) serveBlob(w http.ResponseWriter, req *http.Request, name string, digest string) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		content, ok := r.Blob(name, digest)
+		if !ok {
+			writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+			return
+		}
+		if req.Method == http.MethodGet && r.storage != nil {
+			http.Redirect(w, req, r.storageLocation(name, digest), http.StatusTemporaryRedirect)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Docker-Content-Digest", digest)
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(content))
+	case http.MethodDelete:
+		if r.deletesDisabled {
+			writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "deletes are disabled")
+			return
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		repo := r.repo(name)
+		if _, ok := repo.blobs[digest]; !ok {
+			writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+			return
+		}
+		delete(repo.blobs, digest)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+func (r *Registry) serveUpload(w http.ResponseWriter, req *http.Request, name string, id string) {
+	if id == "" {
+		if req.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+			return
+		}
+		r.startUpload(w, req, name)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repo(name)
+	buf, ok := repo.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "blob upload unknown to registry")
+		return
+	}
+	location := "/v2/" + name + "/blobs/uploads/" + id
+
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Location", location)
+		w.Header().Set("Range", uploadRange(buf.Len()))
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPatch:
+		if cr := req.Header.Get("Content-Range"); cr != "" {
+			start, _, _ := strings.Cut(cr, "-")
+			if n, err := strconv.Atoi(start); err != nil || n != buf.Len() {
+				w.Header().Set("Location", location)
+				w.Header().Set("Range", uploadRange(buf.Len()))
+				writeError(w, http.StatusRequestedRangeNotSatisfiable, "BLOB_UPLOAD_INVALID", "chunk out of order")
+				return
+			}
+		}
+		if _, err := io.Copy(buf, req.Body); err != nil {
+			writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		w.Header().Set("Location", location)
+		w.Header().Set("Range", uploadRange(buf.Len()))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		if _, err := io.Copy(buf, req.Body); err != nil {
+			writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		digest := req.URL.Query().Get("digest")
+		if !digestMatches(digest, buf.Bytes()) {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "provided digest did not match uploaded content")
+			return
+		}
+		delete(repo.uploads, id)
+		repo.blobs[digest] = buf.Bytes()
+		w.Header().Set("Location", "/v2/"+name+"/blobs/"+digest)
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		delete(repo.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+// startUpload handles POST requests, which mount a blob, upload it in a
+// single request, or open an upload session.
+func (r *Registry) startUpload(w http.ResponseWriter, req *http.Request, name string) {
+	q := req.URL.Query()
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repo(name)
+	r.uploads++
+
+	if mount, from := q.Get("mount"), q.Get("from"); mount != "" && from != "" {
+		if source, ok := r.repos[from]; ok {
+			if content, ok := source.blobs[mount]; ok {
+				repo.blobs[mount] = content
+				w.Header().Set("Location", "/v2/"+name+"/blobs/"+mount)
+				w.Header().Set("Docker-Content-Digest", mount)
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+	} else if digest := q.Get("digest"); digest != "" {
+		if !digestMatches(digest, body) {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "provided digest did not match uploaded content")
+			return
+		}
+		repo.blobs[digest] = body
+		w.Header().Set("Location", "/v2/"+name+"/blobs/"+digest)
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	id := randomID()
+	repo.uploads[id] = bytes.NewBuffer(body)
+	w.Header().Set("Location", "/v2/"+name+"/blobs/uploads/"+id)
+	w.Header().Set("Range", uploadRange(len(body)))
+	w.Header().Set("Docker-Upload-UUID", id)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (r *Registry) serveManifest(w http.ResponseWriter, req *http.Request, name string, reference string) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		r.mu.Lock()
+		digest, m := r.manifest(name, reference)
+		r.mu.Unlock()
+		if m == nil {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown to registry")
+			return
+		}
+		w.Header().Set("Content-Type", m.MediaType)
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Content-Length", strconv.Itoa(len(m.Content)))
+		w.WriteHeader(http.StatusOK)
+		if req.Method == http.MethodGet {
+			w.Write(m.Content)
+		}
+	case http.MethodPut:
+		content, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		m, err := parseManifest(req.Header.Get("Content-Type"), content)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		if strings.Contains(reference, ":") {
+			if !digestMatches(reference, content) {
+				writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "provided digest did not match manifest")
+				return
+			}
+		} else if !tagMatcher.MatchString(reference) {
+			writeError(w, http.StatusBadRequest, "TAG_INVALID", "invalid tag")
+			return
+		}
+		r.mu.Lock()
+		digest := r.putManifest(name, reference, m)
+		r.mu.Unlock()
+		w.Header().Set("Location", "/v2/"+name+"/manifests/"+digest)
+		w.Header().Set("Docker-Content-Digest", digest)
+		if m.Subject != "" && !r.referrersDisabled {
+			w.Header().Set("OCI-Subject", m.Subject)
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if r.deletesDisabled {
+			writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "deletes are disabled")
+			return
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		repo := r.repo(name)
+		if !strings.Contains(reference, ":") {
+			if r.tagDeletesDisabled {
+				writeError(w, http.StatusBadRequest, "UNSUPPORTED", "manifests can only be deleted by digest")
+				return
+			}
+			if _, ok := repo.tags[reference]; !ok {
+				writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown to registry")
+				return
+			}
+			delete(repo.tags, reference)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if _, ok := repo.manifests[reference]; !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown to registry")
+			return
+		}
+		delete(repo.manifests, reference)
+		for tag, digest := range repo.tags {
+			if digest == reference {
+				delete(repo.tags, tag)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+func (r *Registry) serveTags(w http.ResponseWriter, req *http.Request, name string, _ string) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+		return
+	}
+	r.mu.Lock()
+	repo, ok := r.repos[name]
+	var tags []string
+	if ok {
+		tags = sortedKeys(repo.tags)
+	}
+	r.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return
+	}
+	tags, next := paginate(tags, req.URL.Query())
+	if next != "" {
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?%s>; rel="next"`, name, next))
+	}
+	writeJSON(w, "application/json", map[string]interface{}{"name": name, "tags": tags})
+}
+
+func (r *Registry) serveCatalog(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	var names []string
+	for name, repo := range r.repos {
+		if len(repo.manifests) > 0 || len(repo.blobs) > 0 {
+			names = append(names, name)
+		}
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+	names, next := paginate(names, req.URL.Query())
+	if next != "" {
+		w.Header().Set("Link", fmt.Sprintf(`</v2/_catalog?%s>; rel="next"`, next))
+	}
+	writeJSON(w, "application/json", map[string]interface{}{"repositories": names})
+}
+
+func (r *Registry) serveExtensions(w http.ResponseWriter, req *http.Request, name string, arg string) {
+	if r.extensions == nil {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		return
+	}
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+		return
+	}
+	writeJSON(w, "application/json", map[string]interface{}{"extensions": r.extensions})
+}
+
+func (r *Registry) serveReferrers(w http.ResponseWriter, req *http.Request, name string, digest string) {
+	if r.referrersDisabled {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		return
+	}
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+		return
+	}
+	artifactType := req.URL.Query().Get("artifactType")
+	manifests := []Descriptor{}
+	r.mu.Lock()
+	if repo, ok := r.repos[name]; ok {
+		for _, d := range sortedKeys(repo.manifests) {
+			m := repo.manifests[d]
+			if m.Subject != digest || artifactType != "" && m.ArtifactType != artifactType {
+				continue
+			}
+			manifests = append(manifests, Descriptor{
+				MediaType:    m.MediaType,
+				ArtifactType: m.ArtifactType,
+				Digest:       d,
+				Size:         int64(len(m.Content)),
+				Annotations:  m.Annotations,
+			})
+		}
+	}
+	r.mu.Unlock()
+	if artifactType != "" {
+		w.Header().Set("OCI-Filters-Applied", "artifactType")
+	}
+	writeJSON(w, MediaTypeImageIndex, map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     MediaTypeImageIndex,
+		"manifests":     manifests,
+	})
+}
+
+// repo returns a repository, creating it if needed. r.mu must be held.
+func (r *Registry) repo(name string) *repository {
+	repo, ok := r.repos[name]
+	if !ok {
+		repo = &repository{
+			blobs:     map[string][]byte{},
+			manifests: map[string]*Manifest{},
+			tags:      map[string]string{},
+			uploads:   map[string]*bytes.Buffer{},
+		}
+		r.repos[name] = repo
+	}
+	return repo
+}
+
+// manifest returns a manifest and its digest by tag or digest. r.mu must be held.
+func (r *Registry) manifest(name string, reference string) (string, *Manifest) {
+	repo, ok := r.repos[name]
+	if !ok {
+		return "", nil
+	}
+	digest := reference
+	if d, ok := repo.tags[reference]; ok {
+		digest = d
+	}
+	return digest, repo.manifests[digest]
+}
+
+// putManifest stores a manifest. r.mu must be held.
+func (r *Registry) putManifest(name string, reference string, m *Manifest) string {
+	digest := reference
+	if !strings.Contains(reference, ":") {
+		digest = sha256Digest(m.Content)
+	}
+	repo := r.repo(name)
+	repo.manifests[digest] = m
+	if digest != reference {
+		repo.tags[reference] = digest
+	}
+	return digest
+}
+
+func parseManifest(mediaType string, content []byte) (*Manifest, error) {
+	var fields manifestFields
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	m := &Manifest{
+		MediaType:    fields.MediaType,
+		ArtifactType: fields.ArtifactType,
+		Content:      append([]byte{}, content...),
+		Annotations:  fields.Annotations,
+	}
+	if mediaType != "" {
+		m.MediaType = mediaType
+	}
+	if m.MediaType == "" {
+		return nil, fmt.Errorf("manifest has no media type")
+	}
+	if m.ArtifactType == "" && fields.Config != nil {
+		m.ArtifactType = fields.Config.MediaType
+	}
+	if fields.Subject != nil {
+		m.Subject = fields.Subject.Digest
+	}
+	return m, nil
+}
+
+// paginate applies the n and last query parameters to a sorted list,
+// returning the page and the query of the next page, if any.
+func paginate(items []string, q url.Values) ([]string, string) {
+	if last := q.Get("last"); last != "" {
+		i := sort.SearchStrings(items, last)
+		if i < len(items) && items[i] == last {
+			i++
+		}
+		items = items[i:]
+	}
+	n, err := strconv.Atoi(q.Get("n"))
+	if err != nil || n < 0 || n >= len(items) {
+		return items, ""
+	}
+	page := items[:n]
+	if n == 0 {
+		return page, ""
+	}
+	next := url.Values{"n": {strconv.Itoa(n)}, "last": {page[n-1]}}
+	return page, next.Encode()
+}
+
+func action(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return "pull"
+	case http.MethodDelete:
+		return "delete"
+	}
+	return "pull,push"
+}
+
+func uploadRange(size int) string {
+	end := size
+	if end > 0 {
+		end--
+	}
+	return fmt.Sprintf("0-%d", end)
+}
+
+func sha256Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func digestMatches(digest string, content []byte) bool {
+	algorithm, encoded, _ := strings.Cut(digest, ":")
+	var h hash.Hash
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return false
+	}
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil)) == encoded
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeJSON(w http.ResponseWriter, contentType string, v interface{}) {
+	body, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	body, _ := json.Marshal(map[string][]errorInfo{"errors": {{Code: code, Message: message}}})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,227 @@
+package reggietest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/bloodorangeio/reggie"
+	"github.com/bloodorangeio/reggie/reggietest"
+)
+
+const (
+	mediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+)
+
+func TestRegistryBlobs(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithTokenAuth("user", "pass"))
+	defer registry.Close()
+
+	client, err := reggie.NewClient(registry.URL, reggie.WithUsernamePassword("user", "pass"))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	ctx := context.Background()
+
+	for _, chunkSize := range []int{0, 3} {
+		content := []byte(fmt.Sprintf("blob pushed in chunks of %d", chunkSize))
+		desc := reggie.Descriptor{Digest: reggie.DigestFromBytes(content), Size: int64(len(content))}
+		err := client.PushBlob(ctx, "a/b", desc, func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(content)), nil
+		}, reggie.WithChunkSize(chunkSize))
+		if err != nil {
+			t.Fatalf("Errors pushing blob: %s", err)
+		}
+		if stored, ok := registry.Blob("a/b", desc.Digest); !ok || !bytes.Equal(stored, content) {
+			t.Fatalf("Expected registry to store %q but got %q", content, stored)
+		}
+
+		var buf bytes.Buffer
+		if err := client.PullBlob(ctx, "a/b", desc, &buf); err != nil {
+			t.Fatalf("Errors pulling blob: %s", err)
+		}
+		if !bytes.Equal(buf.Bytes(), content) {
+			t.Fatalf("Expected to pull %q but got %q", content, buf.Bytes())
+		}
+	}
+
+	// mounting requires pull access to the source repository
+	content := []byte("mounted")
+	digest := registry.PutBlob("source", content)
+	desc := reggie.Descriptor{Digest: digest, Size: int64(len(content))}
+	uploads := registry.Uploads()
+	err = client.PushBlob(ctx, "target", desc, func() (io.ReadCloser, error) {
+		t.Fatalf("Expected blob to be mounted rather than uploaded")
+		return nil, nil
+	}, reggie.WithMountFrom("source"))
+	if err != nil {
+		t.Fatalf("Errors mounting blob: %s", err)
+	}
+	if _, ok := registry.Blob("target", digest); !ok || registry.Uploads() != uploads+1 {
+		t.Fatalf("Expected blob to be mounted")
+	}
+
+	// digests are verified
+	resp, err := client.Do(client.NewRequest(reggie.POST, "/v2/<name>/blobs/uploads/", reggie.WithName("a")).
+		SetQueryParam("digest", reggie.DigestFromBytes([]byte("other"))).
+		SetBody(content))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if resp.StatusCode() != http.StatusBadRequest {
+		t.Fatalf("Expected digest mismatch to be rejected but got %d", resp.StatusCode())
+	}
+
+	resp, err = client.Do(client.NewRequest(reggie.DELETE, "/v2/<name>/blobs/<digest>",
+		reggie.WithName("target"), reggie.WithDigest(digest)))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if resp.StatusCode() != http.StatusAccepted {
+		t.Fatalf("Expected blob to be deleted but got %d", resp.StatusCode())
+	}
+	if exists, err := client.BlobExists(ctx, "target", digest); err != nil || exists {
+		t.Fatalf("Expected deleted blob to be missing: %v, %v", exists, err)
+	}
+}
+
+func TestRegistryManifests(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithBasicAuth("user", "pass"))
+	defer registry.Close()
+
+	client, err := reggie.NewClient(registry.URL,
+		reggie.WithUsernamePassword("user", "pass"),
+		reggie.WithDefaultName("a"))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	subject := []byte(`{"schemaVersion": 2, "mediaType": "` + mediaTypeManifest + `", "config": {"mediaType": "application/vnd.oci.image.config.v1+json"}}`)
+	putManifest := func(reference string, content []byte) string {
+		t.Helper()
+		resp, err := client.Do(client.NewRequest(reggie.PUT, "/v2/<name>/manifests/<reference>", reggie.WithReference(reference)).
+			SetHeader("Content-Type", mediaTypeManifest).
+			SetBody(content))
+		if err != nil {
+			t.Fatalf("Errors executing request: %s", err)
+		}
+		if resp.StatusCode() != http.StatusCreated {
+			t.Fatalf("Expected manifest to be created but got %d", resp.StatusCode())
+		}
+		return resp.Header().Get("Docker-Content-Digest")
+	}
+	subjectDigest := putManifest("v1", subject)
+	if subjectDigest != reggie.DigestFromBytes(subject) {
+		t.Fatalf("Unexpected manifest digest %s", subjectDigest)
+	}
+	for _, tag := range []string{"v2", "v3", "latest"} {
+		putManifest(tag, subject)
+	}
+
+	resp, err := client.Do(client.NewRequest(reggie.GET, "/v2/<name>/manifests/<reference>", reggie.WithReference(subjectDigest)))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if !bytes.Equal(resp.Body(), subject) || resp.Header().Get("Content-Type") != mediaTypeManifest {
+		t.Fatalf("Unexpected manifest %s of type %s", resp.Body(), resp.Header().Get("Content-Type"))
+	}
+
+	// tags are listed in pages
+	resp, err = client.Do(client.NewRequest(reggie.GET, "/v2/<name>/tags/list").SetQueryParam("n", "2"))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	var tags struct{ Tags []string }
+	json.Unmarshal(resp.Body(), &tags)
+	if fmt.Sprint(tags.Tags) != "[latest v1]" || resp.Header().Get("Link") != `</v2/a/tags/list?last=v1&n=2>; rel="next"` {
+		t.Fatalf("Unexpected first page of tags %v with link %q", tags.Tags, resp.Header().Get("Link"))
+	}
+
+	// referrers are found by subject and filtered by artifact type
+	signature := []byte(`{"schemaVersion": 2, "mediaType": "` + mediaTypeManifest + `", "artifactType": "application/vnd.example.signature",` +
+		`"subject": {"mediaType": "` + mediaTypeManifest + `", "digest": "` + subjectDigest + `", "size": 1}}`)
+	signatureDigest := putManifest(reggie.DigestFromBytes(signature), signature)
+	resp, err = client.Do(client.NewRequest(reggie.GET, "/v2/<name>/referrers/<digest>", reggie.WithDigest(subjectDigest)).
+		SetQueryParam("artifactType", "application/vnd.example.signature"))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	var index struct{ Manifests []reggietest.Descriptor }
+	json.Unmarshal(resp.Body(), &index)
+	if len(index.Manifests) != 1 || index.Manifests[0].Digest != signatureDigest ||
+		resp.Header().Get("OCI-Filters-Applied") != "artifactType" {
+		t.Fatalf("Unexpected referrers %s", resp.Body())
+	}
+
+	// deleting a tag leaves the manifest, deleting a digest removes its tags
+	for _, reference := range []string{"latest", subjectDigest} {
+		resp, err = client.Do(client.NewRequest(reggie.DELETE, "/v2/<name>/manifests/<reference>", reggie.WithReference(reference)))
+		if err != nil {
+			t.Fatalf("Errors executing request: %s", err)
+		}
+		if resp.StatusCode() != http.StatusAccepted {
+			t.Fatalf("Expected %s to be deleted but got %d", reference, resp.StatusCode())
+		}
+		if reference == "latest" {
+			if _, ok := registry.Manifest("a", subjectDigest); !ok {
+				t.Fatalf("Expected manifest to remain after deleting tag")
+			}
+		}
+	}
+	if tags := registry.Tags("a"); len(tags) != 0 {
+		t.Fatalf("Expected tags to be deleted with manifest but got %v", tags)
+	}
+
+	resp, err = client.Do(client.NewRequest(reggie.GET, "/v2/_catalog"))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if string(resp.Body()) != `{"repositories":["a"]}` {
+		t.Fatalf("Unexpected catalog %s", resp.Body())
+	}
+}
+
+func TestRegistryOptions(t *testing.T) {
+	registry := reggietest.NewRegistry(reggietest.WithDeletesDisabled(), reggietest.WithoutReferrersAPI())
+	defer registry.Close()
+
+	client, err := reggie.NewClient(registry.URL, reggie.WithDefaultName("a"))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	digest, err := registry.PutManifest("a", "v1", mediaTypeManifest, []byte(`{"schemaVersion": 2}`))
+	if err != nil {
+		t.Fatalf("Errors storing manifest: %s", err)
+	}
+
+	resp, err := client.Do(client.NewRequest(reggie.DELETE, "/v2/<name>/manifests/<reference>", reggie.WithReference(digest)))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if resp.StatusCode() != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected delete to be rejected but got %d", resp.StatusCode())
+	}
+
+	resp, err = client.Do(client.NewRequest(reggie.GET, "/v2/<name>/referrers/<digest>", reggie.WithDigest(digest)))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if resp.StatusCode() != http.StatusNotFound {
+		t.Fatalf("Expected referrers API to be missing but got %d", resp.StatusCode())
+	}
+
+	// credentials are required by the token server when configured
+	tokenRegistry := reggietest.NewRegistry(reggietest.WithTokenAuth("user", "pass"))
+	defer tokenRegistry.Close()
+	client, err = reggie.NewClient(tokenRegistry.URL, reggie.WithUsernamePassword("user", "wrong"))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	if _, err := client.BlobExists(context.Background(), "a", digest); err == nil {
+		t.Fatalf("Expected error with invalid credentials")
+	}
+}
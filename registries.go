@@ -0,0 +1,335 @@
+package reggie
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	// DefaultRegistriesConfPath is the system-wide containers-registries.conf(5) file.
+	DefaultRegistriesConfPath = "/etc/containers/registries.conf"
+
+	// ShortNameModeEnforcing refuses to resolve short names matching more
+	// than one unqualified-search registry.
+	ShortNameModeEnforcing = "enforcing"
+
+	// ShortNameModePermissive resolves short names matching more than one
+	// unqualified-search registry to each of them in order, as containers
+	// tools do when they cannot prompt for a choice.
+	ShortNameModePermissive = "permissive"
+
+	// ShortNameModeDisabled turns off short-name checks, so short names
+	// resolve to each unqualified-search registry in order without ever
+	// being treated as ambiguous.
+	ShortNameModeDisabled = "disabled"
+)
+
+var (
+	// ErrRegistryBlocked is returned when resolving a repository on a
+	// registry marked as blocked.
+	ErrRegistryBlocked = errors.New("registry is blocked")
+
+	// DefaultCertsDirs are the Docker-style certs directories applied to
+	// clients built from a RegistriesConf.
+	DefaultCertsDirs = []string{"/etc/containers/certs.d", "/etc/docker/certs.d"}
+)
+
+type (
+	// RegistriesConf is a containers-registries.conf(5) configuration, in the
+	// v2 (TOML) format used by podman, buildah and skopeo.
+	RegistriesConf struct {
+		UnqualifiedSearchRegistries []string          `toml:"unqualified-search-registries"`
+		ShortNameMode               string            `toml:"short-name-mode"`
+		Registries                  []RegistryConf    `toml:"registry"`
+		Aliases                     map[string]string `toml:"aliases"`
+	}
+
+	// RegistryConf is a [[registry]] table of a RegistriesConf.
+	RegistryConf struct {
+		Prefix             string       `toml:"prefix"`
+		Location           string       `toml:"location"`
+		Insecure           bool         `toml:"insecure"`
+		Blocked            bool         `toml:"blocked"`
+		MirrorByDigestOnly bool         `toml:"mirror-by-digest-only"`
+		Mirrors            []MirrorConf `toml:"mirror"`
+	}
+
+	// MirrorConf is a [[registry.mirror]] table of a RegistriesConf.
+	MirrorConf struct {
+		Location       string `toml:"location"`
+		Insecure       bool   `toml:"insecure"`
+		PullFromMirror string `toml:"pull-from-mirror"`
+	}
+
+	// ResolvedRepository describes how to reach a repository according to a
+	// RegistriesConf.
+	ResolvedRepository struct {
+		// Address is the URL of the registry serving the repository.
+		Address string
+
+		// Repository is the name of the repository at Address.
+		Repository string
+
+		// Options configure a client for the registry, e.g. its mirrors
+		// and TLS settings.
+		Options []clientOption
+
+		// Prefix is the prefix of the [[registry]] table which matched the
+		// repository, if any.
+		Prefix string
+	}
+)
+
+// LoadRegistriesConf loads a registries.conf file along with the drop-in
+// files ending in ".conf" in the directory of the same name suffixed with
+// ".d" (e.g. /etc/containers/registries.conf.d), in lexical order. Settings
+// in a drop-in replace those loaded before it, with [[registry]] tables
+// replaced by prefix and aliases by name. Missing files are ignored.
+func LoadRegistriesConf(path string) (*RegistriesConf, error) {
+	conf := &RegistriesConf{Aliases: map[string]string{}}
+	if err := conf.merge(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	dropIns, err := filepath.Glob(filepath.Join(path+".d", "*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dropIns)
+	for _, dropIn := range dropIns {
+		if err := conf.merge(dropIn); err != nil {
+			return nil, err
+		}
+	}
+	return conf, nil
+}
+
+// ParseRegistriesConf parses the content of a registries.conf file.
+func ParseRegistriesConf(data []byte) (*RegistriesConf, error) {
+	conf := &RegistriesConf{Aliases: map[string]string{}}
+	if err := conf.mergeData(data, "registries.conf"); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// merge reads the file at path and merges its settings into conf.
+func (conf *RegistriesConf) merge(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return conf.mergeData(data, path)
+}
+
+func (conf *RegistriesConf) mergeData(data []byte, source string) error {
+	var raw map[string]interface{}
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		return fmt.Errorf("parsing %s: %w", source, err)
+	}
+	if _, ok := raw["registries"]; ok {
+		return fmt.Errorf("parsing %s: the v1 registries.conf format is not supported", source)
+	}
+
+	var file RegistriesConf
+	md, err := toml.Decode(string(data), &file)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", source, err)
+	}
+	if md.IsDefined("unqualified-search-registries") {
+		conf.UnqualifiedSearchRegistries = file.UnqualifiedSearchRegistries
+	}
+	if md.IsDefined("short-name-mode") {
+		switch file.ShortNameMode {
+		case ShortNameModeEnforcing, ShortNameModePermissive, ShortNameModeDisabled:
+		default:
+			return fmt.Errorf("parsing %s: invalid short-name-mode %q", source, file.ShortNameMode)
+		}
+		conf.ShortNameMode = file.ShortNameMode
+	}
+	for name, alias := range file.Aliases {
+		conf.Aliases[name] = alias
+	}
+	for _, reg := range file.Registries {
+		if reg.Prefix == "" {
+			reg.Prefix = reg.Location
+		}
+		if reg.Prefix == "" {
+			return fmt.Errorf("parsing %s: [[registry]] requires a prefix or location", source)
+		}
+		if strings.HasPrefix(reg.Prefix, "*.") && reg.Location != "" {
+			return fmt.Errorf("parsing %s: wildcard prefix %s cannot have a location", source, reg.Prefix)
+		}
+		replaced := false
+		for i := range conf.Registries {
+			if conf.Registries[i].Prefix == reg.Prefix {
+				conf.Registries[i] = reg
+				replaced = true
+			}
+		}
+		if !replaced {
+			conf.Registries = append(conf.Registries, reg)
+		}
+	}
+	return nil
+}
+
+// FindRegistry returns the [[registry]] table with the longest prefix
+// matching name (a registry host followed by a repository), or nil.
+func (conf *RegistriesConf) FindRegistry(name string) *RegistryConf {
+	var match *RegistryConf
+	for i := range conf.Registries {
+		reg := &conf.Registries[i]
+		if !prefixMatches(reg.Prefix, name) {
+			continue
+		}
+		if match == nil || len(reg.Prefix) > len(match.Prefix) {
+			match = reg
+		}
+	}
+	return match
+}
+
+// prefixMatches returns whether a registry prefix matches name on component
+// boundaries. Wildcard prefixes ("*.example.com") match subdomains.
+func prefixMatches(prefix string, name string) bool {
+	if strings.HasPrefix(prefix, "*.") {
+		host, _, _ := strings.Cut(name, "/")
+		return strings.HasSuffix(host, prefix[1:])
+	}
+	return name == prefix || strings.HasPrefix(name, prefix+"/")
+}
+
+// ResolveShortName returns the fully-qualified candidates for a repository
+// name, in the order they should be tried. Qualified names are returned as
+// is, while short names resolve to their alias or to each of the
+// unqualified-search registries.
+func (conf *RegistriesConf) ResolveShortName(name string) ([]string, error) {
+	ref, err := ParseReference(name)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Registry != "" {
+		return []string{ref.Name()}, nil
+	}
+	if alias, ok := conf.Aliases[ref.Repository]; ok {
+		return []string{alias}, nil
+	}
+	if len(conf.UnqualifiedSearchRegistries) == 0 {
+		return nil, fmt.Errorf("short name %q has no alias and no unqualified-search registries are configured", name)
+	}
+	if conf.ShortNameMode == ShortNameModeEnforcing && len(conf.UnqualifiedSearchRegistries) > 1 {
+		return nil, fmt.Errorf("short name %q is ambiguous in enforcing mode: add an alias or use a fully-qualified name", name)
+	}
+	candidates := make([]string, 0, len(conf.UnqualifiedSearchRegistries))
+	for _, registry := range conf.UnqualifiedSearchRegistries {
+		candidates = append(candidates, registry+"/"+ref.Repository)
+	}
+	return candidates, nil
+}
+
+// Resolve returns where the repository of a reference is served, and the
+// client options needed to reach it. Short names are resolved to their first
+// candidate. An error wrapping ErrRegistryBlocked is returned if the
+// registry is blocked.
+func (conf *RegistriesConf) Resolve(name string) (*ResolvedRepository, error) {
+	candidates, err := conf.ResolveShortName(name)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := ParseReference(candidates[0])
+	if err != nil {
+		return nil, err
+	}
+	if ref.Registry == "" {
+		return nil, fmt.Errorf("alias for %q is not fully qualified", name)
+	}
+	if ref.Registry == "docker.io" && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	qualified := ref.Name()
+
+	resolved := &ResolvedRepository{}
+	location := qualified
+	reg := conf.FindRegistry(qualified)
+	if reg != nil {
+		if reg.Blocked {
+			return nil, fmt.Errorf("%s: %w", qualified, ErrRegistryBlocked)
+		}
+		if reg.Location != "" {
+			location = reg.Location + strings.TrimPrefix(qualified, reg.Prefix)
+		}
+	}
+	host, repository, _ := strings.Cut(location, "/")
+	resolved.Address = "https://" + registryAPIHost(host)
+	resolved.Repository = repository
+	for _, dir := range DefaultCertsDirs {
+		resolved.Options = append(resolved.Options, WithCertsDir(dir))
+	}
+	if reg == nil {
+		return resolved, nil
+	}
+	resolved.Prefix = reg.Prefix
+
+	if reg.Insecure {
+		resolved.Options = append(resolved.Options, WithInsecureSkipTLSVerify(true))
+	}
+
+	// a mirror replaces the part of the repository name matched by the
+	// prefix, which is served under the location's namespace on the registry
+	namespace := ""
+	if reg.Location != "" {
+		_, namespace, _ = strings.Cut(reg.Location, "/")
+	} else if !strings.HasPrefix(reg.Prefix, "*.") {
+		_, namespace, _ = strings.Cut(reg.Prefix, "/")
+	}
+	var mirrors []Mirror
+	for _, m := range reg.Mirrors {
+		pull := m.PullFromMirror
+		if pull == "" && reg.MirrorByDigestOnly {
+			pull = PullFromMirrorDigestOnly
+		}
+		mirrorHost, mirrorNamespace, _ := strings.Cut(m.Location, "/")
+		loc := "https://" + registryAPIHost(mirrorHost)
+		if mirrorNamespace != "" {
+			loc += "/" + mirrorNamespace
+		}
+		mirrors = append(mirrors, Mirror{
+			Location:       loc,
+			Insecure:       m.Insecure,
+			PullFromMirror: pull,
+			ReplacePrefix:  namespace,
+		})
+	}
+	if len(mirrors) > 0 {
+		resolved.Options = append(resolved.Options, WithMirrors(mirrors...))
+	}
+	return resolved, nil
+}
+
+// NewClient builds a new Client for the repository of a reference, set as
+// the client's default name, configured according to conf. Additional
+// options are applied after those from conf.
+func (conf *RegistriesConf) NewClient(name string, opts ...clientOption) (*Client, error) {
+	resolved, err := conf.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	options := append(resolved.Options, WithDefaultName(resolved.Repository))
+	return NewClient(resolved.Address, append(options, opts...)...)
+}
+
+// registryAPIHost returns the host serving the registry API for a registry
+// name, which differs from the name for Docker Hub.
+func registryAPIHost(host string) string {
+	if host == "docker.io" {
+		return "registry-1.docker.io"
+	}
+	return host
+}
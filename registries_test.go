@@ -0,0 +1,213 @@
+package reggie
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testRegistriesConf = `
+unqualified-search-registries = ["registry.fedoraproject.org", "docker.io"]
+short-name-mode = "enforcing"
+
+[aliases]
+"fedora" = "registry.fedoraproject.org/fedora"
+
+[[registry]]
+prefix = "docker.io/library"
+mirror-by-digest-only = true
+
+[[registry.mirror]]
+location = "mirror.internal/dockerhub-library"
+
+[[registry.mirror]]
+location = "tags.internal"
+pull-from-mirror = "tag-only"
+insecure = true
+
+[[registry]]
+prefix = "quay.io/bad"
+blocked = true
+
+[[registry]]
+prefix = "internal.io/team"
+location = "registry.internal:5000/teams/team"
+insecure = true
+
+[[registry]]
+prefix = "*.corp.io"
+`
+
+func TestLoadRegistriesConf(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "registries.conf")
+	if err := os.WriteFile(path, []byte(testRegistriesConf), 0644); err != nil {
+		t.Fatalf("Errors writing file: %s", err)
+	}
+	if err := os.MkdirAll(path+".d", 0755); err != nil {
+		t.Fatalf("Errors creating directory: %s", err)
+	}
+	dropIns := map[string]string{
+		"10-search.conf": `unqualified-search-registries = ["quay.io"]`,
+		"20-alias.conf": `
+[aliases]
+"myapp" = "internal.io/team/myapp"
+`,
+		"30-unblock.conf": `
+[[registry]]
+prefix = "quay.io/bad"
+`,
+		"ignored.txt": `not = [toml`,
+	}
+	for name, content := range dropIns {
+		if err := os.WriteFile(filepath.Join(path+".d", name), []byte(content), 0644); err != nil {
+			t.Fatalf("Errors writing file: %s", err)
+		}
+	}
+
+	conf, err := LoadRegistriesConf(path)
+	if err != nil {
+		t.Fatalf("Errors loading registries.conf: %s", err)
+	}
+	if s := strings.Join(conf.UnqualifiedSearchRegistries, ","); s != "quay.io" {
+		t.Fatalf("Expected drop-in to replace search registries but got %s", s)
+	}
+	if conf.ShortNameMode != ShortNameModeEnforcing {
+		t.Fatalf("Expected short-name-mode to be kept but got %s", conf.ShortNameMode)
+	}
+	if len(conf.Aliases) != 2 {
+		t.Fatalf("Expected aliases to be merged but got %v", conf.Aliases)
+	}
+	if reg := conf.FindRegistry("quay.io/bad/app"); reg == nil || reg.Blocked {
+		t.Fatalf("Expected drop-in to replace registry with the same prefix")
+	}
+	if len(conf.Registries) != 4 {
+		t.Fatalf("Expected 4 registries but got %d", len(conf.Registries))
+	}
+
+	if _, err := LoadRegistriesConf(filepath.Join(dir, "missing.conf")); err != nil {
+		t.Fatalf("Expected missing file to be ignored but got %s", err)
+	}
+}
+
+func TestRegistriesConfResolve(t *testing.T) {
+	conf, err := ParseRegistriesConf([]byte(testRegistriesConf))
+	if err != nil {
+		t.Fatalf("Errors parsing registries.conf: %s", err)
+	}
+
+	// short names
+	if c, err := conf.ResolveShortName("fedora:39"); err != nil || strings.Join(c, ",") != "registry.fedoraproject.org/fedora" {
+		t.Fatalf("Expected alias but got %v (%v)", c, err)
+	}
+	if _, err := conf.ResolveShortName("alpine"); err == nil {
+		t.Fatalf("Expected ambiguous short name error in enforcing mode")
+	}
+	conf.ShortNameMode = ShortNameModePermissive
+	if c, _ := conf.ResolveShortName("alpine"); strings.Join(c, ",") != "registry.fedoraproject.org/alpine,docker.io/alpine" {
+		t.Fatalf("Unexpected candidates: %v", c)
+	}
+
+	// blocked registries
+	if _, err := conf.Resolve("quay.io/bad/app"); !errors.Is(err, ErrRegistryBlocked) {
+		t.Fatalf("Expected blocked registry error but got %v", err)
+	}
+	if _, err := conf.NewClient("quay.io/bad/app"); !errors.Is(err, ErrRegistryBlocked) {
+		t.Fatalf("Expected blocked registry error but got %v", err)
+	}
+
+	// location rewriting and insecure registries
+	client, err := conf.NewClient("internal.io/team/app:v1")
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	if client.Config.Address != "https://registry.internal:5000" || client.Config.DefaultName != "teams/team/app" {
+		t.Fatalf("Unexpected address %s and name %s", client.Config.Address, client.Config.DefaultName)
+	}
+	if !client.Config.InsecureSkipTLSVerify {
+		t.Fatalf("Expected insecure registry to skip TLS verification")
+	}
+
+	// wildcard prefixes and unconfigured registries
+	for _, name := range []string{"a.corp.io/app", "ghcr.io/org/app"} {
+		r, err := conf.Resolve(name)
+		if err != nil {
+			t.Fatalf("Errors resolving %s: %s", name, err)
+		}
+		host, repo, _ := strings.Cut(name, "/")
+		if r.Address != "https://"+host || r.Repository != repo {
+			t.Fatalf("Unexpected resolution for %s: %+v", name, r)
+		}
+	}
+
+	// Docker Hub with mirrors
+	client, err = conf.NewClient("docker.io/alpine")
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	if client.Config.Address != "https://registry-1.docker.io" || client.Config.DefaultName != "library/alpine" {
+		t.Fatalf("Unexpected address %s and name %s", client.Config.Address, client.Config.DefaultName)
+	}
+	mirrors := client.Config.Mirrors
+	if len(mirrors) != 2 {
+		t.Fatalf("Expected 2 mirrors but got %d", len(mirrors))
+	}
+	if m := mirrors[0]; m.Location != "https://mirror.internal/dockerhub-library" || m.PullFromMirror != PullFromMirrorDigestOnly {
+		t.Fatalf("Unexpected mirror: %+v", m)
+	}
+	if m := mirrors[1]; m.PullFromMirror != PullFromMirrorTagOnly || !m.Insecure {
+		t.Fatalf("Unexpected mirror: %+v", m)
+	}
+
+	if _, err := ParseRegistriesConf([]byte("[registries.search]\nregistries = []")); err == nil {
+		t.Fatalf("Expected error for v1 format")
+	}
+	if _, err := ParseRegistriesConf([]byte(`short-name-mode = "sometimes"`)); err == nil {
+		t.Fatalf("Expected error for invalid short-name-mode")
+	}
+}
+
+func TestRegistriesConfMirrorRewrite(t *testing.T) {
+	var mirrored string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrored = r.URL.Path
+	}))
+	defer mirror.Close()
+	mirrorHost := strings.TrimPrefix(mirror.URL, "http://")
+
+	conf, err := ParseRegistriesConf([]byte(`
+[[registry]]
+prefix = "docker.io/library"
+
+[[registry.mirror]]
+location = "` + mirrorHost + `/lib"
+`))
+	if err != nil {
+		t.Fatalf("Errors parsing registries.conf: %s", err)
+	}
+	client, err := conf.NewClient("docker.io/alpine")
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	m := client.Config.Mirrors[0]
+	if m.Location != "https://"+mirrorHost+"/lib" || m.ReplacePrefix != "library" {
+		t.Fatalf("Unexpected mirror: %+v", m)
+	}
+
+	// the test mirror only speaks plain HTTP
+	m.Location = mirror.URL + "/lib"
+	client, err = NewClient(client.Config.Address, WithDefaultName(client.Config.DefaultName), WithMirrors(m))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	if _, err := client.Do(client.NewRequest(GET, "/v2/<name>/tags/list")); err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if mirrored != "/v2/lib/alpine/tags/list" {
+		t.Fatalf("Expected mirror namespace to replace prefix but got %s", mirrored)
+	}
+}
@@ -18,6 +18,15 @@ type (
 	Request struct {
 		*resty.Request
 		retryCallback RetryCallbackFunc
+		attempts      int
+
+		// mirror is the mirror the request is being sent to, whose
+		// credentials answer its auth challenges instead of the client's
+		mirror *mirrorEndpoint
+
+		// err is an error building the request, returned when it is
+		// executed
+		err error
 	}
 
 	requestConfig struct {
@@ -25,6 +34,7 @@ type (
 		Reference     string
 		Digest        string
 		SessionID     string
+		Params        map[string]string
 		RetryCallback RetryCallbackFunc
 	}
 
@@ -89,6 +99,15 @@ func (req *Request) SetHeader(header, content string) *Request {
 	return req
 }
 
+// SetContext wraps the resty SetContext and returns the request, allowing method chaining
+func (req *Request) SetContext(ctx context.Context) *Request {
+	if v := req.Request.Context().Value(contextKeyAcceptHeader); v != nil {
+		ctx = context.WithValue(ctx, contextKeyAcceptHeader, v)
+	}
+	req.Request.SetContext(ctx)
+	return req
+}
+
 // SetQueryParam wraps the resty SetQueryParam and returns the request, allowing method chaining
 func (req *Request) SetQueryParam(param, content string) *Request {
 	req.Request.SetQueryParam(param, content)
@@ -97,6 +116,9 @@ func (req *Request) SetQueryParam(param, content string) *Request {
 
 // Execute validates a Request and executes it.
 func (req *Request) Execute(method, url string) (*Response, error) {
+	if req.err != nil {
+		return nil, req.err
+	}
 	err := validateRequest(req)
 	if err != nil {
 		return nil, err
@@ -107,15 +129,26 @@ func (req *Request) Execute(method, url string) (*Response, error) {
 		return nil, err
 	}
 
-	resp := &Response{restyResponse}
+	resp := &Response{Response: restyResponse}
 	return resp, err
 }
 
+// retries returns how many times a request was retried, e.g. with auth or
+// against another endpoint.
+func (req *Request) retries() int {
+	if req.attempts < 1 {
+		return 0
+	}
+	return req.attempts - 1
+}
+
 func validateRequest(req *Request) error {
-	re := regexp.MustCompile("<name>|<reference>|<digest>|<session_id>|//{2,}")
-	matches := re.FindAllString(req.URL, -1)
-	if len(matches) == 0 {
-		return nil
+	if m := placeholderMatcher.FindStringSubmatch(req.URL); m != nil {
+		return fmt.Errorf("request is invalid: missing value for placeholder <%s>", m[1])
+	}
+	re := regexp.MustCompile("//{2,}")
+	if re.MatchString(req.URL) {
+		return fmt.Errorf("request is invalid")
 	}
-	return fmt.Errorf("request is invalid")
+	return nil
 }
@@ -13,6 +13,7 @@ type (
 	// Response is an HTTP response returned from an OCI registry.
 	Response struct {
 		*resty.Response
+		endpoint string
 	}
 )
 
@@ -44,6 +45,22 @@ func (resp *Response) GetAbsoluteLocation() string {
 	return loc
 }
 
+// Endpoint returns the base URL of the endpoint which served the response,
+// such as the registry itself or one of its mirrors.
+func (resp *Response) Endpoint() string {
+	if resp.endpoint != "" {
+		return resp.endpoint
+	}
+	if resp.Request == nil {
+		return ""
+	}
+	u, err := url.Parse(resp.Request.URL)
+	if err != nil {
+		return ""
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+}
+
 // IsUnauthorized returns whether or not the response is a 401
 func (resp *Response) IsUnauthorized() bool {
 	return resp.StatusCode() == http.StatusUnauthorized
@@ -51,8 +68,11 @@ func (resp *Response) IsUnauthorized() bool {
 
 // Errors attempts to parse a response as OCI-compliant errors array
 func (resp *Response) Errors() ([]ErrorInfo, error) {
+	return parseErrors([]byte(resp.String()))
+}
+
+func parseErrors(bodyBytes []byte) ([]ErrorInfo, error) {
 	errorResponse := &ErrorResponse{}
-	bodyBytes := []byte(resp.String())
 	err := json.Unmarshal(bodyBytes, errorResponse)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,161 @@
+package reggie
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type (
+	// keyPairFiles locates a PEM-encoded client certificate and its key.
+	keyPairFiles struct {
+		CertFile string
+		KeyFile  string
+	}
+)
+
+// WithRootCAs verifies registry certificates against pool instead of the
+// system roots. Any CA files configured with WithRootCAFiles or found in a
+// certs directory are added to a copy of pool.
+func WithRootCAs(pool *x509.CertPool) clientOption {
+	return func(c *clientConfig) {
+		c.RootCAs = pool
+	}
+}
+
+// WithRootCAFiles trusts the PEM-encoded CA certificates in the given files,
+// in addition to the system roots.
+func WithRootCAFiles(files ...string) clientOption {
+	return func(c *clientConfig) {
+		c.RootCAFiles = append(c.RootCAFiles, files...)
+	}
+}
+
+// WithClientCertificate presents cert to registries requesting a client certificate.
+func WithClientCertificate(cert tls.Certificate) clientOption {
+	return func(c *clientConfig) {
+		c.ClientCertificates = append(c.ClientCertificates, cert)
+	}
+}
+
+// WithClientCertificateFiles presents the PEM-encoded certificate and key in
+// the given files to registries requesting a client certificate.
+func WithClientCertificateFiles(certFile string, keyFile string) clientOption {
+	return func(c *clientConfig) {
+		c.ClientCertificateFiles = append(c.ClientCertificateFiles, keyPairFiles{certFile, keyFile})
+	}
+}
+
+// WithMinTLSVersion sets the minimum TLS version accepted, e.g. tls.VersionTLS13.
+func WithMinTLSVersion(version uint16) clientOption {
+	return func(c *clientConfig) {
+		c.MinTLSVersion = version
+	}
+}
+
+// WithCertsDir loads TLS settings for the registry from a Docker-style certs
+// directory, such as /etc/docker/certs.d. Within the subdirectory named after
+// the registry host (and port, if any), files ending in ".crt" are trusted
+// as CA certificates, and each ".cert" file is presented as a client
+// certificate along with the ".key" file of the same name. A missing host
+// subdirectory is not an error.
+func WithCertsDir(dir string) clientOption {
+	return func(c *clientConfig) {
+		c.CertsDirs = append(c.CertsDirs, dir)
+	}
+}
+
+// tlsConfig builds the TLS configuration for the client's transport.
+func (c *clientConfig) tlsConfig() (*tls.Config, error) {
+	conf := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipTLSVerify, //nolint: gosec
+		MinVersion:         c.MinTLSVersion,
+		Certificates:       append([]tls.Certificate{}, c.ClientCertificates...),
+	}
+
+	caFiles := append([]string{}, c.RootCAFiles...)
+	keyPairs := append([]keyPairFiles{}, c.ClientCertificateFiles...)
+	if len(c.CertsDirs) > 0 {
+		u, err := url.Parse(c.Address)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range c.CertsDirs {
+			hostCAs, hostKeyPairs, err := readCertsDir(filepath.Join(dir, u.Host))
+			if err != nil {
+				return nil, err
+			}
+			caFiles = append(caFiles, hostCAs...)
+			keyPairs = append(keyPairs, hostKeyPairs...)
+		}
+	}
+
+	for _, kp := range keyPairs {
+		cert, err := tls.LoadX509KeyPair(kp.CertFile, kp.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate %s: %w", kp.CertFile, err)
+		}
+		conf.Certificates = append(conf.Certificates, cert)
+	}
+
+	if c.RootCAs == nil && len(caFiles) == 0 {
+		return conf, nil
+	}
+	var pool *x509.CertPool
+	if c.RootCAs != nil {
+		pool = c.RootCAs.Clone()
+	} else if system, err := x509.SystemCertPool(); err == nil {
+		pool = system
+	} else {
+		pool = x509.NewCertPool()
+	}
+	for _, file := range caFiles {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", file)
+		}
+	}
+	conf.RootCAs = pool
+	return conf, nil
+}
+
+// readCertsDir lists the CA files and client key pairs in a Docker-style
+// certs directory for a single host.
+func readCertsDir(dir string) ([]string, []keyPairFiles, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var caFiles []string
+	var keyPairs []keyPairFiles
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		switch filepath.Ext(name) {
+		case ".crt":
+			caFiles = append(caFiles, path)
+		case ".cert":
+			keyFile := filepath.Join(dir, strings.TrimSuffix(name, ".cert")+".key")
+			if _, err := os.Stat(keyFile); err != nil {
+				return nil, nil, fmt.Errorf("missing key for client certificate %s", path)
+			}
+			keyPairs = append(keyPairs, keyPairFiles{path, keyFile})
+		case ".key":
+			certFile := filepath.Join(dir, strings.TrimSuffix(name, ".key")+".cert")
+			if _, err := os.Stat(certFile); err != nil {
+				return nil, nil, fmt.Errorf("missing client certificate for key %s", path)
+			}
+		}
+	}
+	return caFiles, keyPairs, nil
+}
@@ -0,0 +1,154 @@
+package reggie
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert holds a certificate and its key in both parsed and PEM form.
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Errors generating key: %s", err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Errors creating certificate: %s", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	ca := newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "reggie test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	serverCert := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "registry"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	clientCert := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "client"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	serverKeyPair, _ := tls.X509KeyPair(serverCert.certPEM, serverCert.keyPEM)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverKeyPair},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	write := func(name string, b []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Errors creating directory: %s", err)
+		}
+		if err := os.WriteFile(path, b, 0600); err != nil {
+			t.Fatalf("Errors writing file: %s", err)
+		}
+		return path
+	}
+	caFile := write("ca.pem", ca.certPEM)
+	certFile := write("client.pem", clientCert.certPEM)
+	keyFile := write("client-key.pem", clientCert.keyPEM)
+
+	get := func(opts ...clientOption) error {
+		client, err := NewClient(server.URL, opts...)
+		if err != nil {
+			return err
+		}
+		_, err = client.Do(client.NewRequest(GET, "/v2/"))
+		return err
+	}
+
+	// the CA is unknown to the system roots
+	if err := get(WithClientCertificateFiles(certFile, keyFile)); err == nil {
+		t.Fatalf("Expected error verifying server certificate")
+	}
+
+	// the server requires a client certificate
+	if err := get(WithRootCAFiles(caFile)); err == nil {
+		t.Fatalf("Expected error without client certificate")
+	}
+
+	if err := get(WithRootCAFiles(caFile), WithClientCertificateFiles(certFile, keyFile)); err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+
+	clientKeyPair, _ := tls.X509KeyPair(clientCert.certPEM, clientCert.keyPEM)
+	if err := get(WithRootCAs(pool), WithClientCertificate(clientKeyPair), WithMinTLSVersion(tls.VersionTLS12)); err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+
+	// Docker-style certs.d directory
+	u, _ := url.Parse(server.URL)
+	certsDir := filepath.Join(dir, "certs.d")
+	write(filepath.Join("certs.d", u.Host, "ca.crt"), ca.certPEM)
+	write(filepath.Join("certs.d", u.Host, "client.cert"), clientCert.certPEM)
+	write(filepath.Join("certs.d", u.Host, "client.key"), clientCert.keyPEM)
+	if err := get(WithCertsDir(certsDir)); err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+
+	// a missing host directory is ignored
+	if err := get(WithCertsDir(filepath.Join(dir, "nope")), WithInsecureSkipTLSVerify(true)); err == nil {
+		t.Fatalf("Expected error without client certificate")
+	}
+
+	// a client certificate without a key is an error
+	os.Remove(filepath.Join(certsDir, u.Host, "client.key"))
+	if _, err := NewClient(server.URL, WithCertsDir(certsDir)); err == nil {
+		t.Fatalf("Expected error for client certificate without key")
+	}
+
+	if _, err := NewClient(server.URL, WithRootCAFiles(keyFile)); err == nil {
+		t.Fatalf("Expected error for CA file without certificates")
+	}
+}
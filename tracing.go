@@ -0,0 +1,114 @@
+package reggie
+
+import (
+	"context"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// tracerName is the instrumentation scope of spans created by the client.
+	tracerName = "github.com/bloodorangeio/reggie"
+)
+
+var (
+	attrRepository = attribute.Key("reggie.repository")
+	attrDigest     = attribute.Key("reggie.digest")
+	attrBytes      = attribute.Key("reggie.bytes")
+	attrSkipped    = attribute.Key("reggie.skipped")
+	attrAuthScope  = attribute.Key("reggie.auth.scope")
+)
+
+// WithTracerProvider creates spans for requests, authentication and blob
+// transfers using tp. Defaults to the global OpenTelemetry TracerProvider,
+// which does nothing unless one has been registered.
+func WithTracerProvider(tp trace.TracerProvider) clientOption {
+	return func(c *clientConfig) {
+		c.TracerProvider = tp
+	}
+}
+
+// WithPropagator sets the propagator used to send trace context to the
+// registry in request headers. Defaults to the global OpenTelemetry
+// TextMapPropagator.
+func WithPropagator(p propagation.TextMapPropagator) clientOption {
+	return func(c *clientConfig) {
+		c.Propagator = p
+	}
+}
+
+func (c *clientConfig) tracer() trace.Tracer {
+	tp := c.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+func (c *clientConfig) propagator() propagation.TextMapPropagator {
+	if c.Propagator != nil {
+		return c.Propagator
+	}
+	return otel.GetTextMapPropagator()
+}
+
+// startOperation starts a span for a high-level operation on a blob of the
+// given size, if known.
+func (client *Client) startOperation(ctx context.Context, operation string, name string, digest string, size int64) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attrRepository.String(client.repository(name)),
+		attrDigest.String(digest),
+	}
+	if size > 0 {
+		attrs = append(attrs, attrBytes.Int64(size))
+	}
+	return client.tracer.Start(ctx, "reggie."+operation, trace.WithAttributes(attrs...))
+}
+
+// startRequestSpan starts a span for a request executed by Do, and injects
+// its trace context into the request headers.
+func (client *Client) startRequestSpan(req *Request) trace.Span {
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.full", RedactURL(req.URL)),
+	}
+	if u, err := url.Parse(req.URL); err == nil {
+		attrs = append(attrs, attribute.String("server.address", u.Hostname()))
+	}
+	ctx, span := client.tracer.Start(req.Request.Context(), req.Method,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	req.Request.SetContext(ctx)
+	client.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return span
+}
+
+// endRequestSpan records the outcome of a request executed by Do.
+func (client *Client) endRequestSpan(span trace.Span, req *Request, resp *Response, err error) {
+	span.SetAttributes(attribute.Int("http.request.resend_count", req.retries()))
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode()))
+		if raw := resp.RawResponse; raw != nil && raw.ContentLength >= 0 {
+			span.SetAttributes(attribute.Int64("http.response.body.size", raw.ContentLength))
+		}
+		if resp.endpoint != "" {
+			span.SetAttributes(attribute.String("reggie.endpoint", resp.endpoint))
+		}
+		if resp.StatusCode() >= 400 {
+			span.SetStatus(codes.Error, resp.Status())
+		}
+	}
+	endSpan(span, err)
+}
+
+// endSpan ends a span, recording err, with any URLs redacted, as its status.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, RedactError(err))
+	}
+	span.End()
+}
@@ -0,0 +1,163 @@
+package reggie
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bloodorangeio/reggie/reggietest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	blob := []byte("traced blob")
+	desc := Descriptor{Digest: DigestFromBytes(blob), Size: int64(len(blob))}
+
+	var traceparents []string
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("Traceparent"))
+		w.Write([]byte(`{"token": "abc123"}`))
+	}))
+	defer authServer.Close()
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("Traceparent"))
+		if r.Header.Get("Authorization") != "Bearer abc123" {
+			w.Header().Set("Www-Authenticate", fmt.Sprintf(`Bearer realm="%s",service="test",scope="repository:a:pull"`, authServer.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+		w.Write(blob)
+	}))
+	defer registry.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	client, err := NewClient(registry.URL,
+		WithTracerProvider(tp),
+		WithPropagator(propagation.TraceContext{}))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := client.PullBlob(context.Background(), "a", desc, &buf); err != nil {
+		t.Fatalf("Errors pulling blob: %s", err)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = s
+	}
+	if len(spans) != 4 {
+		t.Fatalf("Expected 4 spans but got %d: %v", len(spans), exporter.GetSpans())
+	}
+	op, get, auth, token := spans["reggie.PullBlob"], spans["GET"], spans["reggie.auth"], spans["reggie.token"]
+	if get.Parent.SpanID() != op.SpanContext.SpanID() ||
+		auth.Parent.SpanID() != get.SpanContext.SpanID() ||
+		token.Parent.SpanID() != auth.SpanContext.SpanID() {
+		t.Fatalf("Unexpected span hierarchy")
+	}
+
+	expectAttributes(t, op, map[attribute.Key]attribute.Value{
+		attrRepository: attribute.StringValue("a"),
+		attrDigest:     attribute.StringValue(desc.Digest),
+		attrBytes:      attribute.Int64Value(desc.Size),
+	})
+	expectAttributes(t, get, map[attribute.Key]attribute.Value{
+		"http.request.method":       attribute.StringValue("GET"),
+		"http.response.status_code": attribute.IntValue(http.StatusOK),
+		"http.request.resend_count": attribute.IntValue(1),
+		"http.response.body.size":   attribute.Int64Value(desc.Size),
+	})
+	expectAttributes(t, token, map[attribute.Key]attribute.Value{
+		attrAuthScope:               attribute.StringValue("repository:a:pull"),
+		"http.response.status_code": attribute.IntValue(http.StatusOK),
+	})
+
+	traceID := op.SpanContext.TraceID().String()
+	if len(traceparents) != 3 {
+		t.Fatalf("Expected 3 requests but got %d", len(traceparents))
+	}
+	for _, tp := range traceparents {
+		if !strings.Contains(tp, traceID) {
+			t.Fatalf("Expected traceparent for trace %s but got %q", traceID, tp)
+		}
+	}
+}
+
+func TestTracingRecordsErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	client, err := NewClient(ts.URL,
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+
+	if _, err := client.BlobExists(context.Background(), "a", DigestFromBytes(nil)); err == nil {
+		t.Fatalf("Expected error checking blob")
+	}
+	for _, s := range exporter.GetSpans() {
+		if s.Status.Code != codes.Error {
+			t.Fatalf("Expected span %s to have error status but got %v", s.Name, s.Status)
+		}
+	}
+}
+
+func TestTracingOperations(t *testing.T) {
+	ctx := context.Background()
+	registry := reggietest.NewRegistry()
+	defer registry.Close()
+	manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","artifactType":"application/vnd.example",`+
+		`"config":{"mediaType":"%s","digest":"%s","size":2},"layers":[]}`,
+		MediaTypeImageManifest, MediaTypeEmptyJSON, EmptyConfig.Digest)
+	registry.PutManifest("a", "v1", MediaTypeImageManifest, []byte(manifest))
+
+	exporter := tracetest.NewInMemoryExporter()
+	client, err := NewClient(registry.URL,
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	client.DiscoverExtensions(ctx)
+	client.DiscoverRepositoryExtensions(ctx, "a")
+	if _, err := client.FetchArtifact(ctx, "a", "v1"); err != nil {
+		t.Fatalf("Errors fetching artifact: %s", err)
+	}
+
+	spans := map[string]bool{}
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = true
+	}
+	for _, name := range []string{"reggie.DiscoverExtensions", "reggie.DiscoverRepositoryExtensions", "reggie.FetchArtifact"} {
+		if !spans[name] {
+			t.Fatalf("Expected span %s", name)
+		}
+	}
+}
+
+func expectAttributes(t *testing.T, span tracetest.SpanStub, expected map[attribute.Key]attribute.Value) {
+	t.Helper()
+	actual := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		actual[kv.Key] = kv.Value
+	}
+	for k, v := range expected {
+		if actual[k] != v {
+			t.Fatalf("Expected %s attribute %s=%s but got %s", span.Name, k, v.Emit(), actual[k].Emit())
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package reggie
+
+import (
+	"context"
+	"sync"
+)
+
+type (
+	// TransferManager schedules blob transfers, bounding how many run at
+	// once overall and per registry host, and deduplicating transfers of
+	// the same content that are already in flight. A single TransferManager
+	// may be shared between multiple clients via WithTransferManager.
+	TransferManager struct {
+		global  chan struct{}
+		perHost int
+
+		mu       sync.Mutex
+		hosts    map[string]chan struct{}
+		inflight map[string]*transferCall
+	}
+
+	// transferCall tracks a single in-flight transfer and the callers
+	// waiting on its result.
+	transferCall struct {
+		done chan struct{}
+		err  error
+
+		// abandoned reports whether the transfer failed after the context
+		// of the caller running it was done.
+		abandoned bool
+	}
+)
+
+// NewTransferManager builds a new TransferManager. A limit of zero or less
+// means unlimited.
+func NewTransferManager(maxConcurrent int, maxConcurrentPerHost int) *TransferManager {
+	tm := &TransferManager{
+		perHost:  maxConcurrentPerHost,
+		hosts:    map[string]chan struct{}{},
+		inflight: map[string]*transferCall{},
+	}
+	if maxConcurrent > 0 {
+		tm.global = make(chan struct{}, maxConcurrent)
+	}
+	return tm
+}
+
+// Do runs fn once a slot is available for host. If a transfer with the same
+// key is already in flight, Do waits for it and returns its result instead
+// of running fn again. An empty key disables deduplication.
+//
+// The shared transfer runs with the context of the caller that started it;
+// other callers only stop waiting when their own context is done. If the
+// shared transfer fails because its caller's context is done, waiting
+// callers whose context is still live run the transfer again.
+func (tm *TransferManager) Do(ctx context.Context, host string, key string, fn func(context.Context) error) error {
+	if key == "" {
+		return tm.run(ctx, host, fn)
+	}
+
+	for {
+		tm.mu.Lock()
+		call, ok := tm.inflight[key]
+		if !ok {
+			call = &transferCall{done: make(chan struct{})}
+			tm.inflight[key] = call
+			tm.mu.Unlock()
+			return tm.lead(ctx, host, key, call, fn)
+		}
+		tm.mu.Unlock()
+		select {
+		case <-call.done:
+			if call.err == nil || !call.abandoned || ctx.Err() != nil {
+				return call.err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// lead runs the transfer for a deduplicated call and releases its waiters.
+func (tm *TransferManager) lead(ctx context.Context, host string, key string, call *transferCall, fn func(context.Context) error) error {
+	call.err = tm.run(ctx, host, fn)
+	call.abandoned = ctx.Err() != nil
+
+	tm.mu.Lock()
+	delete(tm.inflight, key)
+	tm.mu.Unlock()
+	close(call.done)
+
+	return call.err
+}
+
+// run acquires a per-host slot, then a global slot, and runs fn.
+func (tm *TransferManager) run(ctx context.Context, host string, fn func(context.Context) error) error {
+	if sem := tm.hostSemaphore(host); sem != nil {
+		if err := acquire(ctx, sem); err != nil {
+			return err
+		}
+		defer release(sem)
+	}
+	if tm.global != nil {
+		if err := acquire(ctx, tm.global); err != nil {
+			return err
+		}
+		defer release(tm.global)
+	}
+	return fn(ctx)
+}
+
+func (tm *TransferManager) hostSemaphore(host string) chan struct{} {
+	if tm.perHost <= 0 {
+		return nil
+	}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	sem, ok := tm.hosts[host]
+	if !ok {
+		sem = make(chan struct{}, tm.perHost)
+		tm.hosts[host] = sem
+	}
+	return sem
+}
+
+func acquire(ctx context.Context, sem chan struct{}) error {
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func release(sem chan struct{}) {
+	<-sem
+}
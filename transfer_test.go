@@ -0,0 +1,144 @@
+package reggie
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransferManagerLimits(t *testing.T) {
+	tm := NewTransferManager(3, 2)
+
+	var mu sync.Mutex
+	running := map[string]int{}
+	maxPerHost := map[string]int{}
+	var total, maxTotal int
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		host := "a.io"
+		if i%2 == 0 {
+			host = "b.io"
+		}
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			err := tm.Do(context.Background(), host, "", func(context.Context) error {
+				mu.Lock()
+				running[host]++
+				total++
+				if running[host] > maxPerHost[host] {
+					maxPerHost[host] = running[host]
+				}
+				if total > maxTotal {
+					maxTotal = total
+				}
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				running[host]--
+				total--
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		}(host)
+	}
+	wg.Wait()
+
+	if maxTotal > 3 {
+		t.Fatalf("Expected at most 3 concurrent transfers but saw %d", maxTotal)
+	}
+	for host, n := range maxPerHost {
+		if n > 2 {
+			t.Fatalf("Expected at most 2 concurrent transfers for %s but saw %d", host, n)
+		}
+	}
+}
+
+func TestTransferManagerDeduplicates(t *testing.T) {
+	tm := NewTransferManager(0, 0)
+
+	var calls int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := tm.Do(context.Background(), "a.io", "same", func(context.Context) error {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("Expected transfer to run once but ran %d times", n)
+	}
+}
+
+func TestTransferManagerContextCanceled(t *testing.T) {
+	tm := NewTransferManager(1, 0)
+	block := make(chan struct{})
+	go tm.Do(context.Background(), "a.io", "", func(context.Context) error {
+		<-block
+		return nil
+	})
+	defer close(block)
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := tm.Do(ctx, "a.io", "", func(context.Context) error { return nil })
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected deadline exceeded but got %v", err)
+	}
+}
+
+func TestTransferManagerWaiterTakesOver(t *testing.T) {
+	tm := NewTransferManager(0, 0)
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	leaderDone := make(chan error)
+	go func() {
+		leaderDone <- tm.Do(leaderCtx, "a.io", "same", func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+	<-started
+
+	var calls int32
+	waiterDone := make(chan error)
+	go func() {
+		waiterDone <- tm.Do(context.Background(), "a.io", "same", func(context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if err := <-leaderDone; err != context.Canceled {
+		t.Fatalf("Expected leader to be canceled but got %v", err)
+	}
+	if err := <-waiterDone; err != nil {
+		t.Fatalf("Expected waiter to take over the transfer but got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("Expected waiter to run the transfer once but ran %d times", n)
+	}
+}
@@ -0,0 +1,198 @@
+package reggie
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"time"
+)
+
+const (
+	// DefaultDialTimeout is the default maximum time to establish a connection.
+	DefaultDialTimeout = 30 * time.Second
+
+	// DefaultKeepAlive is the default interval between keep-alive probes.
+	DefaultKeepAlive = 30 * time.Second
+
+	// DefaultTLSHandshakeTimeout is the default maximum time for a TLS handshake.
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+
+	// DefaultIdleConnTimeout is the default maximum time an idle connection is kept open.
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+type (
+	// TransportWrapper wraps an http.RoundTripper, e.g. to add behavior
+	// around each request.
+	TransportWrapper func(http.RoundTripper) http.RoundTripper
+)
+
+// WithDialTimeout sets the maximum time to establish a connection.
+func WithDialTimeout(timeout time.Duration) clientOption {
+	return func(c *clientConfig) {
+		c.DialTimeout = timeout
+	}
+}
+
+// WithTLSHandshakeTimeout sets the maximum time for a TLS handshake.
+func WithTLSHandshakeTimeout(timeout time.Duration) clientOption {
+	return func(c *clientConfig) {
+		c.TLSHandshakeTimeout = timeout
+	}
+}
+
+// WithIdleConnTimeout sets the maximum time an idle connection is kept open.
+func WithIdleConnTimeout(timeout time.Duration) clientOption {
+	return func(c *clientConfig) {
+		c.IdleConnTimeout = timeout
+	}
+}
+
+// WithResponseHeaderTimeout sets the maximum time to wait for response
+// headers after a request has been written. Zero means no timeout.
+func WithResponseHeaderTimeout(timeout time.Duration) clientOption {
+	return func(c *clientConfig) {
+		c.ResponseHeaderTimeout = timeout
+	}
+}
+
+// WithProxy sends requests through the proxy at proxyURL, which may use the
+// http, https or socks5 scheme, instead of the proxy configured in the
+// environment. An empty URL disables proxying altogether.
+func WithProxy(proxyURL string) clientOption {
+	return func(c *clientConfig) {
+		c.Proxy = &proxyURL
+	}
+}
+
+// WithHTTP2 forces the client to attempt HTTP/2 when enabled, or restricts it
+// to HTTP/1.1 when disabled.
+func WithHTTP2(enabled bool) clientOption {
+	return func(c *clientConfig) {
+		c.HTTP2 = &enabled
+	}
+}
+
+// WithUnixSocket dials the Unix domain socket at path for every request,
+// regardless of the host in the client address.
+func WithUnixSocket(path string) clientOption {
+	return func(c *clientConfig) {
+		c.UnixSocket = path
+	}
+}
+
+// WithTransport replaces the transport built by the client. Options
+// configuring timeouts, proxies, TLS, HTTP/2 and Unix sockets are ignored,
+// while rate limits and transport wrappers still apply.
+func WithTransport(transport http.RoundTripper) clientOption {
+	return func(c *clientConfig) {
+		c.Transport = transport
+	}
+}
+
+// WithTransportWrapper wraps the client's transport. Wrappers are applied in
+// order, so the last one configured is the outermost.
+func WithTransportWrapper(wrapper TransportWrapper) clientOption {
+	return func(c *clientConfig) {
+		c.TransportWrappers = append(c.TransportWrappers, wrapper)
+	}
+}
+
+// createTransport builds the client transport from its configuration.
+func createTransport(conf *clientConfig) (http.RoundTripper, error) {
+	transport := conf.Transport
+	if transport == nil {
+		httpTransport, err := createHTTPTransport(conf)
+		if err != nil {
+			return nil, err
+		}
+		transport = httpTransport
+		if hosts := conf.insecureMirrorHosts(); len(hosts) > 0 && !conf.InsecureSkipTLSVerify {
+			transport = newInsecureHostTransport(httpTransport, hosts)
+		}
+	}
+	if conf.RateLimiter != nil || conf.BandwidthLimiter != nil {
+		transport = &limitedTransport{
+			next:      transport,
+			requests:  conf.RateLimiter,
+			bandwidth: conf.BandwidthLimiter,
+		}
+	}
+	if conf.Metrics != nil {
+		transport = &meteredTransport{next: transport, metrics: conf.Metrics}
+	}
+	for _, wrap := range conf.TransportWrappers {
+		transport = wrap(transport)
+	}
+	return transport, nil
+}
+
+// adapted from Resty: https://github.com/go-resty/resty/blob/de0735f66dae7abf8fb1073b4ace3032c1491424/client.go#L928
+func createHTTPTransport(conf *clientConfig) (*http.Transport, error) {
+	tlsConfig, err := conf.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{
+		Timeout:   durationOrDefault(conf.DialTimeout, DefaultDialTimeout),
+		KeepAlive: DefaultKeepAlive,
+		DualStack: true,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       durationOrDefault(conf.IdleConnTimeout, DefaultIdleConnTimeout),
+		TLSHandshakeTimeout:   durationOrDefault(conf.TLSHandshakeTimeout, DefaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: conf.ResponseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		MaxIdleConnsPerHost:   runtime.GOMAXPROCS(0) + 1,
+		DisableCompression:    true,
+		TLSClientConfig:       tlsConfig,
+	}
+
+	if conf.Proxy != nil {
+		if *conf.Proxy == "" {
+			transport.Proxy = nil
+		} else {
+			u, err := url.Parse(*conf.Proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy URL: %w", err)
+			}
+			switch u.Scheme {
+			case "http", "https", "socks5":
+			default:
+				return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+			}
+			transport.Proxy = http.ProxyURL(u)
+		}
+	}
+
+	if conf.HTTP2 != nil {
+		if *conf.HTTP2 {
+			transport.ForceAttemptHTTP2 = true
+		} else {
+			transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		}
+	}
+
+	if socket := conf.UnixSocket; socket != "" {
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+	}
+
+	return transport, nil
+}
+
+func durationOrDefault(d time.Duration, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,158 @@
+package reggie
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestTransportOptions(t *testing.T) {
+	// proxy receiving requests for an unreachable registry
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	client, err := NewClient("http://registry.invalid", WithProxy(proxy.URL))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	if _, err := client.Do(client.NewRequest(GET, "/v2/")); err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if proxied != "http://registry.invalid/v2/" {
+		t.Fatalf("Expected request to go through proxy but proxy saw %q", proxied)
+	}
+
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	client, err = NewClient("http://registry.invalid", WithProxy(""), WithDialTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	proxied = ""
+	if _, err := client.Do(client.NewRequest(GET, "/v2/")); err == nil || proxied != "" {
+		t.Fatalf("Expected empty proxy to disable proxy from environment")
+	}
+
+	if _, err := NewClient("http://registry.invalid", WithProxy("ftp://proxy")); err == nil {
+		t.Fatalf("Expected error for unsupported proxy scheme")
+	}
+
+	// registry listening on a Unix domain socket
+	socket := filepath.Join(t.TempDir(), "registry.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Errors listening on socket: %s", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Distribution-Api-Version", "registry/2.0")
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+	client, err = NewClient("http://localhost", WithUnixSocket(socket))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	resp, err := client.Do(client.NewRequest(GET, "/v2/"))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if resp.Header().Get("Docker-Distribution-Api-Version") == "" {
+		t.Fatalf("Expected response from registry on socket")
+	}
+
+	// replaced and wrapped transports
+	var calls []string
+	replacement := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls = append(calls, "transport")
+		return &http.Response{
+			StatusCode: http.StatusTeapot,
+			Body:       http.NoBody,
+			Header:     http.Header{},
+			Request:    req,
+		}, nil
+	})
+	wrapper := func(name string) TransportWrapper {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	client, err = NewClient("http://registry.invalid",
+		WithTransport(replacement),
+		WithTransportWrapper(wrapper("inner")),
+		WithTransportWrapper(wrapper("outer")))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	resp, err = client.Do(client.NewRequest(GET, "/v2/"))
+	if err != nil {
+		t.Fatalf("Errors executing request: %s", err)
+	}
+	if resp.StatusCode() != http.StatusTeapot {
+		t.Fatalf("Expected response from replacement transport but got %d", resp.StatusCode())
+	}
+	if c := strings.Join(calls, ","); c != "outer,inner,transport" {
+		t.Fatalf("Unexpected transport call order: %s", c)
+	}
+}
+
+func TestTransportHTTP2AndTimeouts(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Header().Set("X-Proto", r.Proto)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	for _, tc := range []struct {
+		opts  []clientOption
+		proto string
+	}{
+		{[]clientOption{WithHTTP2(true)}, "HTTP/2.0"},
+		{[]clientOption{WithHTTP2(false)}, "HTTP/1.1"},
+		{nil, "HTTP/1.1"},
+	} {
+		client, err := NewClient(server.URL, append(tc.opts, WithInsecureSkipTLSVerify(true))...)
+		if err != nil {
+			t.Fatalf("Errors creating client: %s", err)
+		}
+		resp, err := client.Do(client.NewRequest(GET, "/v2/"))
+		if err != nil {
+			t.Fatalf("Errors executing request: %s", err)
+		}
+		if p := resp.Header().Get("X-Proto"); p != tc.proto {
+			t.Fatalf("Expected %s but got %s", tc.proto, p)
+		}
+	}
+
+	client, err := NewClient(server.URL,
+		WithInsecureSkipTLSVerify(true),
+		WithResponseHeaderTimeout(50*time.Millisecond),
+		WithTLSHandshakeTimeout(time.Second),
+		WithIdleConnTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("Errors creating client: %s", err)
+	}
+	if _, err := client.Do(client.NewRequest(GET, "/slow")); err == nil {
+		t.Fatalf("Expected response header timeout")
+	}
+}